@@ -0,0 +1,373 @@
+package re
+
+import (
+	"container/list"
+	"errors"
+	"hash/maphash"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"go.starlark.net/starlark"
+
+	"github.com/magnetde/starlark-re/regex"
+)
+
+// Number of shards of a shared cache.
+const sharedCacheShards = 16
+
+// PatternCache is the interface of a cache for compiled patterns (see `ModuleOptions.Cache`).
+// Implementations must be safe for concurrent use.
+// `Put` should not modify the cache, if it already contains the key.
+//
+// Besides these functions, a cache may implement the following functions:
+//   - `Stats() CacheStats` returns statistics about the cache (see `Module.Stats` and `re.cache_info`).
+//   - `Range(fn func(key CacheKey, p *Pattern))` calls `fn` for each cached pattern, ordered from
+//     the least to the most recently used pattern (see `Module.Export`).
+//   - `GetOrCompile(key CacheKey, compile func() (*Pattern, bool, error)) (*Pattern, error)` returns the cached
+//     pattern of the key or calls `compile` to compile it, which also reports, whether the pattern may be cached.
+//     It is used instead of `Get` and `Put`, so the cache can control how patterns are compiled, for example
+//     to compile a pattern only once, if multiple threads need it at the same time.
+type PatternCache interface {
+	Get(key CacheKey) (*Pattern, bool)
+	Put(key CacheKey, p *Pattern)
+	Purge()
+}
+
+// CacheKey is the type, that is used for keys of a pattern cache.
+// Besides the pattern, its type and the flags, it contains the options of the module,
+// that affect compiling patterns, because modules with different options may share a cache.
+type CacheKey struct {
+	Pattern  string        // pattern string
+	IsStr    bool          // pattern is of type `str`
+	Flags    uint32        // flags passed when compiling the pattern
+	Fallback bool          // fallback engine is enabled
+	Locale   *regex.Locale // locale for bytes patterns with the LOCALE flag; may be nil
+	Engine   string        // name of the regex engine, that compiles the pattern; empty if selected by capabilities
+}
+
+// compile compiles the pattern of the key (see `newPattern`).
+func (k CacheKey) compile(thread *starlark.Thread) (*Pattern, bool, error) {
+	pattern := strOrBytes{
+		value:    k.Pattern,
+		isString: k.IsStr,
+	}
+
+	return newPattern(thread, pattern, k.Flags, k.Fallback, k.Locale, k.Engine)
+}
+
+// statsCache is the interface of a pattern cache, that provides statistics.
+type statsCache interface {
+	Stats() CacheStats
+}
+
+// rangeCache is the interface of a pattern cache, whose patterns can be iterated.
+type rangeCache interface {
+	Range(fn func(key CacheKey, p *Pattern))
+}
+
+// compilingCache is the interface of a pattern cache, that compiles missing patterns itself.
+type compilingCache interface {
+	GetOrCompile(key CacheKey, compile func() (*Pattern, bool, error)) (*Pattern, error)
+}
+
+// Check if the types satisfy the interfaces.
+var (
+	_ PatternCache   = (*LRUCache)(nil)
+	_ statsCache     = (*LRUCache)(nil)
+	_ rangeCache     = (*LRUCache)(nil)
+	_ PatternCache   = (*SharedCache)(nil)
+	_ statsCache     = (*SharedCache)(nil)
+	_ rangeCache     = (*SharedCache)(nil)
+	_ compilingCache = (*SharedCache)(nil)
+)
+
+// SharedCache is a pattern cache, that can be shared between multiple "re" modules
+// (see `ModuleOptions.Cache`). The size of the cache is bounded by the number of patterns.
+// It is safe for concurrent use by multiple modules and threads.
+//
+// To reduce lock contention, the cache is split into several shards, each with its own LRU list and mutex.
+// A pattern is assigned to a shard by its hash value.
+// Patterns are compiled outside of the lock of the shard.
+// If multiple threads compile the same pattern at the same time, the pattern is only compiled once
+// and all threads receive the same compiled pattern.
+//
+// Since the maximum size is divided between all shards, the least recently used pattern of a shard
+// is removed, when the shard exceeds its size. This may not be the least recently used pattern
+// of the whole cache. Caches with less than 16 patterns use one shard per pattern.
+type SharedCache struct {
+	clock     uint64 // number of uses of all patterns, which orders the patterns of all shards; accessed atomically
+	seed      maphash.Seed
+	maxSize   int
+	numShards int // number of used shards
+	shards    [sharedCacheShards]cacheShard
+}
+
+// cacheShard is a single shard of a shared cache.
+type cacheShard struct {
+	mu      sync.Mutex                 // mutex for the shard
+	list    *list.List                 // least recent used regexes
+	cache   map[CacheKey]*list.Element // mapping of patterns to list elements
+	calls   map[CacheKey]*cacheCall    // currently running compilations
+	maxSize int                        // maximum number of patterns in the shard
+
+	hits      int // number of patterns found in the shard
+	misses    int // number of patterns not found in the shard, including patterns, that were compiled by another thread
+	evictions int // number of patterns removed from the shard because it exceeded the maximum size
+}
+
+// sharedValue represents elements in the linked list of a cache shard.
+type sharedValue struct {
+	pattern *Pattern
+	key     CacheKey
+	used    uint64 // value of the clock of the cache, when the pattern was last used
+}
+
+// cacheCall represents a running compilation of a pattern.
+// Threads, that need the same pattern, wait until the compilation is done.
+type cacheCall struct {
+	wg      sync.WaitGroup
+	pattern *Pattern
+	err     error
+}
+
+// errCompileAborted is returned to threads waiting for a compilation, that did not finish.
+var errCompileAborted = errors.New("compiling the pattern was aborted")
+
+// NewSharedCache creates a new shared pattern cache, that contains at most `maxSize` compiled patterns.
+// If the maximum size is not a positive integer, the default maximum size of 64 is used.
+func NewSharedCache(maxSize int) *SharedCache {
+	if maxSize <= 0 {
+		maxSize = defaultMaxCacheSize
+	}
+
+	c := SharedCache{
+		seed:      maphash.MakeSeed(),
+		maxSize:   maxSize,
+		numShards: sharedCacheShards,
+	}
+
+	if maxSize < c.numShards {
+		c.numShards = maxSize
+	}
+
+	// Distribute the maximum size exactly between the shards.
+	for i := range c.shards[:c.numShards] {
+		s := &c.shards[i]
+		s.list = list.New()
+		s.cache = make(map[CacheKey]*list.Element)
+		s.calls = make(map[CacheKey]*cacheCall)
+		s.maxSize = maxSize / c.numShards
+
+		if i < maxSize%c.numShards {
+			s.maxSize++
+		}
+	}
+
+	return &c
+}
+
+// shard returns the shard, that is responsible for the key.
+func (c *SharedCache) shard(key CacheKey) *cacheShard {
+	h := maphash.String(c.seed, key.Pattern) ^ uint64(key.Flags)
+	return &c.shards[h%uint64(c.numShards)]
+}
+
+// use marks the cached pattern as the most recently used pattern of the whole cache.
+// The caller must hold the lock of the shard of the pattern.
+func (c *SharedCache) use(v *sharedValue) {
+	v.used = atomic.AddUint64(&c.clock, 1)
+}
+
+// Purge clears all shards of the cache and their statistics.
+// Note, that this affects all modules sharing the cache.
+func (c *SharedCache) Purge() {
+	for i := range c.shards[:c.numShards] {
+		s := &c.shards[i]
+
+		s.mu.Lock()
+
+		s.list.Init()
+
+		// clear(s.cache)
+		for k := range s.cache {
+			delete(s.cache, k)
+		}
+
+		s.hits = 0
+		s.misses = 0
+		s.evictions = 0
+
+		s.mu.Unlock()
+	}
+}
+
+// Stats returns statistics about the whole cache, summed up over all shards.
+func (c *SharedCache) Stats() CacheStats {
+	stats := CacheStats{
+		MaxSize: c.maxSize,
+		Engines: make(map[string]int),
+	}
+
+	for i := range c.shards[:c.numShards] {
+		s := &c.shards[i]
+
+		s.mu.Lock()
+
+		stats.Hits += s.hits
+		stats.Misses += s.misses
+		stats.Evictions += s.evictions
+		stats.Size += s.list.Len()
+
+		for e := s.list.Front(); e != nil; e = e.Next() {
+			p := e.Value.(*sharedValue).pattern
+			stats.Engines[p.re.Program().Engine]++
+		}
+
+		s.mu.Unlock()
+	}
+
+	return stats
+}
+
+// Get returns the compiled pattern of the key, if the cache contains the key.
+func (c *SharedCache) Get(key CacheKey) (*Pattern, bool) {
+	s := c.shard(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.cache[key]; ok {
+		s.list.MoveToFront(e) // "refresh" the pattern in the linked list
+		s.hits++
+
+		v := e.Value.(*sharedValue)
+		c.use(v)
+
+		return v.pattern, true
+	}
+
+	s.misses++
+	return nil, false
+}
+
+// GetOrCompile returns the compiled pattern of the key by using the cache.
+// If the pattern already exists in the cache, the compiled pattern is returned.
+// If the pattern is currently compiled by another thread, the function waits for the result.
+// Otherwise, the pattern is compiled with `compile` outside of the lock and then added to the cache,
+// if `compile` reports, that the pattern may be cached.
+func (c *SharedCache) GetOrCompile(key CacheKey, compile func() (*Pattern, bool, error)) (*Pattern, error) {
+	s := c.shard(key)
+
+	s.mu.Lock()
+
+	if e, ok := s.cache[key]; ok { // pattern found in the cache
+		s.list.MoveToFront(e) // "refresh" the pattern in the linked list
+		s.hits++
+
+		v := e.Value.(*sharedValue)
+		c.use(v)
+		s.mu.Unlock()
+
+		return v.pattern, nil
+	}
+
+	// The pattern is currently compiled by another thread. It is counted as a miss, because the pattern
+	// was not found in the cache and the compilation may still fail.
+	if call, ok := s.calls[key]; ok {
+		s.misses++
+		s.mu.Unlock()
+
+		call.wg.Wait()
+		return call.pattern, call.err
+	}
+
+	call := &cacheCall{err: errCompileAborted} // reported to waiting threads, if compiling panics
+	call.wg.Add(1)
+
+	s.calls[key] = call
+	s.misses++
+	s.mu.Unlock()
+
+	add := false
+
+	// Release waiting threads, even if compiling the pattern panics.
+	defer func() {
+		s.mu.Lock()
+
+		delete(s.calls, key)
+		if call.err == nil && add {
+			c.add(s, key, call.pattern)
+		}
+
+		s.mu.Unlock()
+
+		call.wg.Done()
+	}()
+
+	p, add, err := compile()
+	call.pattern = p
+	call.err = err
+
+	return p, err
+}
+
+// Put adds a compiled pattern to the cache, if the cache does not already contain the key.
+func (c *SharedCache) Put(key CacheKey, p *Pattern) {
+	s := c.shard(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.cache[key]; !ok {
+		c.add(s, key, p)
+	}
+}
+
+// add adds the compiled pattern to the shard.
+// When the shard exceeds its maximum size, the oldest entry of the shard is removed.
+// The caller must hold the lock of the shard.
+func (c *SharedCache) add(s *cacheShard, key CacheKey, p *Pattern) {
+	if s.list.Len() >= s.maxSize {
+		last := s.list.Back() // determine the oldest element
+
+		// Delete from map and list
+		delete(s.cache, last.Value.(*sharedValue).key)
+		s.list.Remove(last)
+		s.evictions++
+	}
+
+	v := &sharedValue{
+		pattern: p,
+		key:     key,
+	}
+	c.use(v)
+
+	s.cache[key] = s.list.PushFront(v)
+}
+
+// Range calls `fn` for each cached pattern, ordered from the least to the most recently used pattern
+// of the whole cache. The patterns are collected before `fn` is called, so `fn` may access the cache.
+func (c *SharedCache) Range(fn func(key CacheKey, p *Pattern)) {
+	var values []sharedValue
+
+	for i := range c.shards[:c.numShards] {
+		s := &c.shards[i]
+
+		s.mu.Lock()
+
+		for e := s.list.Front(); e != nil; e = e.Next() {
+			values = append(values, *e.Value.(*sharedValue))
+		}
+
+		s.mu.Unlock()
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].used < values[j].used
+	})
+
+	for _, v := range values {
+		fn(v.key, v.pattern)
+	}
+}
@@ -0,0 +1,370 @@
+// Command starlark-re-grep searches files for lines matching a Python-compatible regex pattern.
+// The pattern is compiled by `regex.Compile` exactly as by the Starlark "re" module, so patterns can be tested
+// against files with the same semantics, that Starlark scripts see.
+//
+// Usage:
+//
+//	starlark-re-grep [options] PATTERN [FILE...]
+//
+// Each line is searched without its trailing newline. If no file is given or if the file is "-",
+// the standard input is read. The exit status is 0 if a line matched, 1 if no line matched and 2 on errors.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/magnetde/starlark-re/regex"
+)
+
+// Exit codes like grep.
+const (
+	exitMatch   = 0
+	exitNoMatch = 1
+	exitError   = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// options contains the command line options.
+type options struct {
+	onlyMatching bool
+	count        bool
+	lineNumbers  bool
+	onlyGroup    string
+	sub          string
+	hasSub       bool
+	flags        string
+	bytes        bool
+	fallback     bool
+	engine       bool
+}
+
+// grep contains the compiled pattern and the state of a search.
+type grep struct {
+	opts     *options
+	re       regex.Engine
+	group    int                  // group to print; 0 for the whole match
+	template []regex.TemplateRule // parsed template of `--sub`
+	w        *bufio.Writer
+	prefix   bool // whether the lines are prefixed with the file name
+	matched  bool // whether any line matched
+}
+
+// run runs the command with the arguments and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var opts options
+
+	fs := flag.NewFlagSet("starlark-re-grep", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: starlark-re-grep [options] PATTERN [FILE...]")
+		fs.PrintDefaults()
+	}
+
+	fs.BoolVar(&opts.onlyMatching, "o", false, "print only the matched parts of lines, each on a separate line")
+	fs.BoolVar(&opts.count, "c", false, "print only the number of matching lines")
+	fs.BoolVar(&opts.lineNumbers, "n", false, "prefix each line of output with its line number")
+	fs.StringVar(&opts.onlyGroup, "only-group", "", "print only the text of the group `GROUP` (number or name) of each match")
+	fs.Func("sub", "print all lines, where the matches are replaced by the `TEMPLATE` (like `re.sub`)", func(s string) error {
+		opts.sub, opts.hasSub = s, true
+		return nil
+	})
+	fs.StringVar(&opts.flags, "flags", "", "Python regex flags as `LETTERS`, like \"im\" (a, i, L, m, s, u, x)")
+	fs.BoolVar(&opts.bytes, "bytes", false, "compile the pattern as a bytes pattern and search bytes instead of strings")
+	fs.BoolVar(&opts.fallback, "fallback", false, "set the FALLBACK flag to always use the fallback engine")
+	fs.BoolVar(&opts.engine, "engine", false, "report the regex engine selected for the pattern and exit")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitMatch
+		}
+
+		return exitError
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitError
+	}
+
+	g, err := newGrep(&opts, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "starlark-re-grep: %v\n", err)
+		return exitError
+	}
+
+	g.w = bufio.NewWriter(stdout)
+	defer g.w.Flush()
+
+	if opts.engine {
+		g.report()
+		return exitMatch
+	}
+
+	files := fs.Args()[1:]
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	g.prefix = len(files) > 1
+
+	status := exitNoMatch
+	for _, name := range files {
+		if err := g.file(name, stdin); err != nil {
+			g.w.Flush()
+			fmt.Fprintf(stderr, "starlark-re-grep: %v\n", err)
+			status = exitError
+		}
+	}
+
+	if g.matched && status != exitError {
+		status = exitMatch
+	}
+
+	return status
+}
+
+// newGrep compiles the pattern with the options.
+func newGrep(opts *options, pattern string) (*grep, error) {
+	modes := 0
+	for _, set := range []bool{opts.onlyMatching || opts.onlyGroup != "", opts.count, opts.hasSub} {
+		if set {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return nil, errors.New("the options -o/--only-group, -c and --sub cannot be combined")
+	}
+
+	flags, err := regex.ParseFlags(opts.flags)
+	if err != nil {
+		return nil, err
+	}
+	if opts.fallback {
+		flags |= regex.FlagFallback
+	}
+
+	re, _, err := regex.Compile(pattern, !opts.bytes, flags, true, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &grep{opts: opts, re: re}
+
+	if opts.onlyGroup != "" {
+		g.group, err = groupIndex(re, opts.onlyGroup)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.hasSub {
+		g.template, err = regex.ParseTemplate(re, opts.sub, !opts.bytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return g, nil
+}
+
+// groupIndex returns the index of the group, which is either a group number or a group name.
+func groupIndex(re regex.Engine, group string) (int, error) {
+	if i, err := strconv.Atoi(group); err == nil {
+		if i < 0 || i > re.SubexpCount() {
+			return 0, fmt.Errorf("invalid group reference %d", i)
+		}
+
+		return i, nil
+	}
+
+	i := re.SubexpIndex(group)
+	if i < 0 {
+		return 0, fmt.Errorf("unknown group name %q", group)
+	}
+
+	return i, nil
+}
+
+// report writes the regex engine selected for the pattern, the flags and the number of groups.
+func (g *grep) report() {
+	fmt.Fprintf(g.w, "engine: %s\n", g.re.Program().Engine)
+	fmt.Fprintf(g.w, "flags: %s\n", flagNames(g.re.Flags()))
+	fmt.Fprintf(g.w, "groups: %d\n", g.re.SubexpCount())
+}
+
+// flagNames returns the names of the flags like in Python, like "re.IGNORECASE|re.UNICODE".
+func flagNames(flags uint32) string {
+	names := []struct {
+		flag uint32
+		name string
+	}{
+		{regex.FlagIgnoreCase, "IGNORECASE"},
+		{regex.FlagLocale, "LOCALE"},
+		{regex.FlagMultiline, "MULTILINE"},
+		{regex.FlagDotAll, "DOTALL"},
+		{regex.FlagUnicode, "UNICODE"},
+		{regex.FlagVerbose, "VERBOSE"},
+		{regex.FlagASCII, "ASCII"},
+		{regex.FlagFallback, "FALLBACK"},
+	}
+
+	var parts []string
+	for _, n := range names {
+		if flags&n.flag != 0 {
+			parts = append(parts, "re."+n.name)
+		}
+	}
+
+	if len(parts) == 0 {
+		return "0"
+	}
+
+	return strings.Join(parts, "|")
+}
+
+// file searches the lines of the file. The file "-" is the standard input.
+func (g *grep) file(name string, stdin io.Reader) error {
+	r := stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		r = f
+	} else {
+		name = "(standard input)"
+	}
+
+	br := bufio.NewReader(r)
+	count := 0
+
+	for n := 1; ; n++ {
+		line, err := br.ReadString('\n')
+		if line == "" && err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return err
+		}
+
+		matched, err := g.line(name, n, strings.TrimSuffix(line, "\n"))
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+		if matched {
+			count++
+		}
+	}
+
+	if count > 0 {
+		g.matched = true
+	}
+
+	if g.opts.count {
+		g.write(name, 0, strconv.Itoa(count))
+	}
+
+	return nil
+}
+
+// line searches a single line and writes the output. It reports, whether the line matched.
+func (g *grep) line(name string, n int, s string) (bool, error) {
+	switch {
+	case g.opts.hasSub:
+		res, matched, err := g.substitute(s)
+		if err != nil {
+			return false, err
+		}
+
+		g.write(name, n, res)
+		return matched, nil
+	case g.opts.onlyMatching || g.opts.onlyGroup != "":
+		matched := false
+
+		err := regex.FindAll(g.re, g.re.BuildInput(s, len(s)), s, 0, 0, func(a []int) error {
+			matched = true
+
+			if start, end := a[2*g.group], a[2*g.group+1]; start >= 0 {
+				g.write(name, n, s[start:end])
+			}
+
+			return nil
+		})
+
+		return matched, err
+	default:
+		a, err := g.re.BuildInput(s, len(s)).Find(0, false, nil)
+		if err != nil {
+			return false, err
+		}
+
+		if a == nil {
+			return false, nil
+		}
+
+		if !g.opts.count {
+			g.write(name, n, s)
+		}
+
+		return true, nil
+	}
+}
+
+// substitute replaces all matches of the line with the template of `--sub`.
+func (g *grep) substitute(s string) (string, bool, error) {
+	var b strings.Builder
+
+	matched := false
+	beg := 0
+
+	err := regex.FindAll(g.re, g.re.BuildInput(s, len(s)), s, 0, 0, func(a []int) error {
+		matched = true
+
+		b.WriteString(s[beg:a[0]])
+		for _, t := range g.template {
+			if t.IsLiteral() {
+				b.WriteString(t.Literal)
+			} else if start, end := a[2*t.Group], a[2*t.Group+1]; start >= 0 {
+				b.WriteString(s[start:end])
+			}
+		}
+
+		beg = a[1]
+		return nil
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	b.WriteString(s[beg:])
+
+	return b.String(), matched, nil
+}
+
+// write writes a line of output, prefixed by the file name and the line number, if enabled.
+// If `n` is zero, the line number is omitted.
+func (g *grep) write(name string, n int, s string) {
+	if g.prefix {
+		g.w.WriteString(name)
+		g.w.WriteByte(':')
+	}
+	if g.opts.lineNumbers && n > 0 {
+		g.w.WriteString(strconv.Itoa(n))
+		g.w.WriteByte(':')
+	}
+
+	g.w.WriteString(s)
+	g.w.WriteByte('\n')
+}
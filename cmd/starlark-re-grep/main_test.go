@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGrep(t *testing.T) {
+	const input = "foo 2024-01-02\nbar\nbaz 1999-12-31 and 2000-01-01\n"
+
+	tests := []struct {
+		args   []string
+		input  string
+		output string
+		status int
+	}{
+		{[]string{`\d{4}`}, input, "foo 2024-01-02\nbaz 1999-12-31 and 2000-01-01\n", exitMatch},
+		{[]string{"-n", "ba"}, input, "2:bar\n3:baz 1999-12-31 and 2000-01-01\n", exitMatch},
+		{[]string{"-c", "ba"}, input, "2\n", exitMatch},
+		{[]string{"-c", "qux"}, input, "0\n", exitNoMatch},
+		{[]string{"qux"}, input, "", exitNoMatch},
+		{[]string{"-o", "-n", `\d{4}-\d\d`}, input, "1:2024-01\n3:1999-12\n3:2000-01\n", exitMatch},
+		{[]string{"--only-group", "y", `(?P<y>\d{4})-(\d\d)`}, input, "2024\n1999\n2000\n", exitMatch},
+		{[]string{"--only-group", "2", `(\d{4})-(\d\d)`}, input, "01\n12\n01\n", exitMatch},
+		{[]string{"--only-group", "1", `a(x)?`}, "ab\n", "", exitMatch},
+		{[]string{"--sub", `\g<d>.\2.\1`, `(\d{4})-(\d\d)-(?P<d>\d\d)`}, input, "foo 02.01.2024\nbar\nbaz 31.12.1999 and 01.01.2000\n", exitMatch},
+		{[]string{"--sub", "-", "x*"}, "abc\n", "-a-b-c-\n", exitMatch},
+		{[]string{"--sub", "", "x"}, "abc", "abc\n", exitNoMatch},
+		{[]string{"--flags", "i", "-o", "B."}, input, "ba\nba\n", exitMatch},
+		{[]string{"--flags", "a", "-o", `\w+`}, "äb\n", "b\n", exitMatch},
+		{[]string{"-o", `\w+`}, "äb\n", "äb\n", exitMatch},
+		{[]string{"--bytes", "-o", `[\x80-\xff]`}, "a\xffb\n", "\xff\n", exitMatch},
+		{[]string{"-o", `(?<=a)b|(\w)\1`}, "abxx\n", "b\nxx\n", exitMatch},
+		{[]string{"--engine", `(a)\1`}, "", "engine: backtrack\nflags: re.UNICODE\ngroups: 1\n", exitMatch},
+		{[]string{"--engine", "--bytes", "(?i)a"}, "", "engine: std\nflags: re.IGNORECASE\ngroups: 0\n", exitMatch},
+		{[]string{"--engine", "--fallback", "a"}, "", "engine: fallback\nflags: re.UNICODE|re.FALLBACK\ngroups: 0\n", exitMatch},
+		{[]string{"("}, input, "", exitError},
+		{[]string{"--flags", "q", "a"}, input, "", exitError},
+		{[]string{"--flags", "au", "a"}, input, "", exitError},
+		{[]string{"--only-group", "3", "(a)"}, input, "", exitError},
+		{[]string{"--only-group", "x", "(a)"}, input, "", exitError},
+		{[]string{"--sub", `\2`, "(a)"}, input, "", exitError},
+		{[]string{"-o", "-c", "a"}, input, "", exitError},
+		{[]string{}, input, "", exitError},
+	}
+
+	for _, test := range tests {
+		var stdout, stderr strings.Builder
+
+		status := run(test.args, strings.NewReader(test.input), &stdout, &stderr)
+		if status != test.status {
+			t.Errorf("%q: expected status %d, got %d (%s)", test.args, test.status, status, stderr.String())
+		}
+		if stdout.String() != test.output {
+			t.Errorf("%q: expected output %q, got %q", test.args, test.output, stdout.String())
+		}
+	}
+}
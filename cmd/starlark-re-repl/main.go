@@ -0,0 +1,359 @@
+// Command starlark-re-repl starts an interactive Starlark REPL with the "re" module preloaded.
+// Besides Starlark statements and expressions, the REPL understands commands to inspect patterns.
+// The arguments of the commands are the arguments of `re.compile`, like `r'\d+', re.I` or a compiled pattern:
+//
+//	:explain ARGS      describe the pattern in English
+//	:debug ARGS        show the DEBUG dump of the pattern
+//	:engine ARGS       show the regex engine selected for the pattern
+//	:bench FILE ARGS   time `findall` of the pattern in the contents of the file
+//	:help              show the commands
+//	:quit              exit the REPL
+//
+// Usage:
+//
+//	starlark-re-repl
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+
+	re "github.com/magnetde/starlark-re"
+	"github.com/magnetde/starlark-re/regex"
+)
+
+// benchDuration is the default minimum duration of the `:bench` command.
+const benchDuration = time.Second
+
+// help is the output of the `:help` command.
+const help = `commands:
+  :explain ARGS      describe the pattern in English
+  :debug ARGS        show the DEBUG dump of the pattern
+  :engine ARGS       show the regex engine selected for the pattern
+  :bench FILE ARGS   time findall of the pattern in the contents of the file
+  :help              show this help
+  :quit              exit the REPL
+ARGS are the arguments of re.compile, like r'\d+', re.I`
+
+// errQuit is returned by the `:quit` command.
+var errQuit = errors.New("quit")
+
+func main() {
+	r := newREPL(os.Stdin, os.Stdout, os.Stderr)
+	r.run()
+}
+
+// repl is a read-eval-print loop of Starlark statements and pattern commands.
+type repl struct {
+	opts    *syntax.FileOptions
+	thread  *starlark.Thread
+	globals starlark.StringDict
+	in      *bufio.Reader
+	out     io.Writer
+	errOut  io.Writer
+
+	benchDuration time.Duration // minimum duration of the `:bench` command
+}
+
+// newREPL creates a new REPL reading from `in`. Results are written to `out` and errors to `errOut`.
+func newREPL(in io.Reader, out, errOut io.Writer) *repl {
+	r := &repl{
+		opts: &syntax.FileOptions{
+			Set:               true,
+			While:             true,
+			TopLevelControl:   true,
+			GlobalReassign:    true,
+			LoadBindsGlobally: true,
+		},
+		globals: starlark.StringDict{"re": re.NewModule()},
+		in:      bufio.NewReader(in),
+		out:     out,
+		errOut:  errOut,
+
+		benchDuration: benchDuration,
+	}
+
+	r.thread = &starlark.Thread{
+		Name: "repl",
+		Print: func(_ *starlark.Thread, msg string) {
+			fmt.Fprintln(r.out, msg)
+		},
+	}
+
+	return r
+}
+
+// run reads and evaluates items until the end of the input or the `:quit` command.
+func (r *repl) run() {
+	for {
+		if err := r.rep(); err != nil {
+			if err != io.EOF && err != errQuit {
+				fmt.Fprintln(r.errOut, err)
+			}
+
+			return
+		}
+	}
+}
+
+// readLine prints the prompt and reads a line including the newline.
+func (r *repl) readLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+
+	line, err := r.in.ReadString('\n')
+	if line != "" && err == io.EOF {
+		return line + "\n", nil
+	}
+
+	return line, err
+}
+
+// rep reads, evaluates and prints a single item, which is either a command or a Starlark statement.
+// Only errors of the input and `errQuit` are returned; all other errors are printed.
+func (r *repl) rep() error {
+	first, err := r.readLine(">>> ")
+	if err != nil {
+		if err == io.EOF {
+			fmt.Fprintln(r.out)
+		}
+
+		return err
+	}
+
+	if cmd := strings.TrimSpace(first); strings.HasPrefix(cmd, ":") {
+		err := r.command(cmd[1:])
+		if err == errQuit {
+			return err
+		}
+		if err != nil {
+			r.printError(err)
+		}
+
+		return nil
+	}
+
+	pending := first
+	readline := func() ([]byte, error) {
+		if pending != "" {
+			line := pending
+			pending = ""
+
+			return []byte(line), nil
+		}
+
+		line, err := r.readLine("... ")
+		return []byte(line), err
+	}
+
+	f, err := r.opts.ParseCompoundStmt("<stdin>", readline)
+	if err != nil {
+		if err == io.EOF {
+			return err
+		}
+
+		r.printError(err)
+		return nil
+	}
+
+	if expr := soleExpr(f); expr != nil {
+		v, err := starlark.EvalExprOptions(f.Options, r.thread, expr, r.globals)
+		if err != nil {
+			r.printError(err)
+			return nil
+		}
+
+		r.globals["_"] = v
+		if v != starlark.None {
+			fmt.Fprintln(r.out, v)
+		}
+	} else if err := starlark.ExecREPLChunk(f, r.thread, r.globals); err != nil {
+		r.printError(err)
+	}
+
+	return nil
+}
+
+// soleExpr returns the expression, if the file consists of a single expression statement; nil otherwise.
+func soleExpr(f *syntax.File) syntax.Expr {
+	if len(f.Stmts) == 1 {
+		if stmt, ok := f.Stmts[0].(*syntax.ExprStmt); ok {
+			return stmt.X
+		}
+	}
+
+	return nil
+}
+
+// printError prints the error or its backtrace, if it is a Starlark evaluation error.
+func (r *repl) printError(err error) {
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		fmt.Fprintln(r.errOut, evalErr.Backtrace())
+	} else {
+		fmt.Fprintln(r.errOut, err)
+	}
+}
+
+// command executes a command without the leading colon.
+func (r *repl) command(cmd string) error {
+	name, args, _ := strings.Cut(cmd, " ")
+	args = strings.TrimSpace(args)
+
+	switch name {
+	case "help":
+		fmt.Fprintln(r.out, help)
+		return nil
+	case "quit", "q":
+		return errQuit
+	case "explain":
+		p, err := r.compile(args)
+		if err != nil {
+			return err
+		}
+
+		s, err := r.callMethod(p, "explain")
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(r.out, s.(starlark.String).GoString())
+		return nil
+	case "debug":
+		e, dump, err := r.compileEngine(args, regex.FlagDebug)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(r.out, strings.TrimSuffix(dump, "\n"))
+		fmt.Fprintf(r.out, "engine: %s\n", e.Program().Engine)
+		return nil
+	case "engine":
+		e, _, err := r.compileEngine(args, 0)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(r.out, "engine: %s\n", e.Program().Engine)
+		return nil
+	case "bench":
+		file, args, _ := strings.Cut(args, " ")
+		if file == "" {
+			return errors.New("usage: :bench FILE ARGS")
+		}
+
+		return r.bench(file, strings.TrimSpace(args))
+	}
+
+	return fmt.Errorf("unknown command %q; type :help for a list of commands", ":"+name)
+}
+
+// compile evaluates `re.compile(args)` and returns the compiled pattern.
+func (r *repl) compile(args string) (starlark.Value, error) {
+	if args == "" {
+		return nil, errors.New("missing pattern")
+	}
+
+	return starlark.EvalOptions(r.opts, r.thread, "<command>", "re.compile("+args+")", r.globals)
+}
+
+// compileEngine compiles the pattern of `re.compile(args)` with `regex.Compile`, like the "re" module does,
+// and returns the regex engine and the DEBUG dump, if the extra flags contain the DEBUG flag.
+func (r *repl) compileEngine(args string, extraFlags uint32) (regex.Engine, string, error) {
+	p, err := r.compile(args)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pattern, err := p.(starlark.HasAttrs).Attr("pattern")
+	if err != nil {
+		return nil, "", err
+	}
+
+	f, err := p.(starlark.HasAttrs).Attr("flags")
+	if err != nil {
+		return nil, "", err
+	}
+
+	flags, err := starlark.AsInt32(f)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var (
+		s     string
+		isStr bool
+	)
+	switch v := pattern.(type) {
+	case starlark.String:
+		s, isStr = string(v), true
+	case starlark.Bytes:
+		s = string(v)
+	}
+
+	return regex.Compile(s, isStr, uint32(flags)|extraFlags, true, nil)
+}
+
+// callMethod calls a method of the value without arguments.
+func (r *repl) callMethod(v starlark.Value, name string) (starlark.Value, error) {
+	m, err := v.(starlark.HasAttrs).Attr(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.Call(r.thread, m, nil, nil)
+}
+
+// bench repeatedly calls `findall` of the pattern with the contents of the file for at least `r.benchDuration`
+// and prints the number of matches and the average duration and throughput of a single call.
+func (r *repl) bench(file, args string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	p, err := r.compile(args)
+	if err != nil {
+		return err
+	}
+
+	text := starlark.Value(starlark.String(data))
+	if pattern, _ := p.(starlark.HasAttrs).Attr("pattern"); pattern != nil && pattern.Type() == "bytes" {
+		text = starlark.Bytes(data)
+	}
+
+	findall, err := p.(starlark.HasAttrs).Attr("findall")
+	if err != nil {
+		return err
+	}
+
+	var (
+		runs    int
+		matches int
+	)
+
+	start := time.Now()
+	for runs == 0 || time.Since(start) < r.benchDuration {
+		res, err := starlark.Call(r.thread, findall, starlark.Tuple{text}, nil)
+		if err != nil {
+			return err
+		}
+
+		matches = res.(*starlark.List).Len()
+		runs++
+	}
+	elapsed := time.Since(start)
+
+	perRun := elapsed / time.Duration(runs)
+	throughput := float64(len(data)) / elapsed.Seconds() * float64(runs) / 1e6
+
+	fmt.Fprintf(r.out, "%d matches in %d bytes; %d runs, %v per run, %.2f MB/s\n", matches, len(data), runs, perRun, throughput)
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestREPL(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "sample.txt")
+	if err := os.WriteFile(file, []byte("a1 b22 c333\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input  string
+		output string // output without prompts
+		errors string
+	}{
+		{"re.findall(r'\\d+', 'a1b22')\n", `["1", "22"]`, ""},
+		{"x = re.compile('a+')\nx.match('aab').group()\n_\n", "\"aa\"\n\"aa\"", ""},
+		{"for i in range(2):\n    print(i)\n\n", "0\n1", ""},
+		{"print('no newline')", "no newline", ""},
+		{":explain r'(?P<y>\\d{4})-', re.I\n", "[0:12]  group 1 'y':\n[6:11]    exactly 4 digits\n[12:13] then literal '-' (ignoring case)", ""},
+		{":debug r'a(?=b)'\n", "LITERAL 97\nASSERT 1\n  LITERAL 98\nengine: backtrack", ""},
+		{":engine r'(a)\\1'\n:engine re.compile('a', re.FALLBACK)\n:engine b'x'\n", "engine: backtrack\nengine: fallback\nengine: std", ""},
+		{":bench " + file + " r'\\d+'\n", `^3 matches in 12 bytes; \d+ runs, \S+ per run, [\d.]+ MB/s$`, ""},
+		{":bench " + file + " rb'[a-c]'\n", `^3 matches in 12 bytes; `, ""},
+		{":help\n", "commands:", ""},
+		{":quit\nprint('not reached')\n", "", ""},
+		{":foo\n", "", `unknown command ":foo"; type :help for a list of commands`},
+		{":explain\n", "", "missing pattern"},
+		{":bench\n", "", "usage: :bench FILE ARGS"},
+		{":explain '('\n", "", "missing ), unterminated subpattern at position 0"},
+		{"1 +\n", "", "got newline, want primary expression"},
+	}
+
+	prompts := regexp.MustCompile(`(>>>|\.\.\.) `)
+
+	for _, test := range tests {
+		var out, errOut strings.Builder
+
+		r := newREPL(strings.NewReader(test.input), &out, &errOut)
+		r.benchDuration = 0
+		r.run()
+
+		output := strings.TrimSpace(prompts.ReplaceAllString(out.String(), ""))
+
+		if strings.HasPrefix(test.output, "^") {
+			if !regexp.MustCompile(test.output).MatchString(output) {
+				t.Errorf("%q: output %q does not match %q", test.input, output, test.output)
+			}
+		} else if !strings.HasPrefix(output, test.output) || (test.output == "" && output != "") {
+			t.Errorf("%q: expected output %q, got %q", test.input, test.output, output)
+		}
+
+		if !strings.Contains(errOut.String(), test.errors) || (test.errors == "" && errOut.Len() > 0) {
+			t.Errorf("%q: expected errors %q, got %q", test.input, test.errors, errOut.String())
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package re
+
+import (
+	"go.starlark.net/starlark"
+
+	"github.com/magnetde/starlark-re/regex"
+)
+
+// patternToDot returns a Graphviz graph of the pattern in the DOT language (see `regex.Dot`).
+func patternToDot(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return patternDiagram(b, args, kwargs, regex.Dot)
+}
+
+// patternToSVG returns a railroad diagram of the pattern as an SVG image (see `regex.RailroadSVG`).
+func patternToSVG(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return patternDiagram(b, args, kwargs, regex.RailroadSVG)
+}
+
+// patternDiagram renders the pattern of the receiver with the render function.
+func patternDiagram(b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple,
+	render func(pattern string, isStr bool, flags uint32) (string, error),
+) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+
+	p := b.Receiver().(*Pattern)
+
+	s, err := render(p.pattern.value, p.pattern.isString, p.flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.String(s), nil
+}
@@ -0,0 +1,68 @@
+package re
+
+import (
+	"go.starlark.net/starlark"
+
+	"github.com/magnetde/starlark-re/regex"
+)
+
+// reCompileDialect converts a pattern of another regex dialect into Python syntax and compiles it
+// (see `regex.ImportPattern`). The dialect is one of "js" (the default), "pcre" and "re2".
+// ECMAScript and PCRE patterns may be regex literals with flags like `/\d+/gi`.
+// The `pattern` attribute of the compiled pattern contains the converted pattern.
+func reCompileDialect(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		pattern strOrBytes
+		dialect = regex.DialectECMAScript
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "pattern", &pattern, "dialect?", &dialect); err != nil {
+		return nil, err
+	}
+
+	return compileDialect(thread, b.Receiver().(*Module), pattern, dialect)
+}
+
+// compileDialect converts the pattern of the dialect and compiles it with the module.
+func compileDialect(thread *starlark.Thread, m *Module, pattern strOrBytes, dialect string) (*Pattern, error) {
+	s, flags, err := regex.ImportPattern(pattern.value, pattern.isString, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.compile(thread, strOrBytes{value: s, isString: pattern.isString}, flags)
+}
+
+// reConvertTemplate converts a replacement template of another regex dialect, like "$1-$<name>" in ECMAScript,
+// into a template of `re.sub` (see `regex.ImportTemplate`). The pattern is either a compiled pattern or a pattern
+// of the dialect, which is compiled with `compile_dialect`. It is needed to resolve the group references.
+func reConvertTemplate(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		pattern  patternParam
+		template strOrBytes
+		dialect  = regex.DialectECMAScript
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "pattern", &pattern, "template", &template, "dialect?", &dialect); err != nil {
+		return nil, err
+	}
+
+	p := pattern.compiled
+	if p == nil {
+		var err error
+
+		p, err = compileDialect(thread, b.Receiver().(*Module), pattern.raw, dialect)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := template.sameType(p.pattern); err != nil {
+		return nil, err
+	}
+
+	s, err := regex.ImportTemplate(p.re, template.value, template.isString, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return template.asType(s), nil
+}
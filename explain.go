@@ -0,0 +1,24 @@
+package re
+
+import (
+	"go.starlark.net/starlark"
+
+	"github.com/magnetde/starlark-re/regex"
+)
+
+// patternExplain returns a multi-line description of the pattern in English (see `regex.Explain`).
+// Each line describes a part of the pattern and starts with its span `[pos:end]` in the pattern.
+func patternExplain(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+
+	p := b.Receiver().(*Pattern)
+
+	s, err := regex.Explain(p.pattern.value, p.pattern.isString, p.flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.String(s), nil
+}
@@ -0,0 +1,147 @@
+package re
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/magnetde/starlark-re/regex"
+)
+
+// exportVersion is the version of the serialized pattern cache.
+// It must be incremented, whenever the serialized form or the preprocessor changes incompatibly.
+const exportVersion = 2
+
+// exportData is the serialized form of the pattern cache.
+// Besides the compiled patterns, it contains the module options, that affect compiling patterns.
+// The locale is stored as the fingerprint of its character table, because the names of locales are not unique.
+// Patterns can only be imported into modules with the same options.
+type exportData struct {
+	Version  int             `json:"version"`
+	Fallback bool            `json:"fallback"`
+	Locale   string          `json:"locale,omitempty"`
+	Engine   string          `json:"engine,omitempty"`
+	Patterns []exportPattern `json:"patterns"`
+}
+
+// exportPattern is the serialized form of a compiled pattern.
+// The pattern is stored as a byte slice, because the patterns may contain invalid UTF-8 codepoints.
+type exportPattern struct {
+	Pattern []byte         `json:"pattern"`
+	IsStr   bool           `json:"is_str"`
+	Flags   uint32         `json:"flags"`
+	Program *regex.Program `json:"program"`
+}
+
+// Export serializes all compiled patterns of the pattern cache, that were compiled with the options of the module.
+// For each pattern, the preprocessed regex pattern, the flags, the group names and the selected regex engine
+// are stored, so the patterns can be restored with `Import` without parsing and preprocessing them again.
+// The patterns are ordered from the least to the most recently used pattern.
+// An error is returned, if the pattern cache cannot be iterated (see `PatternCache`).
+func (m *Module) Export() ([]byte, error) {
+	data := exportData{
+		Version:  exportVersion,
+		Fallback: m.enableFallback,
+		Locale:   m.localeFingerprint(),
+		Engine:   m.engine,
+	}
+
+	if m.cache != nil {
+		c, ok := m.cache.(rangeCache)
+		if !ok {
+			return nil, errors.New("the pattern cache cannot be exported")
+		}
+
+		c.Range(func(key CacheKey, p *Pattern) {
+			if key.Fallback == m.enableFallback && key.Locale == m.locale && key.Engine == m.engine {
+				data.Patterns = append(data.Patterns, newExportPattern(key, p))
+			}
+		})
+	}
+
+	return json.Marshal(&data)
+}
+
+// newExportPattern creates the serialized form of a cached pattern.
+func newExportPattern(key CacheKey, p *Pattern) exportPattern {
+	e := exportPattern{
+		Pattern: []byte(key.Pattern),
+		IsStr:   key.IsStr,
+		Flags:   key.Flags,
+		Program: p.re.Program(),
+	}
+
+	return e
+}
+
+// Import restores the compiled patterns, that were serialized with `Export`, and adds them to the pattern cache.
+// Patterns, that already exist in the cache, are not replaced.
+// An error is returned, if the pattern cache is disabled, if the data is invalid or if the data was exported
+// by a module with different options.
+func (m *Module) Import(b []byte) error {
+	if m.cache == nil {
+		return errors.New("the pattern cache is disabled")
+	}
+
+	var data exportData
+	if err := json.Unmarshal(b, &data); err != nil {
+		return err
+	}
+
+	if data.Version != exportVersion {
+		return fmt.Errorf("unsupported version %d, want %d", data.Version, exportVersion)
+	}
+	if data.Fallback != m.enableFallback || data.Locale != m.localeFingerprint() || data.Engine != m.engine {
+		return errors.New("patterns were exported with incompatible module options")
+	}
+
+	// Restore all engines before modifying the cache.
+	patterns := make([]*Pattern, len(data.Patterns))
+
+	for i, ep := range data.Patterns {
+		if ep.Program == nil {
+			return errors.New("missing program")
+		}
+
+		ep.Program.Locale = m.locale
+
+		r, err := regex.Restore(ep.Program)
+		if err != nil {
+			return err
+		}
+
+		patterns[i] = &Pattern{
+			re: r,
+			pattern: strOrBytes{
+				value:    string(ep.Pattern),
+				isString: ep.IsStr,
+			},
+			flags:           r.Flags(),
+			fallbackEnabled: m.enableFallback,
+		}
+	}
+
+	for i, p := range patterns {
+		key := CacheKey{
+			Pattern:  p.pattern.value,
+			IsStr:    p.pattern.isString,
+			Flags:    data.Patterns[i].Flags,
+			Fallback: m.enableFallback,
+			Locale:   m.locale,
+			Engine:   m.engine,
+		}
+
+		m.cache.Put(key, p)
+	}
+
+	return nil
+}
+
+// localeFingerprint returns the fingerprint of the locale of the module or an empty string, if no locale is set.
+func (m *Module) localeFingerprint() string {
+	if m.locale == nil {
+		return ""
+	}
+
+	return m.locale.Fingerprint()
+}
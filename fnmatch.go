@@ -0,0 +1,509 @@
+package re
+
+import (
+	"errors"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// fnmatchMembers contains all members of the "fnmatch" module.
+// The builtins are bound to the "re" module, when the module is created (see `Module.FnmatchModule`).
+var fnmatchMembers = starlark.StringDict{
+	"fnmatch":        starlark.NewBuiltin("fnmatch", fnmatchFnmatch),
+	"fnmatchcase":    starlark.NewBuiltin("fnmatchcase", fnmatchFnmatch),
+	"filter":         starlark.NewBuiltin("filter", fnmatchFilter),
+	"translate":      starlark.NewBuiltin("translate", fnmatchTranslate),
+	"globmatch":      starlark.NewBuiltin("globmatch", fnmatchGlobmatch),
+	"glob_filter":    starlark.NewBuiltin("glob_filter", fnmatchGlobFilter),
+	"glob_translate": starlark.NewBuiltin("glob_translate", fnmatchGlobTranslate),
+}
+
+// FnmatchModule returns the companion module "fnmatch", which matches names against Unix shell-style wildcards
+// like Python's fnmatch module. Additionally, it matches paths against glob patterns with the recursive
+// wildcard `**`, like Python's `glob.translate()`. Wildcard patterns are translated into regex patterns,
+// which are compiled by this module, so they share the pattern cache and the options of the module.
+// Like on POSIX systems in Python, names are not normalized, so `fnmatch` and `fnmatchcase` are equal.
+func (m *Module) FnmatchModule() *starlarkstruct.Module {
+	members := make(starlark.StringDict, len(fnmatchMembers))
+	for k, v := range fnmatchMembers {
+		members[k] = v.(*starlark.Builtin).BindReceiver(m)
+	}
+
+	return &starlarkstruct.Module{
+		Name:    "fnmatch",
+		Members: members,
+	}
+}
+
+// fnmatchFnmatch tests, whether the name matches the wildcard pattern.
+func fnmatchFnmatch(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name, pat strOrBytes
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "pat", &pat); err != nil {
+		return nil, err
+	}
+
+	p, err := compileWildcard(thread, b, pat, translateWildcard)
+	if err != nil {
+		return nil, err
+	}
+
+	return matchWildcard(thread, p, name)
+}
+
+// fnmatchFilter returns the list of names, that match the wildcard pattern.
+func fnmatchFilter(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		names starlark.Iterable
+		pat   strOrBytes
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "names", &names, "pat", &pat); err != nil {
+		return nil, err
+	}
+
+	p, err := compileWildcard(thread, b, pat, translateWildcard)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterWildcard(thread, p, names)
+}
+
+// fnmatchTranslate returns the regex pattern of the wildcard pattern.
+func fnmatchTranslate(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var pat strOrBytes
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "pat", &pat); err != nil {
+		return nil, err
+	}
+
+	return pat.asType(translateWildcard(pat)), nil
+}
+
+// globOptions represents the optional parameters of the glob functions.
+type globOptions struct {
+	includeHidden bool   // wildcards match segments starting with a dot
+	seps          string // path separators
+}
+
+// unpackGlobArgs unpacks the arguments of a glob function. The first parameter is named `first`
+// and stored in `v`, the second parameter is the glob pattern.
+func unpackGlobArgs(b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple, first string, v any) (strOrBytes, globOptions, error) {
+	var (
+		pattern strOrBytes
+		opts    = globOptions{seps: "/"}
+	)
+
+	var pairs []any
+	if first != "" {
+		pairs = append(pairs, first, v)
+	}
+	pairs = append(pairs, "pattern", &pattern, "include_hidden?", &opts.includeHidden, "seps?", &opts.seps)
+
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, pairs...); err != nil {
+		return strOrBytes{}, globOptions{}, err
+	}
+	if opts.seps == "" {
+		return strOrBytes{}, globOptions{}, errors.New("seps must not be empty")
+	}
+
+	return pattern, opts, nil
+}
+
+// fnmatchGlobmatch tests, whether the path matches the glob pattern.
+func fnmatchGlobmatch(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var path strOrBytes
+
+	pattern, opts, err := unpackGlobArgs(b, args, kwargs, "path", &path)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := compileWildcard(thread, b, pattern, opts.translate)
+	if err != nil {
+		return nil, err
+	}
+
+	return matchWildcard(thread, p, path)
+}
+
+// fnmatchGlobFilter returns the list of paths, that match the glob pattern.
+func fnmatchGlobFilter(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var paths starlark.Iterable
+
+	pattern, opts, err := unpackGlobArgs(b, args, kwargs, "paths", &paths)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := compileWildcard(thread, b, pattern, opts.translate)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterWildcard(thread, p, paths)
+}
+
+// fnmatchGlobTranslate returns the regex pattern of the glob pattern.
+func fnmatchGlobTranslate(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	pattern, opts, err := unpackGlobArgs(b, args, kwargs, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return pattern.asType(opts.translate(pattern)), nil
+}
+
+// compileWildcard translates the wildcard pattern with `translate` and compiles the result with the "re" module,
+// which is the receiver of the builtin.
+func compileWildcard(thread *starlark.Thread, b *starlark.Builtin, pat strOrBytes, translate func(pat strOrBytes) string) (*Pattern, error) {
+	pattern := strOrBytes{
+		value:    translate(pat),
+		isString: pat.isString,
+	}
+
+	return b.Receiver().(*Module).compile(thread, pattern, 0)
+}
+
+// matchWildcard tests, whether the compiled wildcard pattern matches the name.
+// Translated patterns end with `\Z`, so a match at the beginning of the name matches the whole name.
+func matchWildcard(thread *starlark.Thread, p *Pattern, name strOrBytes) (starlark.Value, error) {
+	if err := name.sameType(p.pattern); err != nil {
+		return nil, err
+	}
+
+	match, err := findMatch(thread, p.re, name.value, 0, len(name.value), false)
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.Bool(match != nil && match[0] == 0), nil
+}
+
+// filterWildcard returns the list of names, that match the compiled wildcard pattern.
+func filterWildcard(thread *starlark.Thread, p *Pattern, names starlark.Iterable) (starlark.Value, error) {
+	iter := names.Iterate()
+	defer iter.Done()
+
+	var res []starlark.Value
+
+	var v starlark.Value
+	for iter.Next(&v) {
+		var name strOrBytes
+		if err := name.Unpack(v); err != nil {
+			return nil, err
+		}
+
+		ok, err := matchWildcard(thread, p, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok == starlark.True {
+			res = append(res, v)
+		}
+	}
+
+	return starlark.NewList(res), nil
+}
+
+// wildcardPart is a part of a translated wildcard pattern.
+// Stars are kept separately, because consecutive stars are merged and stars are joined with the following parts.
+type wildcardPart struct {
+	text string
+	star bool
+}
+
+// translateWildcard translates a wildcard pattern into a regex pattern like `fnmatch.translate()` in Python:
+// `*` matches everything, `?` matches any single character and `[seq]` or `[!seq]` match any character
+// (not) in `seq`. To prevent exponential backtracking, stars followed by text become atomic groups.
+func translateWildcard(pat strOrBytes) string {
+	parts := wildcardParts(wildcardChars(pat), "", ".")
+
+	var b strings.Builder
+
+	i := 0
+	for ; i < len(parts) && !parts[i].star; i++ {
+		b.WriteString(parts[i].text)
+	}
+
+	for i < len(parts) {
+		i++ // skip the star
+		if i == len(parts) {
+			b.WriteString(".*")
+			break
+		}
+
+		var fixed strings.Builder
+		for ; i < len(parts) && !parts[i].star; i++ {
+			fixed.WriteString(parts[i].text)
+		}
+
+		if i == len(parts) {
+			b.WriteString(".*")
+			b.WriteString(fixed.String())
+		} else {
+			b.WriteString("(?>.*?")
+			b.WriteString(fixed.String())
+			b.WriteString(")")
+		}
+	}
+
+	return wildcardPattern(pat, b.String())
+}
+
+// translate translates a glob pattern into a regex pattern like `glob.translate()` with `recursive=True` in Python.
+// The glob pattern is split into segments at path separators. A segment `*` matches exactly one segment
+// and `**` matches any number of segments. Otherwise, wildcards only match characters of a single segment.
+// Unless hidden segments are included, wildcards do not match segments starting with a dot.
+func (o globOptions) translate(pat strOrBytes) string {
+	seps := []rune(o.seps)
+
+	var escaped strings.Builder
+	for _, c := range seps {
+		escaped.WriteString(escapePattern(string(c)))
+	}
+
+	anySep := escaped.String()
+	if len(seps) > 1 {
+		anySep = "[" + anySep + "]"
+	}
+	notSep := "[^" + escaped.String() + "]"
+
+	var oneLastSegment, anySegments, anyLastSegments string
+	if o.includeHidden {
+		oneLastSegment = notSep + "+"
+		anySegments = "(?:.+" + anySep + ")?"
+		anyLastSegments = ".*"
+	} else {
+		oneLastSegment = "[^" + escaped.String() + ".]" + notSep + "*"
+		anySegments = "(?:" + oneLastSegment + anySep + ")*"
+		anyLastSegments = anySegments + "(?:" + oneLastSegment + ")?"
+	}
+	oneSegment := oneLastSegment + anySep
+
+	// split the pattern into segments
+	var segments [][]rune
+
+	start := 0
+	chars := wildcardChars(pat)
+	for i, c := range chars {
+		if containsRune(seps, c) {
+			segments = append(segments, chars[start:i])
+			start = i + 1
+		}
+	}
+	segments = append(segments, chars[start:])
+
+	var b strings.Builder
+
+	last := len(segments) - 1
+	for i, segment := range segments {
+		switch {
+		case string(segment) == "*":
+			if i < last {
+				b.WriteString(oneSegment)
+			} else {
+				b.WriteString(oneLastSegment)
+			}
+		case string(segment) == "**":
+			if i == last {
+				b.WriteString(anyLastSegments)
+			} else if string(segments[i+1]) != "**" {
+				b.WriteString(anySegments)
+			}
+		default:
+			if len(segment) > 0 {
+				if !o.includeHidden && (segment[0] == '*' || segment[0] == '?') {
+					b.WriteString(`(?!\.)`)
+				}
+
+				for _, p := range wildcardParts(segment, notSep+"*", notSep) {
+					b.WriteString(p.text)
+				}
+			}
+
+			if i < last {
+				b.WriteString(anySep)
+			}
+		}
+	}
+
+	return wildcardPattern(pat, b.String())
+}
+
+// wildcardParts translates the characters of a wildcard pattern into parts of a regex pattern.
+// Stars are translated into `star` and question marks into `questionMark`.
+// Consecutive stars are merged into a single star part.
+func wildcardParts(pat []rune, star, questionMark string) []wildcardPart {
+	var res []wildcardPart
+
+	n := len(pat)
+	for i := 0; i < n; {
+		c := pat[i]
+		i++
+
+		switch c {
+		case '*':
+			if len(res) == 0 || !res[len(res)-1].star {
+				res = append(res, wildcardPart{text: star, star: true})
+			}
+		case '?':
+			res = append(res, wildcardPart{text: questionMark})
+		case '[':
+			j := i
+			if j < n && pat[j] == '!' {
+				j++
+			}
+			if j < n && pat[j] == ']' {
+				j++
+			}
+			for j < n && pat[j] != ']' {
+				j++
+			}
+
+			if j >= n {
+				res = append(res, wildcardPart{text: `\[`})
+				continue
+			}
+
+			res = append(res, wildcardPart{text: wildcardSet(pat[i:j])})
+			i = j + 1
+		default:
+			res = append(res, wildcardPart{text: escapePattern(string(c))})
+		}
+	}
+
+	return res
+}
+
+// wildcardSet translates the content of a wildcard set `[...]` into a regex set.
+func wildcardSet(set []rune) string {
+	var stuff string
+
+	if !containsRune(set, '-') {
+		stuff = strings.ReplaceAll(string(set), `\`, `\\`)
+	} else {
+		// split the set into chunks at hyphens, that create ranges
+		var chunks [][]rune
+
+		i := 0
+		k := 1
+		if set[0] == '!' {
+			k = 2
+		}
+
+		for {
+			h := -1
+			for ; k < len(set); k++ {
+				if set[k] == '-' {
+					h = k
+					break
+				}
+			}
+			if h < 0 {
+				break
+			}
+
+			chunks = append(chunks, set[i:h])
+			i = h + 1
+			k = h + 3
+		}
+
+		if chunk := set[i:]; len(chunk) > 0 {
+			chunks = append(chunks, chunk)
+		} else {
+			// the last hyphen is a literal; the chunk is copied, because it shares the array with the set
+			last := chunks[len(chunks)-1]
+			chunks[len(chunks)-1] = append(last[:len(last):len(last)], '-')
+		}
+
+		// remove empty ranges, because they are invalid in regex patterns
+		for k := len(chunks) - 1; k > 0; k-- {
+			prev, cur := chunks[k-1], chunks[k]
+			if prev[len(prev)-1] > cur[0] {
+				merged := make([]rune, 0, len(prev)+len(cur)-2)
+				merged = append(merged, prev[:len(prev)-1]...)
+				merged = append(merged, cur[1:]...)
+
+				chunks[k-1] = merged
+				chunks = append(chunks[:k], chunks[k+1:]...)
+			}
+		}
+
+		// escape backslashes and hyphens, that do not create ranges
+		escaped := make([]string, len(chunks))
+		for k, chunk := range chunks {
+			s := strings.ReplaceAll(string(chunk), `\`, `\\`)
+			escaped[k] = strings.ReplaceAll(s, "-", `\-`)
+		}
+
+		stuff = strings.Join(escaped, "-")
+	}
+
+	// escape characters of set operations
+	var b strings.Builder
+	for _, c := range stuff {
+		if c == '&' || c == '~' || c == '|' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	stuff = b.String()
+
+	switch {
+	case stuff == "":
+		return "(?!)" // empty set never matches
+	case stuff == "!":
+		return "." // negated empty set matches any character
+	case stuff[0] == '!':
+		return "[^" + stuff[1:] + "]"
+	case stuff[0] == '^' || stuff[0] == '[':
+		return `[\` + stuff + "]"
+	default:
+		return "[" + stuff + "]"
+	}
+}
+
+// wildcardChars returns the characters of a wildcard pattern.
+// The bytes of bytes patterns are returned as Latin-1 characters.
+func wildcardChars(pat strOrBytes) []rune {
+	if pat.isString {
+		return []rune(pat.value)
+	}
+
+	chars := make([]rune, len(pat.value))
+	for i := 0; i < len(pat.value); i++ {
+		chars[i] = rune(pat.value[i])
+	}
+
+	return chars
+}
+
+// wildcardPattern returns the final regex pattern of the translated regex pattern `s`,
+// which matches the whole string. If the wildcard pattern is a bytes pattern,
+// Latin-1 characters are converted back into bytes.
+func wildcardPattern(pat strOrBytes, s string) string {
+	s = `(?s:` + s + `)\Z`
+	if pat.isString {
+		return s
+	}
+
+	b := make([]byte, 0, len(s))
+	for _, c := range s {
+		b = append(b, byte(c))
+	}
+
+	return string(b)
+}
+
+// containsRune reports, whether the rune slice contains `c`.
+func containsRune(s []rune, c rune) bool {
+	for _, r := range s {
+		if r == c {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,84 @@
+package re
+
+import (
+	"errors"
+
+	"go.starlark.net/starlark"
+
+	"github.com/magnetde/starlark-re/regex"
+)
+
+// generateAttempts is the number of generated strings per requested sample, before the generation is given up.
+// Generated strings are discarded, if they are duplicates or if the check against the compiled pattern fails.
+const generateAttempts = 20
+
+// reGenerate returns up to `n` distinct example strings, that are matched by the pattern (see `regex.Generator`).
+// If `near_miss` is true, strings similar to matching strings are returned, that are not matched by the pattern.
+// Each string is checked against the compiled pattern like `Pattern.fullmatch`. Repeats are limited to
+// `max_repeat` repetitions, unless their minimum is larger. The result is deterministic for a given seed.
+// Failed attempts, like group references to groups of branches, that were not taken, are retried.
+func reGenerate(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		pattern   patternParam
+		n         = 5
+		seed      int64
+		maxRepeat = 5
+		nearMiss  bool
+		flags     uint32
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "pattern", &pattern, "n?", &n, "seed?", &seed,
+		"max_repeat?", &maxRepeat, "near_miss?", &nearMiss, "flags?", &flags); err != nil {
+		return nil, err
+	}
+
+	if n < 0 {
+		return nil, errors.New("n must not be negative")
+	}
+	if maxRepeat < 0 {
+		return nil, errors.New("max_repeat must not be negative")
+	}
+
+	p, err := regexCompile(thread, b, pattern, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := regex.NewGenerator(p.pattern.value, p.pattern.isString, p.flags, seed, maxRepeat)
+	if err != nil {
+		return nil, err
+	}
+
+	generate := g.Match
+	if nearMiss {
+		generate = g.NearMiss
+	}
+
+	var res []starlark.Value
+	seen := make(map[string]bool, n)
+
+	if !g.CanMatch() {
+		return starlark.NewList(res), nil
+	}
+
+	for i := 0; i < n*generateAttempts && len(res) < n; i++ {
+		s, ok := generate()
+		if !ok {
+			continue // e.g. a group reference to an unmatched group
+		}
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+
+		match, err := findMatch(thread, p.re, s, 0, len(s), true /* find longest */)
+		if err != nil {
+			return nil, err
+		}
+
+		if matched := match != nil && match[0] == 0 && match[1] == len(s); matched != nearMiss {
+			res = append(res, p.pattern.asType(s))
+		}
+	}
+
+	return starlark.NewList(res), nil
+}
@@ -0,0 +1,51 @@
+package re
+
+import (
+	"errors"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+
+	"github.com/magnetde/starlark-re/regex"
+)
+
+// reLint reports possible pitfalls of a regex pattern, like nested unbounded repeats, which may cause catastrophic
+// backtracking, redundant groups, unreachable branches or duplicate items of character classes (see `regex.Lint`).
+// The result is a list of structs with the fields `kind`, `message`, `pos` and `end`, ordered by position.
+// If the pattern is a compiled pattern, its flags are used and the `flags` argument must be zero.
+func reLint(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		pattern patternParam
+		flags   uint32
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "pattern", &pattern, "flags?", &flags); err != nil {
+		return nil, err
+	}
+
+	raw := pattern.raw
+	if pattern.compiled != nil {
+		if flags != 0 {
+			return nil, errors.New("cannot process flags argument with a compiled pattern")
+		}
+
+		raw = pattern.compiled.pattern
+		flags = pattern.compiled.flags
+	}
+
+	findings, err := regex.Lint(raw.value, raw.isString, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]starlark.Value, len(findings))
+	for i, f := range findings {
+		res[i] = starlarkstruct.FromStringDict(starlark.String("LintFinding"), starlark.StringDict{
+			"kind":    starlark.String(f.Kind),
+			"message": starlark.String(f.Message),
+			"pos":     starlark.MakeInt(f.Pos),
+			"end":     starlark.MakeInt(f.End),
+		})
+	}
+
+	return starlark.NewList(res), nil
+}
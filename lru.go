@@ -0,0 +1,186 @@
+package re
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/magnetde/starlark-re/regex"
+)
+
+// LRUCache is a pattern cache, that removes the least recently used patterns, when the cache exceeds
+// its capacity. The capacity is either bounded by the number of patterns (see `NewLRUCache`) or by the
+// estimated memory cost of the patterns (see `NewCostLRUCache`).
+// This cache is implemented using a map and a linked list and is safe for concurrent use.
+type LRUCache struct {
+	mu    sync.Mutex                 // mutex for the cache
+	list  *list.List                 // least recent used regexes
+	cache map[CacheKey]*list.Element // mapping of patterns to list elements
+
+	byCost   bool // capacity is bounded by cost instead of the number of patterns
+	maxCost  int  // maximum cost of all patterns in the cache
+	currCost int  // current cost of all patterns in the cache
+
+	hits      int // number of patterns found in the cache
+	misses    int // number of patterns not found in the cache
+	evictions int // number of patterns removed from the cache because it exceeded its capacity
+}
+
+// The lruValue type represents elements in the linked list of the cache.
+// This type is necessary because each list element must store the key within the linked list.
+// When the last element is removed from the linked list, it is also be deleted from the map using the key.
+type lruValue struct {
+	pattern *Pattern
+	key     CacheKey
+	cost    int
+}
+
+// NewLRUCache creates an LRU cache, that contains at most `maxSize` compiled patterns.
+// If the maximum size is not a positive integer, the default maximum size of 64 is used.
+func NewLRUCache(maxSize int) *LRUCache {
+	if maxSize <= 0 {
+		maxSize = defaultMaxCacheSize
+	}
+
+	return newLRUCache(maxSize, false)
+}
+
+// NewCostLRUCache creates an LRU cache, whose capacity is bounded by the estimated memory cost
+// of the compiled patterns in bytes (see `EstimateCost`).
+// Patterns, whose cost exceeds `maxCost`, are never cached.
+func NewCostLRUCache(maxCost int) *LRUCache {
+	return newLRUCache(maxCost, true)
+}
+
+// newLRUCache creates an empty LRU cache.
+func newLRUCache(maxCost int, byCost bool) *LRUCache {
+	c := LRUCache{
+		list:    list.New(),
+		cache:   make(map[CacheKey]*list.Element),
+		byCost:  byCost,
+		maxCost: maxCost,
+	}
+
+	return &c
+}
+
+// EstimateCost returns the estimated memory cost of a compiled pattern in bytes.
+// The cost is based on the length of the pattern, the length of the preprocessed pattern,
+// the size of the compiled program and the number of groups (see `regex.Cost`).
+func EstimateCost(p *Pattern) int {
+	return len(p.pattern.value) + regex.Cost(p.re)
+}
+
+// Get returns the compiled pattern of the key, if the cache contains the key.
+func (c *LRUCache) Get(key CacheKey) (*Pattern, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.cache[key]; ok {
+		c.list.MoveToFront(e) // "refresh" the pattern in the linked list
+		c.hits++
+		return e.Value.(*lruValue).pattern, true
+	}
+
+	c.misses++
+	return nil, false
+}
+
+// Put adds a compiled pattern to the cache, if the cache does not already contain the key.
+// When the cache exceeds its capacity, the least recently used patterns are removed.
+func (c *LRUCache) Put(key CacheKey, p *Pattern) {
+	cost := 1
+	if c.byCost {
+		cost = EstimateCost(p) // estimate the cost outside of the lock
+	}
+
+	if cost > c.maxCost {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.cache[key]; ok {
+		return
+	}
+
+	// purge elements, if the cost exceeds the capacity
+	for c.currCost+cost > c.maxCost {
+		last := c.list.Back() // determine the oldest element
+		lastValue := last.Value.(*lruValue)
+
+		// Delete from map and list
+		delete(c.cache, lastValue.key)
+		c.list.Remove(last)
+		c.currCost -= lastValue.cost
+		c.evictions++
+	}
+
+	// Add the compiled pattern to the cache.
+	v := &lruValue{
+		pattern: p,
+		key:     key,
+		cost:    cost,
+	}
+
+	c.cache[key] = c.list.PushFront(v)
+	c.currCost += cost
+}
+
+// Purge clears the cache and its statistics.
+func (c *LRUCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.list.Init()
+
+	// clear(c.cache)
+	for k := range c.cache {
+		delete(c.cache, k)
+	}
+
+	c.currCost = 0
+	c.hits = 0
+	c.misses = 0
+	c.evictions = 0
+}
+
+// Stats returns statistics about the cache.
+func (c *LRUCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := CacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Size:      c.list.Len(),
+		Engines:   make(map[string]int),
+	}
+
+	if c.byCost {
+		stats.Cost = c.currCost
+		stats.MaxCost = c.maxCost
+	} else {
+		stats.MaxSize = c.maxCost
+	}
+
+	for e := c.list.Front(); e != nil; e = e.Next() {
+		p := e.Value.(*lruValue).pattern
+		stats.Engines[p.re.Program().Engine]++
+	}
+
+	return stats
+}
+
+// Range calls `fn` for each cached pattern, ordered from the least to the most recently used pattern.
+// The function `fn` must not access the cache.
+func (c *LRUCache) Range(fn func(key CacheKey, p *Pattern)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for e := c.list.Back(); e != nil; e = e.Prev() {
+		v := e.Value.(*lruValue)
+		fn(v.key, v.pattern)
+	}
+}
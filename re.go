@@ -1,7 +1,6 @@
 package re
 
 import (
-	"container/list"
 	"errors"
 	"fmt"
 	"maps"
@@ -10,7 +9,6 @@ import (
 	"slices"
 	"strconv"
 	"strings"
-	"sync"
 
 	"go.starlark.net/starlark"
 	"go.starlark.net/syntax"
@@ -53,8 +51,11 @@ var (
 		"VERBOSE":    makeFlags(regex.FlagVerbose),
 		"FALLBACK":   makeFlags(regex.FlagFallback),
 
-		"compile": starlark.NewBuiltin("compile", reCompile),
-		"purge":   starlark.NewBuiltin("purge", rePurge),
+		"compile":          starlark.NewBuiltin("compile", reCompile),
+		"compile_template": starlark.NewBuiltin("compile_template", reCompileTemplate),
+		"compile_words":    starlark.NewBuiltin("compile_words", reCompileWords),
+		"purge":            starlark.NewBuiltin("purge", rePurge),
+		"cache_info":       starlark.NewBuiltin("cache_info", reCacheInfo),
 
 		"search":    starlark.NewBuiltin("search", reSearch),
 		"match":     starlark.NewBuiltin("match", reMatch),
@@ -65,6 +66,11 @@ var (
 		"sub":       starlark.NewBuiltin("sub", reSub),
 		"subn":      starlark.NewBuiltin("subn", reSub),
 		"escape":    starlark.NewBuiltin("escape", reEscape),
+		"lint":      starlark.NewBuiltin("lint", reLint),
+		"generate":  starlark.NewBuiltin("generate", reGenerate),
+
+		"compile_dialect":  starlark.NewBuiltin("compile_dialect", reCompileDialect),
+		"convert_template": starlark.NewBuiltin("convert_template", reConvertTemplate),
 	}
 )
 
@@ -74,48 +80,40 @@ func makeFlags(flag uint32) starlark.Int {
 }
 
 // ModuleOptions represents the available options when initializing the "re" module.
-// There are three options:
+// There are six options:
 //   - `DisableCache` disables to store compiled patterns in a pattern cache, resulting in higher runtimes.
 //   - `MaxCacheSize` sets the maximum size of the cache.
-//   - `DisableFallback` disables the fallback engine `regexp2.Regexp`.
+//   - `DisableFallback` disables the backtracking engine and the fallback engine `regexp2.Regexp`, so only `regexp.Regexp` is used.
 //     Compiling patterns that are not supported by `regexp.Regexp' will then fail.
+//   - `Locale` sets the character table, that is used for bytes patterns with the LOCALE flag
+//     (for example `regex.LocaleLatin1()`). If the locale is nil, the LOCALE flag has no effect.
+//   - `Cache` sets a custom pattern cache, for example a cache bounded by memory cost (see `NewCostLRUCache`)
+//     or a cache, that is shared with other modules (see `NewSharedCache`).
+//     If a cache is set, the options `DisableCache` and `MaxCacheSize` are ignored.
+//   - `Engine` sets the name of a registered regex engine, that compiles all patterns without the FALLBACK flag,
+//     instead of selecting the engine by the capabilities required by the pattern (for example `regex.EngineBacktrack`).
+//     Compiling patterns that are not supported by the engine will then fail.
 type ModuleOptions struct {
 	DisableCache    bool
 	MaxCacheSize    int
 	DisableFallback bool
+	Locale          *regex.Locale
+	Cache           PatternCache
+	Engine          string
 }
 
 // Module is a module type used for the "re" module.
-// the "re" module contains an LRU cache for compiled regex patterns.
-// This cache is implemented using a map and a linked list.
-// When the cache exceeds the maximum size, the least recently used element is removed.
+// the "re" module contains a cache for compiled regex patterns (see `PatternCache`).
+// By default, this is an LRU cache, that removes the least recently used pattern,
+// when the cache exceeds the maximum size (see `LRUCache`).
 // The module is designed to be thread-safe.
 type Module struct {
 	members starlark.StringDict
 
-	enableCache    bool // cache for compiled patterns is enabled
-	maxCacheSize   int  // maximum size of compiled patterns in the cache
-	enableFallback bool // regexp2 fallback engine is enabled
-
-	mu    sync.Mutex                 // mutex for the regex cache
-	list  *list.List                 // least recent used regexes
-	cache map[cacheKey]*list.Element // mapping of patterns to list elements
-}
-
-// cacheKey is the type, that is used for keys of the cache map, containing the pattern,
-// its type and the flags.
-type cacheKey struct {
-	pattern string
-	isStr   bool
-	flags   uint32
-}
-
-// The cacheValue type represents elements in the linked list of the cache.
-// This type is necessary because each list element must store the key within the linked list.
-// When the last element is removed from the linked list, it is also be deleted from the map using the key.
-type cacheValue struct {
-	pattern *Pattern
-	key     cacheKey
+	cache          PatternCache  // cache for compiled patterns; nil if the cache is disabled
+	enableFallback bool          // backtracking and regexp2 fallback engines are enabled
+	locale         *regex.Locale // locale for bytes patterns with the LOCALE flag; may be nil
+	engine         string        // name of the regex engine, that compiles all patterns; empty if selected by capabilities
 }
 
 // NewModule creates the Starlark "re" module with the default options returned by `DefaultOptions`.
@@ -127,6 +125,7 @@ func NewModule() *Module {
 //   - pattern cache is enabled
 //   - a maximum cache size of 64
 //   - the fallback regex engine is enabled
+//   - no locale is set
 func DefaultOptions() *ModuleOptions {
 	options := ModuleOptions{
 		DisableCache:    false,
@@ -145,15 +144,13 @@ func NewModuleOptions(opts *ModuleOptions) *Module {
 		opts = DefaultOptions()
 	}
 
-	enableCache := !opts.DisableCache
-	maxCacheSize := opts.MaxCacheSize
-	enableFallback := !opts.DisableFallback
-	if maxCacheSize < 0 {
-		enableCache = false // disable cache
-	} else if maxCacheSize == 0 {
-		maxCacheSize = defaultMaxCacheSize
+	cache := opts.Cache
+	if cache == nil && !opts.DisableCache && opts.MaxCacheSize >= 0 {
+		cache = NewLRUCache(opts.MaxCacheSize)
 	}
 
+	enableFallback := !opts.DisableFallback
+
 	// By default each "re" module instance shares the same map,
 	// because `members` is never modified.
 	modMembers := members
@@ -166,14 +163,10 @@ func NewModuleOptions(opts *ModuleOptions) *Module {
 
 	r := Module{
 		members:        modMembers,
-		enableCache:    enableCache,
-		maxCacheSize:   maxCacheSize,
+		cache:          cache,
 		enableFallback: enableFallback,
-	}
-
-	if enableCache {
-		r.list = list.New()
-		r.cache = make(map[cacheKey]*list.Element)
+		locale:         opts.Locale,
+		engine:         opts.Engine,
 	}
 
 	return &r
@@ -235,77 +228,50 @@ func (m *Module) Members() starlark.StringDict {
 	return members
 }
 
-// Purge clears the regex cache.
+// Purge clears the regex cache and its statistics.
+// If the cache is shared with other modules, the cache is cleared for all modules.
 func (m *Module) Purge() {
-	if m.enableCache {
-		m.mu.Lock()
-		defer m.mu.Unlock()
-
-		m.list.Init()
-
-		// clear(m.cache)
-		for k := range m.cache {
-			delete(m.cache, k)
-		}
+	if m.cache != nil {
+		m.cache.Purge()
 	}
 }
 
 // compile compiles a regex pattern.
 // If the pattern cache is disabled, the regex pattern is compiled as normal.
-// Otherwise, the pattern is compiled by using the cache (see `cachedCompile`).
+// Otherwise, the pattern is compiled by using the cache.
+// Patterns with the DEBUG flag are never cached, because the debug output must be printed on each call.
 func (m *Module) compile(thread *starlark.Thread, pattern strOrBytes, flags uint32) (*Pattern, error) {
-	if !m.enableCache {
-		p, _, err := newPattern(thread, pattern, flags, m.enableFallback)
-		return p, err
+	key := CacheKey{
+		Pattern:  pattern.value,
+		IsStr:    pattern.isString,
+		Flags:    flags,
+		Fallback: m.enableFallback,
+		Locale:   m.locale,
+		Engine:   m.engine,
 	}
 
-	return m.compileCached(thread, pattern, flags)
-}
-
-// compileCached compiles a regex pattern by using the cache.
-// If the pattern already exists in the cache, the compiled pattern is returned.
-// Otherwise, the compiled pattern is compiled an then added to the cache.
-// When the cache exceeds `m.maxCacheSize`, the oldest entry is removed.
-// Do not call this function directly. Use `regexCompile` or `Module.compile` instead.
-func (m *Module) compileCached(thread *starlark.Thread, pattern strOrBytes, flags uint32) (*Pattern, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	if m.cache == nil || flags&regex.FlagDebug != 0 {
+		p, _, err := key.compile(thread)
+		return p, err
+	}
 
-	key := cacheKey{
-		pattern.value,
-		pattern.isString,
-		flags,
+	if c, ok := m.cache.(compilingCache); ok {
+		return c.GetOrCompile(key, func() (*Pattern, bool, error) {
+			return key.compile(thread)
+		})
 	}
 
-	if e, ok := m.cache[key]; ok { // pattern found in the cache
-		m.list.MoveToFront(e) // "refresh" the pattern in the linked list
-		return e.Value.(*cacheValue).pattern, nil
+	if p, ok := m.cache.Get(key); ok { // pattern found in the cache
+		return p, nil
 	}
 
-	p, add, err := newPattern(thread, pattern, flags, m.enableFallback)
+	p, add, err := key.compile(thread)
 	if err != nil {
 		return nil, err
 	}
 
 	if add {
-		// purge elements, if the size exceeds a certain threshold
-		if m.list.Len() >= m.maxCacheSize {
-			last := m.list.Back() // determine the oldest element
-			lastValue := last.Value.(*cacheValue)
-			lastKey := lastValue.key
-
-			// Delete from map and list
-			delete(m.cache, lastKey)
-			m.list.Remove(last)
-		}
-
-		// Add the compiled pattern to the cache.
-		v := &cacheValue{
-			pattern: p,
-			key:     key,
-		}
-
-		m.cache[key] = m.list.PushFront(v)
+		m.cache.Put(key, p)
 	}
 
 	return p, nil
@@ -326,7 +292,7 @@ func (m *Module) compileCached(thread *starlark.Thread, pattern strOrBytes, flag
 // reCompile precompiles a regex string into a pattern object, allowing it to be used for matching,
 // using its methods like `match` or `search`.
 // Since all member functions of the `re` module cache compiled patterns,
-// it is only necessary to use this function if the number of regexes exceeds the maximum cache size (`m.maxCacheSize`).
+// it is only necessary to use this function if the number of regexes exceeds the maximum cache size.
 func reCompile(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var (
 		pattern patternParam
@@ -440,7 +406,7 @@ func (s *strOrBytes) asType(v string) starlark.Value {
 	return starlark.Bytes(v)
 }
 
-// reCompile clears the regex cache.
+// rePurge clears the regex cache.
 func rePurge(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
 		return nil, err
@@ -469,17 +435,17 @@ func reSearch(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple,
 		return nil, err
 	}
 
-	return regexSearch(p, str, 0, posMax)
+	return regexSearch(thread, p, str, 0, posMax)
 }
 
 // regexSearch - see `reSearch`.
-func regexSearch(p *Pattern, str strOrBytes, pos, endpos int) (starlark.Value, error) {
+func regexSearch(thread *starlark.Thread, p *Pattern, str strOrBytes, pos, endpos int) (starlark.Value, error) {
 	err := checkParams(p, str, &pos, &endpos)
 	if err != nil {
 		return nil, err
 	}
 
-	match, err := findMatch(p.re, str.value, pos, endpos, false)
+	match, err := findMatch(thread, p.re, str.value, pos, endpos, false)
 	if err != nil {
 		return nil, err
 	}
@@ -537,17 +503,17 @@ func reMatch(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple,
 		return nil, err
 	}
 
-	return regexMatch(p, str, 0, posMax)
+	return regexMatch(thread, p, str, 0, posMax)
 }
 
 // regexMatch - see `reMatch`.
-func regexMatch(p *Pattern, str strOrBytes, pos, endpos int) (starlark.Value, error) {
+func regexMatch(thread *starlark.Thread, p *Pattern, str strOrBytes, pos, endpos int) (starlark.Value, error) {
 	err := checkParams(p, str, &pos, &endpos)
 	if err != nil {
 		return nil, err
 	}
 
-	match, err := findMatch(p.re, str.value, pos, endpos, false)
+	match, err := findMatch(thread, p.re, str.value, pos, endpos, false)
 	if err != nil {
 		return nil, err
 	}
@@ -576,17 +542,17 @@ func reFullmatch(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tup
 		return nil, err
 	}
 
-	return regexFullmatch(p, str, 0, posMax)
+	return regexFullmatch(thread, p, str, 0, posMax)
 }
 
 // regexFullmatch - see `reFullmatch`.
-func regexFullmatch(p *Pattern, str strOrBytes, pos, endpos int) (starlark.Value, error) {
+func regexFullmatch(thread *starlark.Thread, p *Pattern, str strOrBytes, pos, endpos int) (starlark.Value, error) {
 	err := checkParams(p, str, &pos, &endpos)
 	if err != nil {
 		return nil, err
 	}
 
-	match, err := findMatch(p.re, str.value, pos, endpos, true /* find longest */)
+	match, err := findMatch(thread, p.re, str.value, pos, endpos, true /* find longest */)
 	if err != nil {
 		return nil, err
 	}
@@ -618,17 +584,17 @@ func reSplit(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple,
 		return nil, err
 	}
 
-	return regexSplit(p, str, maxSplit)
+	return regexSplit(thread, p, str, maxSplit)
 }
 
 // regexSplit - see `reSplit`.
-func regexSplit(p *Pattern, str strOrBytes, maxSplit int) (starlark.Value, error) {
+func regexSplit(thread *starlark.Thread, p *Pattern, str strOrBytes, maxSplit int) (starlark.Value, error) {
 	err := p.pattern.sameType(str)
 	if err != nil {
 		return nil, err
 	}
 
-	return split(p, str, maxSplit)
+	return split(thread, p, str, maxSplit)
 }
 
 // reFindAll returns all non-overlapping matches of pattern in string, as a list of strings or tuples.
@@ -651,11 +617,11 @@ func reFindall(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple
 		return nil, err
 	}
 
-	return regexFindall(p, str, 0, posMax)
+	return regexFindall(thread, p, str, 0, posMax)
 }
 
 // regexFindall - see `reFindAll`.
-func regexFindall(p *Pattern, str strOrBytes, pos, endpos int) (starlark.Value, error) {
+func regexFindall(thread *starlark.Thread, p *Pattern, str strOrBytes, pos, endpos int) (starlark.Value, error) {
 	err := checkParams(p, str, &pos, &endpos)
 	if err != nil {
 		return nil, err
@@ -664,7 +630,7 @@ func regexFindall(p *Pattern, str strOrBytes, pos, endpos int) (starlark.Value,
 	s := str.value
 	var l []starlark.Value
 
-	err = findMatches(p.re, s, pos, endpos, 0, func(match []int) error {
+	err = findMatches(thread, p.re, s, pos, endpos, 0, func(match []int) error {
 		n := len(match) / 2
 
 		var v starlark.Value
@@ -723,11 +689,11 @@ func reFinditer(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tupl
 		return nil, err
 	}
 
-	return regexFinditer(p, str, 0, posMax)
+	return regexFinditer(thread, p, str, 0, posMax)
 }
 
 // regexFinditer - see `reFinditer`.
-func regexFinditer(p *Pattern, str strOrBytes, pos, endpos int) (starlark.Value, error) {
+func regexFinditer(thread *starlark.Thread, p *Pattern, str strOrBytes, pos, endpos int) (starlark.Value, error) {
 	err := checkParams(p, str, &pos, &endpos)
 	if err != nil {
 		return nil, err
@@ -735,7 +701,7 @@ func regexFinditer(p *Pattern, str strOrBytes, pos, endpos int) (starlark.Value,
 
 	var v starlark.Tuple
 
-	err = findMatches(p.re, str.value, pos, endpos, 0, func(match []int) error {
+	err = findMatches(thread, p.re, str.value, pos, endpos, 0, func(match []int) error {
 		v = append(v, newMatch(p, str, match, pos, endpos))
 		return nil
 	})
@@ -749,6 +715,9 @@ func regexFinditer(p *Pattern, str strOrBytes, pos, endpos int) (starlark.Value,
 // reSub return the text obtained by replacing the leftmost non-overlapping occurrences of the pattern in the text by the replacement repl,
 // replacing a maximum number of `count`. If the pattern is not found, the text is returned unchanged.
 // If the name of the builtin is "subn", the return value is the tuple `(new_string, number_of_subs_made)` instead.
+// If the replacement is a mapping, the text of the match or of the group `group` is replaced by its value in the mapping.
+// Missing keys are replaced by `default`, if it is set. The keys are looked up with the exact text of the match,
+// even if the pattern ignores cases.
 func reSub(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var (
 		pattern patternParam
@@ -756,8 +725,13 @@ func reSub(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kw
 		str     strOrBytes
 		count   int
 		flags   uint32
+		mp      mappingParams
 	)
-	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "pattern", &pattern, "repl", &repl, "string", &str, "count?", &count, "flags?", &flags); err != nil {
+	if err := checkPositionalArgs(b.Name(), args, 5); err != nil {
+		return nil, err
+	}
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "pattern", &pattern, "repl", &repl, "string", &str, "count?", &count, "flags?", &flags,
+		"group?", &mp.group, "default?", &mp.dflt); err != nil {
 		return nil, err
 	}
 
@@ -766,22 +740,32 @@ func reSub(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kw
 		return nil, err
 	}
 
-	return regexSub(thread, b.Name(), p, repl, str, count)
+	return regexSub(thread, b.Name(), p, repl, str, count, mp)
+}
+
+// checkPositionalArgs returns an error, if more than `max` positional arguments are passed to the builtin.
+// It is needed for keyword-only parameters, which are not supported by `starlark.UnpackArgs`.
+func checkPositionalArgs(name string, args starlark.Tuple, max int) error {
+	if len(args) > max {
+		return fmt.Errorf("%s: got %d arguments, want at most %d", name, len(args), max)
+	}
+
+	return nil
 }
 
 // regexSub - see `reSub`.
-func regexSub(thread *starlark.Thread, name string, p *Pattern, repl starlark.Value, str strOrBytes, count int) (starlark.Value, error) {
+func regexSub(thread *starlark.Thread, name string, p *Pattern, repl starlark.Value, str strOrBytes, count int, mp mappingParams) (starlark.Value, error) {
 	err := p.pattern.sameType(str)
 	if err != nil {
 		return nil, err
 	}
 
-	r, err := buildReplacer(thread, p, repl)
+	r, err := buildReplacer(thread, p, repl, mp)
 	if err != nil {
 		return nil, err
 	}
 
-	return sub(p, r, str, count, name == "subn")
+	return sub(thread, p, r, str, count, name == "subn")
 }
 
 // reEscape escapes special characters in pattern.
@@ -810,9 +794,20 @@ type Pattern struct {
 // If the compiler returns a debug representation of the pattern,
 // it will be printed to the print function of the current Starlark thread and the
 // compiled pattern should not be cached, so the second return value is `false'.
+// If the name of a regex engine is passed, the pattern is always compiled with this engine (see `regex.CompileEngine`).
 // Do not call this function directly. Use `regexCompile` or `Module.compile` instead.
-func newPattern(thread *starlark.Thread, pattern strOrBytes, flags uint32, fallbackEnabled bool) (*Pattern, bool, error) {
-	re, debug, err := regex.Compile(pattern.value, pattern.isString, flags, fallbackEnabled)
+func newPattern(thread *starlark.Thread, pattern strOrBytes, flags uint32, fallbackEnabled bool, loc *regex.Locale, engine string) (*Pattern, bool, error) {
+	var (
+		re    regex.Engine
+		debug string
+		err   error
+	)
+
+	if engine != "" {
+		re, debug, err = regex.CompileEngine(engine, pattern.value, pattern.isString, flags, loc)
+	} else {
+		re, debug, err = regex.Compile(pattern.value, pattern.isString, flags, fallbackEnabled, loc)
+	}
 	if err != nil {
 		return nil, false, err
 	}
@@ -946,6 +941,13 @@ var patternMethods = map[string]*starlark.Builtin{
 	"finditer":  starlark.NewBuiltin("finditer", patternFinditer),
 	"sub":       starlark.NewBuiltin("sub", patternSub),
 	"subn":      starlark.NewBuiltin("subn", patternSub),
+	"explain":   starlark.NewBuiltin("explain", patternExplain),
+	"to_dot":    starlark.NewBuiltin("to_dot", patternToDot),
+	"to_svg":    starlark.NewBuiltin("to_svg", patternToSVG),
+	"translate": starlark.NewBuiltin("translate", patternTranslate),
+	"template":  starlark.NewBuiltin("template", patternTemplate),
+	"subf":      starlark.NewBuiltin("subf", patternSubf),
+	"subfn":     starlark.NewBuiltin("subfn", patternSubf),
 }
 
 // patternMembers contains members of the pattern object.
@@ -1023,8 +1025,28 @@ func patternEquals(x, y *Pattern) bool {
 	return x.pattern == y.pattern && x.flags == y.flags
 }
 
+// groupIndex converts the group key into a valid index of a group of the pattern, where 0 is the whole match.
+// The key must be either of type `int` or `str`. Keys of type int are used as indices and keys
+// of type str are used as group names. If the index key is out of range, does not exist or has
+// an invalid type, then an index error is returned.
+func (p *Pattern) groupIndex(v starlark.Value) (int, error) {
+	switch v := v.(type) {
+	case starlark.Int:
+		i, ok := v.Int64()
+		if ok && i >= 0 && i <= int64(p.re.SubexpCount()) {
+			return int(i), nil
+		}
+	case starlark.String:
+		if i := p.re.SubexpIndex(string(v)); i >= 0 {
+			return i, nil
+		}
+	}
+
+	return 0, errors.New("IndexError: no such group")
+}
+
 // patternSearch - see `reSearch`.
-func patternSearch(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+func patternSearch(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var (
 		str    strOrBytes
 		pos    = 0
@@ -1035,11 +1057,11 @@ func patternSearch(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple,
 	}
 
 	p := b.Receiver().(*Pattern)
-	return regexSearch(p, str, pos, endpos)
+	return regexSearch(thread, p, str, pos, endpos)
 }
 
 // patternMatch - see `reMatch`.
-func patternMatch(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+func patternMatch(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var (
 		str    strOrBytes
 		pos    = 0
@@ -1050,11 +1072,11 @@ func patternMatch(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple,
 	}
 
 	p := b.Receiver().(*Pattern)
-	return regexMatch(p, str, pos, endpos)
+	return regexMatch(thread, p, str, pos, endpos)
 }
 
 // patternFullmatch - see `reFullmatch`.
-func patternFullmatch(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+func patternFullmatch(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var (
 		str    strOrBytes
 		pos    = 0
@@ -1065,11 +1087,11 @@ func patternFullmatch(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tup
 	}
 
 	p := b.Receiver().(*Pattern)
-	return regexFullmatch(p, str, pos, endpos)
+	return regexFullmatch(thread, p, str, pos, endpos)
 }
 
 // patternSplit - see `reSplit`.
-func patternSplit(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+func patternSplit(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var (
 		str      strOrBytes
 		maxSplit int
@@ -1079,11 +1101,11 @@ func patternSplit(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple,
 	}
 
 	p := b.Receiver().(*Pattern)
-	return regexSplit(p, str, maxSplit)
+	return regexSplit(thread, p, str, maxSplit)
 }
 
 // patternFindall - see `reFindall`.
-func patternFindall(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+func patternFindall(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var (
 		str    strOrBytes
 		pos    = 0
@@ -1094,11 +1116,11 @@ func patternFindall(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple
 	}
 
 	p := b.Receiver().(*Pattern)
-	return regexFindall(p, str, pos, endpos)
+	return regexFindall(thread, p, str, pos, endpos)
 }
 
 // patternFinditer - see `reFinditer`.
-func patternFinditer(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+func patternFinditer(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var (
 		str    strOrBytes
 		pos    = 0
@@ -1109,7 +1131,7 @@ func patternFinditer(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tupl
 	}
 
 	p := b.Receiver().(*Pattern)
-	return regexFinditer(p, str, pos, endpos)
+	return regexFinditer(thread, p, str, pos, endpos)
 }
 
 // patternSub - see `reSub`.
@@ -1118,13 +1140,44 @@ func patternSub(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tupl
 		repl  starlark.Value
 		str   strOrBytes
 		count int
+		mp    mappingParams
+	)
+	if err := checkPositionalArgs(b.Name(), args, 3); err != nil {
+		return nil, err
+	}
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "repl", &repl, "string", &str, "count?", &count,
+		"group?", &mp.group, "default?", &mp.dflt); err != nil {
+		return nil, err
+	}
+
+	p := b.Receiver().(*Pattern)
+	return regexSub(thread, b.Name(), p, repl, str, count, mp)
+}
+
+// patternSubf works like `patternSub`, but the replacement is a format string like "{1}-{name!r:>10}"
+// (see `regex.ParseFormat`). If the name of the builtin is "subfn", the number of replacements is also returned.
+func patternSubf(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		format strOrBytes
+		str    strOrBytes
+		count  int
 	)
-	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "repl", &repl, "string", &str, "count?", &count); err != nil {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "format", &format, "string", &str, "count?", &count); err != nil {
 		return nil, err
 	}
 
 	p := b.Receiver().(*Pattern)
-	return regexSub(thread, b.Name(), p, repl, str, count)
+
+	if err := p.pattern.sameType(str); err != nil {
+		return nil, err
+	}
+
+	r, err := newFormatReplacer(p, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return sub(thread, p, r, str, count, b.Name() == "subfn")
 }
 
 // Match object
@@ -1247,6 +1300,7 @@ func (m *Match) Hash() (uint32, error) {
 // matchMethods contains methods of the match object.
 var matchMethods = map[string]*starlark.Builtin{
 	"expand":    starlark.NewBuiltin("expand", matchExpand),
+	"expandf":   starlark.NewBuiltin("expandf", matchExpandf),
 	"group":     starlark.NewBuiltin("group", matchGroup),
 	"groups":    starlark.NewBuiltin("groups", matchGroups),
 	"groupdict": starlark.NewBuiltin("groupdict", matchGroupDict),
@@ -1348,24 +1402,10 @@ func (m *Match) group(v starlark.Value) (starlark.Value, error) {
 	return m.str.asType(m.groupStr(g)), nil
 }
 
-// getIndex converts the group key into a valid integer index for one of the groups of this match.
-// The key must be either of type `int` or `str`. Keys of type int are used as indices and keys
-// of type str are used as group names. If the index key is out of range, does not exist or has
-// an invalid type, then an index error is returned.
+// getIndex converts the group key into a valid integer index for one of the groups of this match
+// (see `Pattern.groupIndex`).
 func (m *Match) getIndex(v starlark.Value) (int, error) {
-	switch v := v.(type) {
-	case starlark.Int:
-		i, ok := v.Int64()
-		if ok && i >= 0 && i < int64(len(m.groups)) {
-			return int(i), nil
-		}
-	case starlark.String:
-		if i := m.pattern.re.SubexpIndex(string(v)); i >= 0 {
-			return i, nil
-		}
-	}
-
-	return 0, errors.New("IndexError: no such group")
+	return m.pattern.groupIndex(v)
 }
 
 // CompareSameType compares this matches to another one.
@@ -1402,28 +1442,55 @@ func matchEquals(x, y *Match) bool {
 
 // matchExpand returns the string obtained by doing backslash substitution on
 // the template string template, as done by the sub() method.
+// The template may also be a compiled template of the pattern (see `Template`).
 func matchExpand(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-	var template strOrBytes
+	var template starlark.Value
 	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "template", &template); err != nil {
 		return nil, err
 	}
 
 	m := b.Receiver().(*Match)
 
-	err := m.str.sameType(template)
+	var r matchReplacer
+	var err error
+
+	if t, ok := template.(*Template); ok {
+		r, err = t.replacerFor(m.pattern)
+	} else {
+		r, err = newExpandReplacer(m, template)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var w strings.Builder
+
+	// Replace the template
+	err = r.replace(&w, m)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create a new replacer for the template
-	r, err := newTemplateReplacer(m.pattern.re, template.value, template.isString)
+	return m.str.asType(w.String()), nil
+}
+
+// matchExpandf returns the string obtained by formatting the groups of the match with the format string,
+// as done by `Pattern.subf()`.
+func matchExpandf(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var format strOrBytes
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "format", &format); err != nil {
+		return nil, err
+	}
+
+	m := b.Receiver().(*Match)
+
+	r, err := newFormatReplacer(m.pattern, format)
 	if err != nil {
 		return nil, err
 	}
 
 	var w strings.Builder
 
-	// Replace the template
 	err = r.replace(&w, m)
 	if err != nil {
 		return nil, err
@@ -1432,6 +1499,20 @@ func matchExpand(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, k
 	return m.str.asType(w.String()), nil
 }
 
+// newExpandReplacer creates a new replacer for the template string of `Match.expand`.
+func newExpandReplacer(m *Match, v starlark.Value) (matchReplacer, error) {
+	var template strOrBytes
+	if err := template.Unpack(v); err != nil {
+		return nil, err
+	}
+
+	if err := m.str.sameType(template); err != nil {
+		return nil, err
+	}
+
+	return newTemplateReplacer(m.pattern.re, template.value, template.isString)
+}
+
 // matchGroup returns one or more subgroups of the match. If there is a single argument, the result is a
 // single string; if there are multiple arguments, the result is a tuple with one item per argument.
 // Without arguments, group1 defaults to zero (the whole match is returned).
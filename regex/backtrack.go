@@ -0,0 +1,684 @@
+package regex
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// btEngine is the type, that represents the native backtracking engine.
+// Unlike the other regex engines, the backtracking engine does not compile a preprocessed regex pattern,
+// but compiles the parsed regex tree into its own instructions, that are matched with the semantics of
+// the Python regex engine (sre). It supports all elements of the Python regex syntax, including possessive
+// repetitions. Like sre, the backtracking state is kept on an explicit stack instead of the call stack,
+// so the number of repetitions is not limited by the stack size of the goroutine.
+type btEngine struct {
+	prog       *btProgram
+	pattern    string
+	flags      uint32
+	isStr      bool
+	numSubexp  int
+	names      []string
+	groupNames map[string]int
+	anchored   bool       // the pattern can only match at the beginning of the string
+	minWidth   int        // minimum number of characters matched by the pattern
+	filter     *prefilter // may be nil
+}
+
+// btInput is the type, that represents the processed input of `btEngine`.
+type btInput struct {
+	re *btEngine
+	s  string
+}
+
+// btMatcher is the state of a single search of the backtracking engine.
+type btMatcher struct {
+	s       string
+	isStr   bool
+	caps    []int
+	starts  []int      // start positions of the groups, that are currently matched
+	repeats []btRepeat // counters of the repeats
+	best    []int      // captures of the longest match found so far
+
+	stack    []btFrame // backtracking stack
+	barriers []int     // indices of the barrier frames on the stack
+}
+
+// btRepeat is the counter of a repeat, that is currently matched.
+type btRepeat struct {
+	count int // number of started repetitions
+	last  int // start position of the last repetition after the minimum count; -1 if none
+}
+
+// btFrameKind is the type of a frame of the backtracking stack.
+type btFrameKind uint8
+
+// Types of frames of the backtracking stack. Undo frames revert changes of the captures and the counters,
+// when they are popped. All other frames resume the matching at an alternative. The undo frames must be the
+// first kinds (see `cut`).
+const (
+	frameUndoStart  btFrameKind = iota // restore the start position `a` of group `pc`
+	frameUndoGroup                     // restore the captures `a` and `b` of group `pc`
+	frameUndoRepeat                    // restore the counter `a` and last position `b` of repeat `pc`
+	frameChoice                        // continue at instruction `pc` and position `pos`
+	frameRepeatExit                    // restore the repeat of instruction `pc` to `a` and `b` and continue after the repeat
+	frameRepeatMore                    // try another repetition of the lazy repeat of instruction `pc`
+	frameCharGreedy                    // match one character less with the character repeat `pc`, which matched `a` characters
+	frameCharLazy                      // match one character more with the character repeat `pc`, which matched `a` characters
+	frameBarrier                       // start of the body of instruction `pc` at position `pos` (see `btEnd`)
+)
+
+// btFrame is a frame of the backtracking stack.
+type btFrame struct {
+	kind btFrameKind
+	pc   int32 // instruction, group or repeat
+	pos  int
+	a, b int
+}
+
+// Check if the types satisfy the interfaces.
+var (
+	_ Engine = (*btEngine)(nil)
+	_ Input  = (*btInput)(nil)
+)
+
+// newBacktrackEngine compiles the parsed regex pattern with the native backtracking engine.
+func newBacktrackEngine(p *preprocessor) *btEngine {
+	flags := p.flags()
+	numSubexp := p.p.state.groups() - 1
+
+	names := make([]string, 1+numSubexp)
+	for name, i := range p.groupNames() {
+		names[i] = name
+	}
+
+	e := &btEngine{
+		prog:       p.compileProgram(flags),
+		pattern:    p.pattern,
+		flags:      flags,
+		isStr:      p.isStr,
+		numSubexp:  numSubexp,
+		names:      names,
+		groupNames: p.groupNames(),
+		filter:     p.prefilter(),
+	}
+
+	e.minWidth, _ = p.p.width()
+
+	if len(p.p.data) > 0 {
+		if first := p.p.data[0]; first.opcode == opAt {
+			switch first.params.(atcode) {
+			case atBeginningString:
+				e.anchored = true
+			case atBeginning:
+				e.anchored = flags&FlagMultiline == 0
+			}
+		}
+	}
+
+	return e
+}
+
+// Flags is the implementation of the `Flags` function for the `Engine` interface.
+func (r *btEngine) Flags() uint32 {
+	return r.flags
+}
+
+// SubexpNames is the implementation of the `SubexpNames` function for the `Engine` interface.
+func (r *btEngine) SubexpNames() []string {
+	return r.names
+}
+
+// SubexpCount is the implementation of the `SubexpCount` function for the `Engine` interface.
+func (r *btEngine) SubexpCount() int {
+	return r.numSubexp
+}
+
+// SubexpIndex is the implementation of the `SubexpIndex` function for the `Engine` interface.
+func (r *btEngine) SubexpIndex(name string) int {
+	if i, ok := r.groupNames[name]; ok {
+		return i
+	}
+
+	return -1
+}
+
+// SupportsLongest is the implementation of the `SupportsLongest` function for the `Engine` interface.
+// The longest match is found by trying all matches at the leftmost position, so it may be slow.
+func (r *btEngine) SupportsLongest() bool {
+	return true
+}
+
+// BuildInput is the implementation of the `BuildInput` function for the `Engine` interface.
+// The backtracking engine matches the bytes of the string directly, so the input is not modified.
+func (r *btEngine) BuildInput(s string, endpos int) Input {
+	return &btInput{
+		re: r,
+		s:  s[:endpos],
+	}
+}
+
+// Program is the implementation of the `Program` function for the `Engine` interface.
+// Since the backtracking engine has no preprocessed regex pattern, the program contains the original
+// pattern, which is parsed again when restoring the engine.
+func (r *btEngine) Program() *Program {
+	p := Program{
+		Engine:  EngineBacktrack,
+		Pattern: r.pattern,
+		Flags:   r.flags,
+		IsStr:   r.isStr,
+	}
+
+	return &p
+}
+
+// Find is the implementation of the `Find` function for the `Input` interface.
+// If `longest` is true, all matches at the leftmost position are tried and the longest one is returned.
+// Of multiple matches with the same length, the first one found is used.
+func (i *btInput) Find(pos int, longest bool, dstCap []int) ([]int, error) {
+	return i.find(pos, longest, false, dstCap), nil
+}
+
+// FindAdvance is the implementation of the `FindAdvance` function for the `AdvanceInput` interface.
+// Like in Python, a match at position `pos` is the first non-empty match in backtracking order,
+// while matches at later positions may be empty.
+func (i *btInput) FindAdvance(pos int, dstCap []int) ([]int, error) {
+	return i.find(pos, false, true, dstCap), nil
+}
+
+// find searches the input for the next match starting at position `pos`.
+// If `advance` is true, empty matches at position `pos` are rejected.
+func (i *btInput) find(pos int, longest, advance bool, dstCap []int) []int {
+	m := &btMatcher{
+		s:       i.s,
+		isStr:   i.re.isStr,
+		caps:    make([]int, 2*(i.re.numSubexp+1)),
+		starts:  make([]int, i.re.numSubexp+1),
+		repeats: make([]btRepeat, i.re.prog.repeats),
+	}
+
+	// Like in Python, the search stops, if the remaining string is shorter than the minimum width of the pattern.
+	// Since each character has at least one byte, the number of remaining bytes is an upper bound.
+	occ := -1 // position of the next occurrence of the literal of the prefilter
+
+	for start := pos; len(i.s)-start >= i.re.minWidth; {
+		// Skip all positions, where no match can start.
+		if f := i.re.filter; f != nil {
+			if occ < start {
+				if occ = f.index(i.s, start); occ < 0 {
+					break
+				}
+			}
+
+			start = f.start(i.s, start, occ)
+		}
+
+		if i.re.matchAt(m, start, longest, advance && start == pos) {
+			a := growSlice(dstCap, len(m.caps))
+			copy(a, m.caps)
+			return a
+		}
+
+		if i.re.anchored {
+			break
+		}
+
+		_, size := m.next(start)
+		if size == 0 {
+			break
+		}
+
+		start += size
+	}
+
+	return nil
+}
+
+// matchAt tries to match the regex pattern at position `start`.
+// If a match was found, the capture groups of the matcher contain the match.
+// If `longest` is true, all matches at the position are tried and the longest one is used.
+// Of multiple matches with the same length, the first one found is used.
+// If `nonEmpty` is true, empty matches are rejected and the search backtracks instead.
+func (r *btEngine) matchAt(m *btMatcher, start int, longest, nonEmpty bool) bool {
+	for j := range m.caps {
+		m.caps[j] = -1
+	}
+
+	m.stack = m.stack[:0]
+	m.barriers = m.barriers[:0]
+	m.best = m.best[:0]
+
+	prog := r.prog.inst
+	pc, pos := 0, start
+
+	for {
+		inst := &prog[pc]
+		ok := true
+
+		switch inst.op {
+		case btMatch:
+			if nonEmpty && pos == start {
+				ok = false
+				break
+			}
+
+			if !longest {
+				m.caps[0], m.caps[1] = start, pos
+				return true
+			}
+
+			if len(m.best) == 0 || pos > m.best[1] {
+				m.best = append(m.best[:0], m.caps...)
+				m.best[0], m.best[1] = start, pos
+			}
+
+			// No longer match can be found, if the match reaches the end of the string.
+			if pos == len(m.s) {
+				copy(m.caps, m.best)
+				return true
+			}
+
+			ok = false
+		case btFail:
+			ok = false
+		case btChars:
+			for _, set := range inst.sets {
+				c, size := m.next(pos)
+				if size == 0 || !set.contains(c) {
+					ok = false
+					break
+				}
+
+				pos += size
+			}
+
+			pc++
+		case btAt:
+			ok = inst.at(m, pos)
+			pc++
+		case btJmp:
+			pc = inst.x
+		case btSplit:
+			m.push(btFrame{kind: frameChoice, pc: int32(inst.x), pos: pos})
+			pc++
+		case btGroupStart:
+			m.push(btFrame{kind: frameUndoStart, pc: int32(inst.x), a: m.starts[inst.x]})
+			m.starts[inst.x] = pos
+			pc++
+		case btGroupEnd:
+			g := inst.x
+			m.push(btFrame{kind: frameUndoGroup, pc: int32(g), a: m.caps[2*g], b: m.caps[2*g+1]})
+			m.caps[2*g], m.caps[2*g+1] = m.starts[g], pos
+			pc++
+		case btGroupref:
+			pos, ok = m.matchGroupref(inst, pos)
+			pc++
+		case btGrouprefExists:
+			if m.caps[2*inst.x] >= 0 && m.caps[2*inst.x+1] >= 0 {
+				pc++
+			} else {
+				pc = inst.y
+			}
+		case btRepeatInit:
+			m.setRepeat(inst.x, btRepeat{count: 0, last: -1})
+			pc++
+		case btRepeatGreedy:
+			// Like in Python, another repetition is only tried, if the previous repetition did not match an
+			// empty string, once the minimum count is reached.
+			rep := m.repeats[inst.x]
+
+			switch {
+			case rep.count < inst.min:
+				m.setRepeat(inst.x, btRepeat{count: rep.count + 1, last: rep.last})
+				pc++
+			case rep.count < inst.max && pos != rep.last:
+				m.push(btFrame{kind: frameRepeatExit, pc: int32(pc), pos: pos, a: rep.count, b: rep.last})
+				m.repeats[inst.x] = btRepeat{count: rep.count + 1, last: pos}
+				pc++
+			default:
+				pc = inst.y
+			}
+		case btRepeatLazy:
+			rep := m.repeats[inst.x]
+
+			if rep.count < inst.min {
+				m.setRepeat(inst.x, btRepeat{count: rep.count + 1, last: rep.last})
+				pc++
+			} else {
+				m.push(btFrame{kind: frameRepeatMore, pc: int32(pc), pos: pos})
+				pc = inst.y
+			}
+		case btRepeatPossessive:
+			if m.repeats[inst.x].count >= inst.max {
+				pc = inst.y
+			} else {
+				m.pushBarrier(pc, pos, 0, 0)
+				pc++
+			}
+		case btCharRepeat:
+			pos, ok = m.matchCharRepeat(inst, pc, pos)
+			pc++
+		case btAtomic, btLookahead:
+			m.pushBarrier(pc, pos, 0, 0)
+			pc++
+		case btLookbehind:
+			// The body must match a substring ending at the current position, which has a length between
+			// `min` and `max` characters. Shorter substrings are tried first (see `backtrack`).
+			start := pos
+			for n := 0; n < inst.min && ok; n++ {
+				_, size := m.prev(start)
+				start -= size
+				ok = size > 0
+			}
+
+			switch {
+			case ok:
+				m.pushBarrier(pc, pos, start, inst.min)
+				pos = start
+				pc++
+			case inst.negate:
+				ok = true
+				pc = inst.y
+			}
+		case btEnd:
+			pc, pos, ok = m.end(prog, pc, pos)
+		}
+
+		if !ok {
+			if pc, pos, ok = m.backtrack(prog); !ok {
+				if len(m.best) > 0 {
+					copy(m.caps, m.best)
+					return true
+				}
+
+				return false
+			}
+		}
+	}
+}
+
+// matchGroupref matches the text of a previously matched capture group at position `pos`.
+// If the group did not match, the backreference fails.
+func (m *btMatcher) matchGroupref(inst *btInst, pos int) (int, bool) {
+	start, end := m.caps[2*inst.x], m.caps[2*inst.x+1]
+	if start < 0 || end < 0 {
+		return pos, false
+	}
+
+	if inst.equal == nil {
+		sub := m.s[start:end]
+		return pos + len(sub), strings.HasPrefix(m.s[pos:], sub)
+	}
+
+	for i := start; i < end; {
+		c1, size1 := m.next(i)
+		c2, size2 := m.next(pos)
+		if size2 == 0 || !inst.equal(c1, c2) {
+			return pos, false
+		}
+
+		i += size1
+		pos += size2
+	}
+
+	return pos, true
+}
+
+// matchCharRepeat matches the minimum number of characters of the character repeat at instruction `pc`.
+// Greedy and possessive repeats then match as many characters as possible. Since no backtracking into the
+// characters is necessary, the alternatives of greedy and lazy repeats are a single frame (see `backtrack`).
+func (m *btMatcher) matchCharRepeat(inst *btInst, pc, pos int) (int, bool) {
+	set := inst.sets[0]
+
+	count := 0
+	for ; count < inst.min; count++ {
+		c, size := m.next(pos)
+		if size == 0 || !set.contains(c) {
+			return pos, false
+		}
+
+		pos += size
+	}
+
+	if inst.kind == opMinRepeat {
+		if count < inst.max {
+			m.push(btFrame{kind: frameCharLazy, pc: int32(pc), pos: pos, a: count})
+		}
+
+		return pos, true
+	}
+
+	for ; count < inst.max; count++ {
+		c, size := m.next(pos)
+		if size == 0 || !set.contains(c) {
+			break
+		}
+
+		pos += size
+	}
+
+	if inst.kind == opMaxRepeat && count > inst.min {
+		m.push(btFrame{kind: frameCharGreedy, pc: int32(pc), pos: pos, a: count})
+	}
+
+	return pos, true
+}
+
+// end finishes the body of the innermost atomic group, lookaround or repetition of a possessive repeat,
+// that started with a barrier frame. Only the first match of the body is considered, so all alternatives
+// of the body are removed from the stack, while the changes of the captures are kept.
+// It returns the next instruction and position or false, if the matching fails.
+func (m *btMatcher) end(prog []btInst, pc, pos int) (int, int, bool) {
+	bi := m.barriers[len(m.barriers)-1]
+	b := m.stack[bi]
+	start := &prog[b.pc]
+
+	switch start.op {
+	case btAtomic:
+		m.cut(bi)
+		return pc + 1, pos, true
+	case btRepeatPossessive:
+		m.cut(bi)
+
+		// Like in Python, the repetition stops after a repetition matched an empty string, once the minimum
+		// count is reached.
+		rep := m.repeats[start.x]
+		if rep.count >= start.min && pos == b.pos {
+			return start.y, pos, true
+		}
+
+		m.setRepeat(start.x, btRepeat{count: rep.count + 1, last: rep.last})
+		return int(b.pc), pos, true
+	}
+
+	// lookahead or lookbehind
+	if start.op == btLookbehind && pos != b.pos {
+		return pc, pos, false
+	}
+
+	if start.negate {
+		m.unwind(bi)
+		return pc, pos, false
+	}
+
+	m.cut(bi)
+	return start.y, b.pos, true
+}
+
+// backtrack pops frames from the stack until a frame with an alternative is found.
+// It returns the instruction and position to continue with or false, if no alternative is left.
+func (m *btMatcher) backtrack(prog []btInst) (int, int, bool) {
+	for len(m.stack) > 0 {
+		f := m.stack[len(m.stack)-1]
+		m.stack = m.stack[:len(m.stack)-1]
+
+		pc := int(f.pc)
+
+		switch f.kind {
+		case frameUndoStart, frameUndoGroup, frameUndoRepeat:
+			m.undo(f)
+		case frameChoice:
+			return pc, f.pos, true
+		case frameRepeatExit:
+			inst := &prog[pc]
+			m.repeats[inst.x] = btRepeat{count: f.a, last: f.b}
+			return inst.y, f.pos, true
+		case frameRepeatMore:
+			inst := &prog[pc]
+
+			rep := m.repeats[inst.x]
+			if rep.count >= inst.max || f.pos == rep.last {
+				continue
+			}
+
+			m.setRepeat(inst.x, btRepeat{count: rep.count + 1, last: f.pos})
+			return pc + 1, f.pos, true
+		case frameCharGreedy:
+			_, size := m.prev(f.pos)
+			pos, count := f.pos-size, f.a-1
+
+			if count > prog[pc].min {
+				m.push(btFrame{kind: frameCharGreedy, pc: f.pc, pos: pos, a: count})
+			}
+
+			return pc + 1, pos, true
+		case frameCharLazy:
+			inst := &prog[pc]
+
+			c, size := m.next(f.pos)
+			if size == 0 || !inst.sets[0].contains(c) {
+				continue
+			}
+
+			pos, count := f.pos+size, f.a+1
+			if count < inst.max {
+				m.push(btFrame{kind: frameCharLazy, pc: f.pc, pos: pos, a: count})
+			}
+
+			return pc + 1, pos, true
+		case frameBarrier:
+			// The body failed to match.
+			m.barriers = m.barriers[:len(m.barriers)-1]
+			inst := &prog[pc]
+
+			switch inst.op {
+			case btLookahead:
+				if inst.negate {
+					return inst.y, f.pos, true
+				}
+			case btLookbehind:
+				// Try the next longer substring.
+				if _, size := m.prev(f.a); size > 0 && f.b < inst.max {
+					m.pushBarrier(pc, f.pos, f.a-size, f.b+1)
+					return pc + 1, f.a - size, true
+				}
+
+				if inst.negate {
+					return inst.y, f.pos, true
+				}
+			case btRepeatPossessive:
+				if m.repeats[inst.x].count >= inst.min {
+					return inst.y, f.pos, true
+				}
+			}
+		}
+	}
+
+	return 0, 0, false
+}
+
+// push pushes a frame onto the backtracking stack.
+func (m *btMatcher) push(f btFrame) {
+	m.stack = append(m.stack, f)
+}
+
+// pushBarrier pushes a barrier frame for the body of the instruction `pc`, that started at position `pos`.
+func (m *btMatcher) pushBarrier(pc, pos, a, b int) {
+	m.barriers = append(m.barriers, len(m.stack))
+	m.push(btFrame{kind: frameBarrier, pc: int32(pc), pos: pos, a: a, b: b})
+}
+
+// setRepeat sets the counter of a repeat and pushes a frame to restore it.
+func (m *btMatcher) setRepeat(id int, rep btRepeat) {
+	old := m.repeats[id]
+	m.push(btFrame{kind: frameUndoRepeat, pc: int32(id), a: old.count, b: old.last})
+	m.repeats[id] = rep
+}
+
+// cut removes the barrier frame at index `bi` and all frames above it, that are alternatives.
+// Undo frames are kept, so the changes of the body are reverted, when backtracking beyond the body.
+func (m *btMatcher) cut(bi int) {
+	j := bi
+	for _, f := range m.stack[bi+1:] {
+		if f.kind <= frameUndoRepeat {
+			m.stack[j] = f
+			j++
+		}
+	}
+
+	m.stack = m.stack[:j]
+	m.barriers = m.barriers[:len(m.barriers)-1]
+}
+
+// unwind removes the barrier frame at index `bi` and all frames above it and reverts all changes of the body.
+func (m *btMatcher) unwind(bi int) {
+	for len(m.stack) > bi+1 {
+		m.undo(m.stack[len(m.stack)-1])
+		m.stack = m.stack[:len(m.stack)-1]
+	}
+
+	m.stack = m.stack[:bi]
+	m.barriers = m.barriers[:len(m.barriers)-1]
+}
+
+// undo reverts the change recorded by an undo frame. Other frames are ignored.
+func (m *btMatcher) undo(f btFrame) {
+	switch f.kind {
+	case frameUndoStart:
+		m.starts[f.pc] = f.a
+	case frameUndoGroup:
+		m.caps[2*f.pc], m.caps[2*f.pc+1] = f.a, f.b
+	case frameUndoRepeat:
+		m.repeats[f.pc] = btRepeat{count: f.a, last: f.b}
+	}
+}
+
+// next returns the character at position `pos` and its size in bytes.
+// For strings, invalid UTF-8 bytes are returned as a single character with the value of the byte.
+// If `pos` is at the end of the input, the size is zero.
+func (m *btMatcher) next(pos int) (rune, int) {
+	if pos >= len(m.s) {
+		return 0, 0
+	}
+
+	b := m.s[pos]
+	if !m.isStr || b < utf8.RuneSelf {
+		return rune(b), 1
+	}
+
+	c, size := utf8.DecodeRuneInString(m.s[pos:])
+	if c == utf8.RuneError && size == 1 {
+		c = rune(b)
+	}
+
+	return c, size
+}
+
+// prev returns the character before position `pos` and its size in bytes.
+// If `pos` is at the beginning of the input, the size is zero.
+func (m *btMatcher) prev(pos int) (rune, int) {
+	if pos <= 0 {
+		return 0, 0
+	}
+
+	b := m.s[pos-1]
+	if !m.isStr || b < utf8.RuneSelf {
+		return rune(b), 1
+	}
+
+	c, size := utf8.DecodeLastRuneInString(m.s[:pos])
+	if c == utf8.RuneError && size == 1 {
+		c = rune(b)
+	}
+
+	return c, size
+}
@@ -0,0 +1,67 @@
+package regex
+
+import (
+	"reflect"
+	"regexp"
+	"regexp/syntax"
+	"unsafe"
+
+	"github.com/dlclark/regexp2"
+	syntax2 "github.com/dlclark/regexp2/syntax"
+)
+
+// Estimated sizes in bytes, used to calculate the cost of compiled regex engines.
+const (
+	costEngine = 256 // base size of a compiled regex engine
+	costInst   = 40  // size of an instruction of `regexp.Regexp`, without runes
+	costRune   = 4   // size of a rune
+	costCode   = 8   // size of an instruction code of `regexp2.Regexp`
+	costSet    = 96  // size of a character set of `regexp2.Regexp`, without ranges
+	costGroup  = 48  // size of a capturing group, including the slice capacity for the group indices
+)
+
+// Cost returns the estimated memory cost of a compiled regex engine in bytes.
+// The cost is based on the length of the preprocessed regex pattern, the size of the compiled program
+// and the number of groups.
+// For engines other than the default and the fallback engine, the program size is not included.
+func Cost(e Engine) int {
+	cost := costEngine + (e.SubexpCount()+1)*costGroup
+
+	switch r := e.(type) {
+	case *stdRegex:
+		cost += len(r.re.String())
+
+		for _, inst := range stdProg(r.re).Inst {
+			cost += costInst + len(inst.Rune)*costRune
+		}
+	case *fallbEngine:
+		cost += len(r.re.String())
+
+		code := fallbCode(r.re)
+		cost += len(code.Codes) * costCode
+		for _, s := range code.Strings {
+			cost += len(s) * costRune
+		}
+		cost += len(code.Sets) * costSet
+	default:
+		cost += len(e.Program().Pattern)
+	}
+
+	return cost
+}
+
+// stdProg returns the unexported field `r.prog`.
+func stdProg(r *regexp.Regexp) *syntax.Prog {
+	v := reflect.ValueOf(r).Elem()
+	v = v.FieldByName("prog")
+	p := unsafe.Pointer(v.Pointer())
+	return (*syntax.Prog)(p)
+}
+
+// fallbCode returns the unexported field `r.code`.
+func fallbCode(r *regexp2.Regexp) *syntax2.Code {
+	v := reflect.ValueOf(r).Elem()
+	v = v.FieldByName("code")
+	p := unsafe.Pointer(v.Pointer())
+	return (*syntax2.Code)(p)
+}
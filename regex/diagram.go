@@ -0,0 +1,258 @@
+package regex
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dot parses the regex pattern and returns a Graphviz graph of the pattern in the DOT language.
+// The graph flows from left to right. Groups, lookarounds and repeats are drawn as clusters, branches are split
+// and joined at points and repeats have an edge back to the start of the repeated item. Classes, categories and
+// positions are labeled with their source text; consecutive literals are combined into a single node.
+// If the pattern is invalid, the parser error is returned.
+func Dot(pattern string, isStr bool, flags uint32) (string, error) {
+	sp, err := parse(pattern, isStr, flags)
+	if err != nil {
+		return "", err
+	}
+
+	w := dotWriter{e: newExplainer(pattern, sp, isStr)}
+
+	w.line("digraph pattern {")
+	w.level++
+	w.line("rankdir=LR;")
+	w.line(`node [shape=box, fontname="monospace"];`)
+	w.line(`start [shape=circle, label="", width=0.2];`)
+	w.line(`end [shape=doublecircle, label="", width=0.15];`)
+
+	in, out := w.seq(sp)
+	w.edge("start", in, "")
+	w.edge(out, "end", "")
+
+	w.level--
+	w.line("}")
+
+	return w.b.String(), nil
+}
+
+// diagramItem is an item of a subpattern, that is drawn as a single element in a diagram.
+// Consecutive literals are combined into a single item.
+type diagramItem struct {
+	n     *regexNode // first node of the item
+	label string     // label of items, that do not contain subpatterns; empty otherwise
+}
+
+// diagramItems returns the items of the subpattern.
+func (e *explainer) diagramItems(sp *subPattern) []diagramItem {
+	var items []diagramItem
+
+	for i := 0; i < sp.len(); i++ {
+		n := sp.get(i)
+
+		switch n.opcode {
+		case opLiteral:
+			j := i + 1
+			for j < sp.len() && sp.get(j).opcode == opLiteral {
+				j++
+			}
+
+			var b strings.Builder
+			for _, l := range sp.data[i:j] {
+				b.WriteString(e.char(l.c))
+			}
+
+			items = append(items, diagramItem{n: n, label: e.repr(b.String())})
+			i = j - 1
+		case opBranch, opSubpattern, opAtomicGroup, opAssert, opAssertNot, opGrouprefExists,
+			opMinRepeat, opMaxRepeat, opPossessiveRepeat:
+			items = append(items, diagramItem{n: n})
+		default:
+			items = append(items, diagramItem{n: n, label: e.source(n)})
+		}
+	}
+
+	return items
+}
+
+// source returns the source text of the regex node as valid UTF-8.
+// If the node has no position, the name of its opcode is returned instead.
+func (e *explainer) source(n *regexNode) string {
+	if n.pos == n.end {
+		return n.opcode.String()
+	}
+
+	return strings.ToValidUTF8(e.pattern[n.pos:n.end], "�")
+}
+
+// dotWriter writes the nodes and edges of a Graphviz graph.
+type dotWriter struct {
+	e        *explainer
+	b        strings.Builder
+	level    int // indentation level
+	nodes    int // number of created nodes
+	clusters int // number of created clusters
+}
+
+// line writes a formatted and indented line.
+func (w *dotWriter) line(format string, args ...any) {
+	w.b.WriteString(strings.Repeat("\t", w.level))
+	fmt.Fprintf(&w.b, format, args...)
+	w.b.WriteByte('\n')
+}
+
+// node creates a new node with the attributes and returns its identifier.
+func (w *dotWriter) node(attrs string) string {
+	id := fmt.Sprintf("n%d", w.nodes)
+	w.nodes++
+
+	w.line("%s [%s];", id, attrs)
+	return id
+}
+
+// point creates a new node, that only joins edges.
+func (w *dotWriter) point() string {
+	return w.node("shape=point, width=0.05")
+}
+
+// edge creates a new edge with the attributes, which may be empty.
+func (w *dotWriter) edge(from, to, attrs string) {
+	if attrs == "" {
+		w.line("%s -> %s;", from, to)
+	} else {
+		w.line("%s -> %s [%s];", from, to, attrs)
+	}
+}
+
+// beginCluster starts a new cluster with a label and a style.
+func (w *dotWriter) beginCluster(label, style string) {
+	w.line("subgraph cluster_%d {", w.clusters)
+	w.clusters++
+
+	w.level++
+	w.line("label=%s;", dotQuote(label))
+	w.line("style=%s;", style)
+}
+
+// endCluster ends the current cluster.
+func (w *dotWriter) endCluster() {
+	w.level--
+	w.line("}")
+}
+
+// seq writes the items of the subpattern connected by edges and returns the first and the last node.
+// If the subpattern is empty, a single point is created.
+func (w *dotWriter) seq(sp *subPattern) (string, string) {
+	var in, out string
+
+	for _, item := range w.e.diagramItems(sp) {
+		i, o := w.item(item)
+		if in == "" {
+			in = i
+		} else {
+			w.edge(out, i, "")
+		}
+		out = o
+	}
+
+	if in == "" {
+		in = w.point()
+		out = in
+	}
+
+	return in, out
+}
+
+// item writes a single item and returns its first and last node.
+func (w *dotWriter) item(item diagramItem) (string, string) {
+	n := item.n
+
+	switch n.opcode {
+	case opLiteral:
+		id := w.node("label=" + dotQuote(item.label) + ", style=rounded")
+		return id, id
+	case opAt:
+		id := w.node("label=" + dotQuote(item.label) + ", shape=ellipse")
+		return id, id
+	case opGroupref:
+		id := w.node("label=" + dotQuote(item.label) + ", style=dashed")
+		return id, id
+	case opBranch:
+		split, join := w.point(), w.point()
+
+		for _, alt := range n.params.([]*subPattern) {
+			in, out := w.seq(alt)
+			w.edge(split, in, "")
+			w.edge(out, join, "")
+		}
+
+		return split, join
+	case opSubpattern:
+		p := n.params.(subPatternParam)
+
+		w.beginCluster(w.e.subpattern(p), "solid")
+		in, out := w.seq(p.p)
+		w.endCluster()
+
+		return in, out
+	case opAtomicGroup:
+		w.beginCluster("atomic group", "solid")
+		in, out := w.seq(n.params.(*subPattern))
+		w.endCluster()
+
+		return in, out
+	case opAssert, opAssertNot:
+		p := n.params.(assertParams)
+
+		w.beginCluster(describeAssert(n.opcode, p.dir), "dashed")
+		in, out := w.seq(p.p)
+		w.endCluster()
+
+		return in, out
+	case opGrouprefExists:
+		p := n.params.(grouprefExParam)
+
+		cond := w.node("label=" + dotQuote(w.e.group(p.condgroup)+" matched?") + ", shape=diamond")
+		join := w.point()
+
+		in, out := w.seq(p.itemYes)
+		w.edge(cond, in, `label="yes"`)
+		w.edge(out, join, "")
+
+		if p.itemNo != nil {
+			in, out = w.seq(p.itemNo)
+			w.edge(cond, in, `label="no"`)
+			w.edge(out, join, "")
+		} else {
+			w.edge(cond, join, `label="no"`)
+		}
+
+		return cond, join
+	case opMinRepeat, opMaxRepeat, opPossessiveRepeat:
+		p := n.params.(repeatParams)
+
+		w.beginCluster(repeatTimes(p.min, p.max)+repeatMode(n.opcode), "rounded")
+		start, end := w.point(), w.point()
+		in, out := w.seq(p.item)
+		w.endCluster()
+
+		w.edge(start, in, "")
+		w.edge(out, end, "")
+		if p.max > 1 {
+			w.edge(out, in, "constraint=false, style=dashed")
+		}
+		if p.min == 0 {
+			w.edge(start, end, "style=dashed")
+		}
+
+		return start, end
+	}
+
+	id := w.node("label=" + dotQuote(item.label))
+	return id, id
+}
+
+// dotQuote returns the string as a quoted string of the DOT language.
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+	return `"` + r.Replace(s) + `"`
+}
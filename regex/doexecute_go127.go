@@ -0,0 +1,15 @@
+//go:build go1.27
+
+package regex
+
+import (
+	"io"
+	"regexp"
+	_ "unsafe" // required by go:linkname
+)
+
+// doExecute searches the leftmost match of the regex engine `re` starting at position `pos`.
+// Since Go 1.27, the function `regexp.(*Regexp).doExecute` is named `regexp.(*Regexp).find`.
+//
+//go:linkname doExecute regexp.(*Regexp).find
+func doExecute(re *regexp.Regexp, r io.RuneReader, b []byte, s string, pos int, ncap int, dstCap []int) []int
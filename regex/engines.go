@@ -0,0 +1,299 @@
+package regex
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"sync"
+)
+
+// Capabilities is a set of features, that are either supported by a regex engine or
+// required by a regex pattern.
+type Capabilities uint32
+
+// Available capabilities.
+// The capabilities `CapLongest` and `CapTimeout` describe features of the regex engine and are never
+// required by a regex pattern.
+const (
+	CapLookaround  Capabilities = 1 << iota // lookahead and lookbehind; `(?=...)`, `(?<=...)`, `(?!...)`, `(?<!...)`
+	CapBackrefs                             // backreferences and conditional expressions; `\1`, `(?P=name)`, `(?(1)...)`
+	CapAtomic                               // atomic groups; `(?>...)`
+	CapPossessive                           // possessive repetitions; `?+`, `*+`, `++`, `{...}+`
+	CapLargeRepeat                          // repetitions of type `{m,n}` where `m` or `n` exceeds 1000
+	CapEndString                            // end of the string; `\Z`
+	CapGroupNames                           // group names, that are not valid Go identifiers
+	CapLongest                              // longest match search (see `Engine.SupportsLongest`)
+	CapTimeout                              // timeouts for matching
+)
+
+// capNames contains the names of all capabilities, ordered by their bit index.
+var capNames = [...]string{
+	"lookaround",
+	"backrefs",
+	"atomic",
+	"possessive",
+	"large_repeat",
+	"end_string",
+	"group_names",
+	"longest",
+	"timeout",
+}
+
+// String returns the names of all capabilities, separated by "|".
+func (c Capabilities) String() string {
+	if c == 0 {
+		return "0"
+	}
+
+	var b []byte
+	for i, name := range capNames {
+		if c&(1<<i) != 0 {
+			if len(b) > 0 {
+				b = append(b, '|')
+			}
+			b = append(b, name...)
+		}
+	}
+
+	return string(b)
+}
+
+// Has reports, whether all capabilities of `o` are contained in `c`.
+func (c Capabilities) Has(o Capabilities) bool {
+	return c&o == o
+}
+
+// EngineInfo describes a regex engine, that can be registered with `RegisterEngine`.
+type EngineInfo struct {
+	// Name is the unique name of the regex engine.
+	// It is used in the `Program` of compiled patterns and in cache statistics.
+	Name string
+
+	// Capabilities contains all capabilities supported by the regex engine.
+	Capabilities Capabilities
+
+	// Priority determines, which regex engine is preferred, if multiple engines support
+	// all capabilities required by a pattern. Engines with a higher priority are preferred.
+	// The default engine has a priority of 20, the backtracking engine has a priority of 15
+	// and the fallback engine has a priority of 10.
+	Priority int
+
+	// Compile compiles the parsed regex pattern.
+	Compile func(p *Parsed) (Engine, error)
+
+	// Restore restores a regex engine from a program (see `Restore`).
+	// If Restore is nil, compiled patterns of this engine cannot be restored.
+	Restore func(p *Program) (Engine, error)
+}
+
+var (
+	enginesMu sync.RWMutex  // mutex for the registered regex engines
+	engines   []*EngineInfo // registered regex engines, ordered by priority
+)
+
+func init() {
+	mustRegister(EngineInfo{
+		Name:         EngineStd,
+		Capabilities: CapLongest,
+		Priority:     20,
+		Compile: func(p *Parsed) (Engine, error) {
+			return newStdRegex(p.StdPattern(), p.Flags(), p.IsStr(), p.p.prefilter())
+		},
+		Restore: func(p *Program) (Engine, error) {
+			return newStdRegex(p.Pattern, p.Flags, p.IsStr, p.prefilter())
+		},
+	})
+
+	mustRegister(EngineInfo{
+		Name:         EngineBacktrack,
+		Capabilities: CapLookaround | CapBackrefs | CapAtomic | CapPossessive | CapLargeRepeat | CapEndString | CapGroupNames | CapLongest,
+		Priority:     15,
+		Compile: func(p *Parsed) (Engine, error) {
+			return newBacktrackEngine(p.p), nil
+		},
+		Restore: func(p *Program) (Engine, error) {
+			pp, err := newPreprocessor(p.Pattern, p.IsStr, p.Flags, p.Locale)
+			if err != nil {
+				return nil, err
+			}
+
+			return newBacktrackEngine(pp), nil
+		},
+	})
+
+	mustRegister(EngineInfo{
+		Name:         EngineFallback,
+		Capabilities: CapLookaround | CapBackrefs | CapAtomic | CapLargeRepeat | CapEndString | CapGroupNames | CapTimeout,
+		Priority:     10,
+		Compile: func(p *Parsed) (Engine, error) {
+			return newFallbEngine(p.FallbackPattern(), p.Flags(), p.IsStr(), p.GroupNames(), p.p.prefilter())
+		},
+		Restore: func(p *Program) (Engine, error) {
+			groupNames := p.GroupNames
+			if groupNames == nil {
+				groupNames = make(map[string]int)
+			}
+
+			return newFallbEngine(p.Pattern, p.Flags, p.IsStr, groupNames, p.prefilter())
+		},
+	})
+}
+
+// mustRegister registers a regex engine and panics, if the registration fails.
+func mustRegister(info EngineInfo) {
+	if err := RegisterEngine(info); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterEngine registers an additional regex engine.
+// Whenever a pattern is compiled, the capabilities required by the pattern are determined from the parsed
+// pattern and the registered engine with the highest priority, that supports all of them, is used.
+// If the fallback engine is disabled, only the default engine is used.
+// An error is returned, if the name is empty or already registered or if the compile function is missing.
+func RegisterEngine(info EngineInfo) error {
+	if info.Name == "" {
+		return errors.New("missing engine name")
+	}
+	if info.Compile == nil {
+		return fmt.Errorf("missing compile function for engine %q", info.Name)
+	}
+
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+
+	for _, e := range engines {
+		if e.Name == info.Name {
+			return fmt.Errorf("engine %q is already registered", info.Name)
+		}
+	}
+
+	engines = append(engines, &info)
+
+	// Keep the order of engines with the same priority.
+	sort.SliceStable(engines, func(i, j int) bool {
+		return engines[i].Priority > engines[j].Priority
+	})
+
+	return nil
+}
+
+// UnregisterEngine removes the registered regex engine with the given name and reports, whether it was registered.
+// Patterns, that were already compiled by the engine, remain usable, but programs of the engine can no longer be restored.
+func UnregisterEngine(name string) bool {
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+
+	for i, e := range engines {
+		if e.Name == name {
+			engines = append(engines[:i], engines[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Engines returns descriptions of all registered regex engines, ordered by priority.
+func Engines() []EngineInfo {
+	enginesMu.RLock()
+	defer enginesMu.RUnlock()
+
+	res := make([]EngineInfo, len(engines))
+	for i, e := range engines {
+		res[i] = *e
+	}
+
+	return res
+}
+
+// lookupEngine returns the registered regex engine with the given name or nil, if it does not exist.
+func lookupEngine(name string) *EngineInfo {
+	enginesMu.RLock()
+	defer enginesMu.RUnlock()
+
+	for _, e := range engines {
+		if e.Name == name {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// selectEngine selects the regex engine for a pattern requiring the capabilities `required`.
+// The registered engine with the highest priority, that supports all required capabilities, is selected.
+// If no such engine exists, the engine supporting most of the required capabilities is selected,
+// so the pattern either fails to compile or is compiled with a similar behavior.
+// If the FALLBACK flag is set, the fallback engine is always selected.
+func selectEngine(required Capabilities, flags uint32) *EngineInfo {
+	if flags&FlagFallback != 0 {
+		return lookupEngine(EngineFallback)
+	}
+
+	enginesMu.RLock()
+	defer enginesMu.RUnlock()
+
+	var (
+		best      *EngineInfo
+		bestCount int
+	)
+
+	for _, e := range engines {
+		if e.Capabilities.Has(required) {
+			return e
+		}
+
+		count := bits.OnesCount32(uint32(e.Capabilities & required))
+		if best == nil || count > bestCount {
+			best = e
+			bestCount = count
+		}
+	}
+
+	return best
+}
+
+// Parsed is a parsed regex pattern, that is passed to the compile function of a regex engine.
+// It provides the original regex pattern and the preprocessed regex patterns for the default and the fallback engine.
+type Parsed struct {
+	p *preprocessor
+}
+
+// Flags returns the flags, that were passed or parsed from the regex pattern.
+func (p *Parsed) Flags() uint32 {
+	return p.p.flags()
+}
+
+// Pattern returns the original regex pattern.
+func (p *Parsed) Pattern() string {
+	return p.p.pattern
+}
+
+// IsStr returns, whether the regex pattern is of type `str` instead of `bytes`.
+func (p *Parsed) IsStr() bool {
+	return p.p.isStr
+}
+
+// GroupNames returns a mapping of group names to its indices.
+// The resulting map should not be modified.
+func (p *Parsed) GroupNames() map[string]int {
+	return p.p.groupNames()
+}
+
+// Capabilities returns the capabilities, that a regex engine requires to match the regex pattern.
+func (p *Parsed) Capabilities() Capabilities {
+	return p.p.capabilities()
+}
+
+// StdPattern returns the preprocessed regex pattern in the syntax of `regexp.Regexp`.
+func (p *Parsed) StdPattern() string {
+	return p.p.stdPattern()
+}
+
+// FallbackPattern returns the preprocessed regex pattern in the syntax of `regexp2.Regexp`.
+// The pattern does not contain any group names (see `GroupNames`).
+func (p *Parsed) FallbackPattern() string {
+	return p.p.fallbackPattern()
+}
@@ -0,0 +1,434 @@
+package regex
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/magnetde/starlark-re/util"
+)
+
+// Explain parses the regex pattern and returns a description of the pattern in English.
+// Each line describes a single regex node and starts with the span `[pos:end]` of the node in the pattern.
+// The lines of nested nodes, like the contents of groups, are indented. Unlike the DEBUG dump, consecutive
+// literals are combined and the flags are taken into account.
+// If the pattern is invalid, the parser error is returned.
+func Explain(pattern string, isStr bool, flags uint32) (string, error) {
+	sp, err := parse(pattern, isStr, flags)
+	if err != nil {
+		return "", err
+	}
+
+	e := newExplainer(pattern, sp, isStr)
+
+	e.seq(sp, sp.state.flags, 0)
+	if len(e.lines) == 0 {
+		e.add(0, 0, 0, "the empty string")
+	}
+
+	return e.String(), nil
+}
+
+// explainer builds the lines of the description of a parsed pattern.
+// Its helper methods are also used to label the diagrams of patterns.
+type explainer struct {
+	pattern string
+	isStr   bool
+	names   map[int]string // names of the groups
+	lines   []explainLine
+}
+
+// newExplainer creates a new explainer for the parsed pattern.
+func newExplainer(pattern string, sp *subPattern, isStr bool) *explainer {
+	e := &explainer{
+		pattern: pattern,
+		isStr:   isStr,
+		names:   make(map[int]string, len(sp.state.groupdict)),
+	}
+
+	for name, gid := range sp.state.groupdict {
+		e.names[gid] = name
+	}
+
+	return e
+}
+
+// explainLine is a single line of the description.
+type explainLine struct {
+	pos, end int
+	level    int
+	text     string
+}
+
+// String returns the description with aligned spans.
+func (e *explainer) String() string {
+	spans := make([]string, len(e.lines))
+	width := 0
+
+	for i, l := range e.lines {
+		spans[i] = fmt.Sprintf("[%d:%d]", l.pos, l.end)
+		if len(spans[i]) > width {
+			width = len(spans[i])
+		}
+	}
+
+	var b strings.Builder
+	for i, l := range e.lines {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+
+		fmt.Fprintf(&b, "%-*s %s%s", width, spans[i], strings.Repeat("  ", l.level), l.text)
+	}
+
+	return b.String()
+}
+
+// add adds a line to the description.
+func (e *explainer) add(pos, end, level int, text string) {
+	e.lines = append(e.lines, explainLine{pos: pos, end: end, level: level, text: text})
+}
+
+// seq describes the nodes of a subpattern. All nodes except the first one are prefixed with "then".
+func (e *explainer) seq(sp *subPattern, flags uint32, level int) {
+	for i := 0; i < sp.len(); i++ {
+		n := sp.get(i)
+
+		prefix := ""
+		if i > 0 {
+			prefix = "then "
+		}
+
+		if n.opcode == opLiteral {
+			// combine consecutive literals
+			j := i + 1
+			for j < sp.len() && sp.get(j).opcode == opLiteral {
+				j++
+			}
+
+			var b strings.Builder
+			for _, l := range sp.data[i:j] {
+				b.WriteString(e.char(l.c))
+			}
+
+			e.add(n.pos, sp.get(j-1).end, level, prefix+"literal "+e.repr(b.String())+ignoreCase(flags))
+
+			i = j - 1
+			continue
+		}
+
+		e.node(n, flags, level, prefix)
+	}
+}
+
+// node describes a single regex node, which is not a literal.
+func (e *explainer) node(n *regexNode, flags uint32, level int, prefix string) {
+	if text, _, ok := e.charNode(n, flags); ok {
+		e.add(n.pos, n.end, level, prefix+text)
+		return
+	}
+
+	switch n.opcode {
+	case opAt:
+		e.add(n.pos, n.end, level, prefix+describeAt(n.params.(atcode), flags))
+	case opFailure:
+		e.add(n.pos, n.end, level, prefix+"never matches")
+	case opGroupref:
+		e.add(n.pos, n.end, level, prefix+"the same text as "+e.group(n.params.(int))+ignoreCase(flags))
+	case opBranch:
+		for i, alt := range n.params.([]*subPattern) {
+			text := "or:"
+			if i == 0 {
+				text = prefix + "either:"
+			}
+
+			pos, end := n.pos, n.end
+			if alt.len() > 0 {
+				pos, end = alt.get(0).pos, alt.get(-1).end
+			} else {
+				text = strings.TrimSuffix(text, ":") + " the empty string"
+			}
+
+			e.add(pos, end, level, text)
+			e.seq(alt, flags, level+1)
+		}
+	case opSubpattern:
+		p := n.params.(subPatternParam)
+
+		e.add(n.pos, n.end, level, prefix+e.subpattern(p)+":")
+		e.seq(p.p, combineFlags(flags, p.addFlags, p.delFlags), level+1)
+	case opAtomicGroup:
+		e.add(n.pos, n.end, level, prefix+"atomic group:")
+		e.seq(n.params.(*subPattern), flags, level+1)
+	case opAssert, opAssertNot:
+		p := n.params.(assertParams)
+
+		e.add(n.pos, n.end, level, prefix+describeAssert(n.opcode, p.dir)+":")
+		e.seq(p.p, flags, level+1)
+	case opGrouprefExists:
+		p := n.params.(grouprefExParam)
+
+		e.add(n.pos, n.end, level, prefix+"if "+e.group(p.condgroup)+" matched:")
+		e.seq(p.itemYes, flags, level+1)
+		if p.itemNo != nil {
+			e.add(n.pos, n.end, level, "otherwise:")
+			e.seq(p.itemNo, flags, level+1)
+		}
+	case opMinRepeat, opMaxRepeat, opPossessiveRepeat:
+		e.repeat(n, flags, level, prefix)
+	}
+}
+
+// repeat describes a repeat node. If the repeated item matches a single character, the repeat is described
+// in a single line, like "exactly 4 digits". Otherwise, the repeated item is described in nested lines.
+func (e *explainer) repeat(n *regexNode, flags uint32, level int, prefix string) {
+	p := n.params.(repeatParams)
+	mode := repeatMode(n.opcode)
+
+	if p.item.len() == 1 {
+		item := p.item.get(0)
+
+		singular, plural, ok := e.charNode(item, flags)
+		if item.opcode == opLiteral {
+			c := e.repr(e.char(item.c))
+
+			singular = "literal " + c + ignoreCase(flags)
+			plural = c + " characters" + ignoreCase(flags)
+			ok = true
+		}
+
+		if ok {
+			var text string
+			switch {
+			case p.min == 0 && p.max == 1:
+				text = "optionally " + singular
+			case p.min == 1 && p.max == 1:
+				text = singular
+			default:
+				text = repeatCount(p.min, p.max) + " " + plural
+			}
+
+			e.add(n.pos, n.end, level, prefix+text+mode)
+			return
+		}
+	}
+
+	e.add(n.pos, n.end, level, prefix+repeatTimes(p.min, p.max)+mode+":")
+	e.seq(p.item, flags, level+1)
+}
+
+// repeatMode describes the mode of a repeat, if the repeat is not greedy.
+func repeatMode(op opcode) string {
+	switch op {
+	case opMinRepeat:
+		return " (as few as possible)"
+	case opPossessiveRepeat:
+		return " (possessive)"
+	}
+
+	return ""
+}
+
+// repeatTimes describes, how often an item is repeated.
+func repeatTimes(min, max int) string {
+	if min == 0 && max == 1 {
+		return "optionally"
+	}
+
+	return repeatCount(min, max) + " times"
+}
+
+// repeatCount describes the minimum and maximum number of repetitions.
+func repeatCount(min, max int) string {
+	switch {
+	case min == max:
+		return "exactly " + strconv.Itoa(min)
+	case max == maxRepeat && min == 0:
+		return "zero or more"
+	case max == maxRepeat && min == 1:
+		return "one or more"
+	case max == maxRepeat:
+		return "at least " + strconv.Itoa(min)
+	case min == 0:
+		return "at most " + strconv.Itoa(max)
+	default:
+		return fmt.Sprintf("between %d and %d", min, max)
+	}
+}
+
+// charNode describes a regex node, that matches a single character, in singular and plural form.
+// Literals are not described by this function, because they are described together with the following literals.
+// If the node does not match a single character, false is returned.
+func (e *explainer) charNode(n *regexNode, flags uint32) (string, string, bool) {
+	switch n.opcode {
+	case opNotLiteral:
+		c := e.repr(e.char(n.c)) + ignoreCase(flags)
+		return "a character except " + c, "characters except " + c, true
+	case opAny:
+		if flags&FlagDotAll != 0 {
+			return "any character", "characters", true
+		}
+
+		return "any character except newline", "characters except newline", true
+	case opIn:
+		items := n.params.([]*regexNode)
+
+		if len(items) == 1 && items[0].opcode == opCategory {
+			singular, plural := describeCategory(items[0].params.(catcode))
+			return singular, plural, true
+		}
+
+		negate := false
+		if items[0].opcode == opNegate {
+			negate = true
+			items = items[1:]
+		}
+
+		parts := make([]string, len(items))
+		for i, item := range items {
+			switch item.opcode {
+			case opLiteral:
+				parts[i] = e.repr(e.char(item.c))
+			case opRange:
+				p := item.params.(rangeParams)
+				parts[i] = e.repr(e.char(p.lo)) + "-" + e.repr(e.char(p.hi))
+			case opCategory:
+				_, parts[i] = describeCategory(item.params.(catcode))
+			}
+		}
+
+		set := strings.Join(parts, ", ") + ignoreCase(flags)
+		if negate {
+			return "a character except " + set, "characters except " + set, true
+		}
+
+		return "one of " + set, "characters of " + set, true
+	}
+
+	return "", "", false
+}
+
+// describeCategory describes a category in singular and plural form.
+func describeCategory(c catcode) (string, string) {
+	switch c {
+	case categoryDigit:
+		return "a digit", "digits"
+	case categoryNotDigit:
+		return "a non-digit", "non-digits"
+	case categorySpace:
+		return "a whitespace character", "whitespace characters"
+	case categoryNotSpace:
+		return "a non-whitespace character", "non-whitespace characters"
+	case categoryWord:
+		return "a word character", "word characters"
+	case categoryNotWord:
+		return "a non-word character", "non-word characters"
+	}
+
+	return "", ""
+}
+
+// describeAt describes a position. The meaning of `^` and `$` depends on the MULTILINE flag.
+func describeAt(at atcode, flags uint32) string {
+	multiline := flags&FlagMultiline != 0
+
+	switch at {
+	case atBeginning:
+		if multiline {
+			return "start of a line"
+		}
+
+		return "start of the string"
+	case atBeginningString:
+		return "start of the string"
+	case atBoundary:
+		return "word boundary"
+	case atNonBoundary:
+		return "not a word boundary"
+	case atEnd:
+		if multiline {
+			return "end of a line"
+		}
+
+		return "end of the string or before a newline at the end"
+	case atEndString:
+		return "end of the string"
+	}
+
+	return ""
+}
+
+// subpattern describes a capturing group or a non-capturing group with flags.
+func (e *explainer) subpattern(p subPatternParam) string {
+	var text string
+	if p.group > 0 {
+		text = e.group(p.group)
+	} else {
+		text = "non-capturing group"
+	}
+
+	if p.addFlags != 0 || p.delFlags != 0 {
+		text += " with flags " + flagString(p.addFlags, p.delFlags)
+	}
+
+	return text
+}
+
+// describeAssert describes a lookahead or lookbehind assertion.
+func describeAssert(op opcode, dir int) string {
+	text := "followed by"
+	if dir < 0 {
+		text = "preceded by"
+	}
+	if op == opAssertNot {
+		text = "not " + text
+	}
+
+	return text
+}
+
+// group describes a group by its number and its name, if the group is named.
+func (e *explainer) group(gid int) string {
+	if name, ok := e.names[gid]; ok {
+		return fmt.Sprintf("group %d %s", gid, util.Repr(name, true))
+	}
+
+	return fmt.Sprintf("group %d", gid)
+}
+
+// char returns the character as a string. For bytes patterns, the character is a single byte.
+func (e *explainer) char(c rune) string {
+	if e.isStr {
+		return string(c)
+	}
+
+	return string([]byte{byte(c)})
+}
+
+// repr returns the representation of a string of the pattern.
+func (e *explainer) repr(s string) string {
+	return util.Repr(s, e.isStr)
+}
+
+// ignoreCase returns a suffix for descriptions of characters, if the IGNORECASE flag is set.
+func ignoreCase(flags uint32) string {
+	if flags&FlagIgnoreCase != 0 {
+		return " (ignoring case)"
+	}
+
+	return ""
+}
+
+// flagString returns the inline flags of a group, like "i-x".
+func flagString(addFlags, delFlags uint32) string {
+	var b strings.Builder
+	w := subPatternWriter{w: &b}
+
+	w.writeFlags(addFlags)
+	if delFlags != 0 {
+		b.WriteByte('-')
+		w.writeFlags(delFlags)
+	}
+
+	return b.String()
+}
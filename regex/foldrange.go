@@ -85,6 +85,37 @@ func appendRange(r []rune, lo, hi rune) []rune {
 	return append(r, lo, hi)
 }
 
+// FoldCase returns a function, that maps each character to the smallest character, that is matched with it
+// if cases are ignored. So, two characters are equal ignoring cases, if the function returns the same result.
+// The locale is used for bytes patterns with the LOCALE flag and may be nil.
+func FoldCase(isStr bool, flags uint32, l *Locale) func(c rune) rune {
+	if !isStr && flags&FlagLocale != 0 && l != nil {
+		return func(c rune) rune {
+			if c < 256 {
+				return rune(l.lower[c])
+			}
+
+			return c
+		}
+	}
+
+	fold := simpleFold
+	if flags&FlagASCII != 0 || !isStr {
+		fold = simpleFoldASCII
+	}
+
+	return func(c rune) rune {
+		least := c
+		for f := fold(c); f != c; f = fold(f) {
+			if f < least {
+				least = f
+			}
+		}
+
+		return least
+	}
+}
+
 // simpleFold is the equivalent function of `unicode.SimpleFold`
 // with support for 'U+0130' and 'U+0131' for 'I' and 'i'
 // and for 'U+FB05' and 'U+FB06'
@@ -0,0 +1,311 @@
+package regex
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/magnetde/starlark-re/util"
+)
+
+// maxFormatWidth is the maximum width of a format specification, so padding a group cannot exhaust the memory.
+const maxFormatWidth = 1 << 16
+
+// FormatRule is a rule of a format string. Like a template rule, it either represents a literal or a group index.
+// If the group index is -1, this rule is interpreted as a literal.
+// Group rules may have a conversion (`!r`, `!s` or `!a`) and a format specification like `:>10`.
+type FormatRule struct {
+	Literal    string
+	Group      int
+	Conversion rune   // 'r', 's', 'a' or 0 if there is no conversion
+	Fill       string // fill character of the padding
+	Align      byte   // '<', '>' or '^'
+	Width      int    // minimum width; 0 if there is no minimum width; at most 65536
+	Precision  int    // maximum number of characters; -1 if there is no maximum
+}
+
+// IsLiteral returns, if the rule represents a literal or a group index.
+func (f *FormatRule) IsLiteral() bool {
+	return f.Group < 0
+}
+
+// ParseFormat converts a format string like "{0}: {name!r:>10}" into a list of rules, similar to `ParseTemplate`.
+// The syntax of the format string follows `str.format()` of Python, where the positional fields refer to
+// groups by their index and the named fields refer to groups by their name. Fields without a name are numbered
+// automatically, starting at group 0. Only the string options of the format specification are supported:
+// fill, alignment, width and precision.
+func ParseFormat(r Engine, format string, isString bool) ([]FormatRule, error) {
+	var s source
+	s.init(format, isString)
+
+	var rules []FormatRule
+	var literal strings.Builder
+
+	flushLiteral := func() {
+		if literal.Len() > 0 {
+			rules = append(rules, FormatRule{Literal: literal.String(), Group: -1})
+			literal.Reset()
+		}
+	}
+
+	auto := 0       // next automatic field number
+	manual := false // a field with a group index was found
+
+	for {
+		pos := s.tell()
+
+		c, ok := s.read()
+		if !ok {
+			break
+		}
+
+		switch c {
+		case '{':
+			if s.match('{') {
+				literal.WriteByte('{')
+				continue
+			}
+
+			field, ok := s.skipUntil('}')
+			if !ok {
+				return nil, s.errorp("expected '}' before end of string", pos)
+			}
+			if strings.ContainsRune(field, '{') {
+				return nil, s.errorp("nested replacement fields are not supported", pos)
+			}
+
+			rule, err := parseFormatField(r, &s, field, pos+1)
+			if err != nil {
+				return nil, err
+			}
+
+			if rule.Group < 0 { // automatic field numbering
+				if manual {
+					return nil, s.errorp("cannot switch from manual field specification to automatic field numbering", pos)
+				}
+
+				rule.Group = auto
+				auto++
+
+				if rule.Group > r.SubexpCount() {
+					return nil, s.errorp(fmt.Sprintf("invalid group reference %d", rule.Group), pos)
+				}
+			} else if isDigitString(field[:formatNameEnd(field)]) { // manual field numbering
+				if auto > 0 {
+					return nil, s.errorp("cannot switch from automatic field numbering to manual field specification", pos)
+				}
+
+				manual = true
+			}
+
+			flushLiteral()
+			rules = append(rules, rule)
+		case '}':
+			if !s.match('}') {
+				return nil, s.erroro("single '}' encountered in format string", 1)
+			}
+
+			literal.WriteByte('}')
+		default:
+			literal.WriteString(format[pos:s.tell()])
+		}
+	}
+
+	flushLiteral()
+
+	return rules, nil
+}
+
+// formatNameEnd returns the end of the field name of a replacement field.
+func formatNameEnd(field string) int {
+	if i := strings.IndexAny(field, "!:"); i >= 0 {
+		return i
+	}
+
+	return len(field)
+}
+
+// parseFormatField parses a replacement field of a format string without the braces.
+// The field starts at position `pos` of the format string.
+// If the field has no name, the group of the returned rule is -1.
+func parseFormatField(r Engine, s *source, field string, pos int) (FormatRule, error) {
+	rule := FormatRule{
+		Group:     -1,
+		Fill:      " ",
+		Align:     '<',
+		Precision: -1,
+	}
+
+	end := formatNameEnd(field)
+	name := field[:end]
+	rest := field[end:]
+
+	switch {
+	case name == "":
+	case isDigitString(name):
+		index, err := strconv.ParseUint(name, 10, 32)
+		if err != nil || index > uint64(r.SubexpCount()) {
+			return rule, s.errorp("invalid group reference "+strings.TrimLeft(name, "0"), pos)
+		}
+
+		rule.Group = int(index)
+	default:
+		if !(s.isStr || isASCIIString(name)) || !isIdentifier(name) {
+			return rule, s.errorp("bad character in group name "+util.Repr(name, s.isStr), pos)
+		}
+
+		rule.Group = r.SubexpIndex(name)
+		if rule.Group < 0 {
+			return rule, s.errorp(fmt.Sprintf("unknown group name %s", util.Repr(name, true)), pos)
+		}
+	}
+
+	pos += end
+
+	if strings.HasPrefix(rest, "!") {
+		conv, size := utf8.DecodeRuneInString(rest[1:])
+		if conv != 'r' && conv != 's' && conv != 'a' {
+			return rule, s.errorp(fmt.Sprintf("unknown conversion specifier %s", rest[1:1+size]), pos+1)
+		}
+		if len(rest) > 1+size && rest[1+size] != ':' {
+			return rule, s.errorp("expected ':' after conversion specifier", pos+1+size)
+		}
+
+		rule.Conversion = conv
+		rest = rest[1+size:]
+		pos += 1 + size
+	}
+
+	if strings.HasPrefix(rest, ":") {
+		if err := parseFormatSpec(&rule, rest[1:], s.isStr); err != nil {
+			return rule, s.errorp(err.Error(), pos+1)
+		}
+	}
+
+	return rule, nil
+}
+
+// parseFormatSpec parses the format specification `[[fill]align][0][width][.precision][s]` into the rule.
+// The fill character of bytes formats is a single byte.
+func parseFormatSpec(rule *FormatRule, spec string, isString bool) error {
+	orig := spec
+
+	isAlign := func(c byte) bool {
+		return c == '<' || c == '>' || c == '^'
+	}
+
+	size := 1
+	if isString {
+		_, size = utf8.DecodeRuneInString(spec)
+	}
+
+	filled := false
+	if len(spec) > size && isAlign(spec[size]) {
+		rule.Fill = spec[:size]
+		rule.Align = spec[size]
+		spec = spec[size+1:]
+		filled = true
+	} else if len(spec) > 0 && isAlign(spec[0]) {
+		rule.Align = spec[0]
+		spec = spec[1:]
+	}
+
+	if strings.HasPrefix(spec, "0") {
+		if !filled {
+			rule.Fill = "0"
+		}
+		spec = spec[1:]
+	}
+
+	i := 0
+	for i < len(spec) && isDigitByte(spec[i]) {
+		i++
+	}
+	if i > 0 {
+		width, err := strconv.Atoi(spec[:i])
+		if err != nil || width > maxFormatWidth {
+			return errors.New("too large width in format specifier " + util.Repr(orig, isString))
+		}
+
+		rule.Width = width
+		spec = spec[i:]
+	}
+
+	if strings.HasPrefix(spec, ".") {
+		spec = spec[1:]
+
+		i = 0
+		for i < len(spec) && isDigitByte(spec[i]) {
+			i++
+		}
+		if i == 0 {
+			return errors.New("missing precision in format specifier " + util.Repr(orig, isString))
+		}
+
+		precision, err := strconv.Atoi(spec[:i])
+		if err != nil {
+			return errors.New("too large precision in format specifier " + util.Repr(orig, isString))
+		}
+
+		rule.Precision = precision
+		spec = spec[i:]
+	}
+
+	if spec != "" && spec != "s" {
+		return errors.New("invalid format specifier " + util.Repr(orig, isString) + " for a group")
+	}
+
+	return nil
+}
+
+// Write writes the formatted value of a group to `w`.
+// The value is converted and padded or truncated as specified by the rule.
+// The lengths of strings are counted in characters and the lengths of bytes objects in bytes.
+func (f *FormatRule) Write(w *strings.Builder, value string, isString bool) {
+	switch f.Conversion {
+	case 'r':
+		value = util.Repr(value, isString)
+	case 'a':
+		value = util.ASCII(value, isString)
+	}
+
+	length := len(value)
+	if isString {
+		length = utf8.RuneCountInString(value)
+	}
+
+	if f.Precision >= 0 && length > f.Precision {
+		if isString {
+			i := 0
+			for n := 0; n < f.Precision; n++ {
+				_, size := utf8.DecodeRuneInString(value[i:])
+				i += size
+			}
+			value = value[:i]
+		} else {
+			value = value[:f.Precision]
+		}
+
+		length = f.Precision
+	}
+
+	padding := f.Width - length
+	if padding <= 0 {
+		w.WriteString(value)
+		return
+	}
+
+	left := 0
+	switch f.Align {
+	case '>':
+		left = padding
+	case '^':
+		left = padding / 2
+	}
+
+	w.WriteString(strings.Repeat(f.Fill, left))
+	w.WriteString(value)
+	w.WriteString(strings.Repeat(f.Fill, padding-left))
+}
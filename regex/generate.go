@@ -0,0 +1,326 @@
+package regex
+
+import (
+	"fmt"
+	"math/rand"
+	"unicode/utf8"
+)
+
+const (
+	maxGenerateLength = 1 << 16 // maximum number of bytes of a generated string
+	maxGenerateSteps  = 1 << 18 // maximum number of generated regex nodes per string
+)
+
+// Generator generates random strings from a parsed regex pattern, like examples for tests.
+// It walks the tree of the pattern: branches are chosen randomly, characters are picked from the sets of
+// the regex nodes and repeats are bounded. Printable ASCII characters are preferred, if the set contains any.
+// The generated strings are not guaranteed to match, because lookarounds, positions and atomic groups are
+// ignored; callers should check each string against the compiled pattern.
+// The generator is deterministic for a given seed.
+// Generated strings are limited to 65536 bytes, because the minimums of repeats are not bounded.
+type Generator struct {
+	p         *preprocessor
+	rnd       *rand.Rand
+	maxRepeat int
+
+	steps  int // number of generated regex nodes of the current string
+	buf    []byte
+	groups map[int]string // captured text of the groups
+	chars  []genChar      // generated characters, that may be changed for near misses
+}
+
+// genChar is a generated character, that was picked from a character set.
+type genChar struct {
+	pos, end int // position of the character in the generated string
+	set      *charSet
+}
+
+// printableRanges contains the printable ASCII characters, which are preferred by the generator.
+var printableRanges = []rune{'\t', '\n', ' ', '~'}
+
+// latinRanges contains the printable characters of Latin-1 and Latin Extended-A/B, which are preferred by the
+// generator over all other non-ASCII characters.
+var latinRanges = []rune{0xa0, 0x24f}
+
+// NewGenerator parses the regex pattern and creates a new generator with the seed.
+// Repeats are limited to `maxRepeat` repetitions, unless their minimum is larger.
+// If the pattern is invalid, the parser error is returned. An error is also returned,
+// if the pattern only matches strings, that are longer than the limit of generated strings.
+func NewGenerator(pattern string, isStr bool, flags uint32, seed int64, maxRepeat int) (*Generator, error) {
+	sp, err := parse(pattern, isStr, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	if lo, _ := sp.width(); lo > maxGenerateLength {
+		return nil, fmt.Errorf("the pattern only matches strings longer than %d bytes", maxGenerateLength)
+	}
+
+	if maxRepeat < 0 {
+		maxRepeat = 0
+	}
+
+	g := &Generator{
+		p: &preprocessor{
+			pattern: pattern,
+			isStr:   isStr,
+			p:       sp,
+		},
+		rnd:       rand.New(rand.NewSource(seed)),
+		maxRepeat: maxRepeat,
+	}
+
+	return g, nil
+}
+
+// CanMatch reports, whether the pattern may match any string. It is false for patterns like `(?!)`,
+// for which each call of `Match` fails. Lookarounds and group references are assumed to be matchable.
+func (g *Generator) CanMatch() bool {
+	return g.canMatchSeq(g.p.p, g.p.p.state.flags)
+}
+
+// canMatchSeq reports, whether all nodes of the subpattern may match.
+func (g *Generator) canMatchSeq(sp *subPattern, flags uint32) bool {
+	for _, n := range sp.data {
+		if !g.canMatch(n, flags) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// canMatch reports, whether the regex node may match.
+func (g *Generator) canMatch(n *regexNode, flags uint32) bool {
+	if set := g.p.compileCharSet(n, flags); set != nil {
+		return len(g.candidates(set)) > 0
+	}
+
+	switch n.opcode {
+	case opFailure:
+		return false
+	case opBranch:
+		for _, alt := range n.params.([]*subPattern) {
+			if g.canMatchSeq(alt, flags) {
+				return true
+			}
+		}
+
+		return false
+	case opSubpattern:
+		p := n.params.(subPatternParam)
+		return g.canMatchSeq(p.p, combineFlags(flags, p.addFlags, p.delFlags))
+	case opAtomicGroup:
+		return g.canMatchSeq(n.params.(*subPattern), flags)
+	case opGrouprefExists:
+		p := n.params.(grouprefExParam)
+		return g.canMatchSeq(p.itemYes, flags) || p.itemNo == nil || g.canMatchSeq(p.itemNo, flags)
+	case opMinRepeat, opMaxRepeat, opPossessiveRepeat:
+		p := n.params.(repeatParams)
+		return p.min == 0 || g.canMatchSeq(p.item, flags)
+	}
+
+	return true
+}
+
+// Match generates a string, that is likely matched by the pattern.
+// If the generation fails, like for a group reference to an unmatched group or a string exceeding
+// the length limit, false is returned. Since branches and repeats are chosen randomly, the next call may
+// succeed, unless the pattern cannot match any string at all (see `CanMatch`).
+func (g *Generator) Match() (string, bool) {
+	g.steps = 0
+	g.buf = g.buf[:0]
+	g.groups = make(map[int]string)
+	g.chars = g.chars[:0]
+
+	if !g.seq(g.p.p, g.p.p.state.flags) {
+		return "", false
+	}
+
+	return string(g.buf), true
+}
+
+// NearMiss generates a string, that is likely not matched by the pattern, but is similar to a matching string.
+// The string is created from a matching string by replacing a character with a character outside of its set,
+// removing a character or repeating a character. Strings of patterns without any characters are extended by
+// a single character.
+func (g *Generator) NearMiss() (string, bool) {
+	s, ok := g.Match()
+	if !ok {
+		return "", false
+	}
+
+	if len(g.chars) == 0 {
+		return s + g.pickString(&charSet{r: printableRanges}), true
+	}
+
+	c := g.chars[g.rnd.Intn(len(g.chars))]
+
+	switch g.rnd.Intn(3) {
+	case 0:
+		if r := g.pickString(&charSet{r: c.set.r, negate: !c.set.negate}); r != "" {
+			return s[:c.pos] + r + s[c.end:], true
+		}
+
+		fallthrough
+	case 1:
+		return s[:c.pos] + s[c.end:], true
+	default:
+		return s[:c.end] + s[c.pos:], true
+	}
+}
+
+// seq generates the nodes of the subpattern and reports, whether this was possible.
+func (g *Generator) seq(sp *subPattern, flags uint32) bool {
+	for _, n := range sp.data {
+		if !g.node(n, flags) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// node generates a single regex node and reports, whether this was possible.
+func (g *Generator) node(n *regexNode, flags uint32) bool {
+	g.steps++
+	if g.steps > maxGenerateSteps || len(g.buf) > maxGenerateLength {
+		return false
+	}
+
+	if set := g.p.compileCharSet(n, flags); set != nil {
+		s := g.pickString(set)
+		if s == "" {
+			return false
+		}
+
+		g.chars = append(g.chars, genChar{pos: len(g.buf), end: len(g.buf) + len(s), set: set})
+		g.buf = append(g.buf, s...)
+		return true
+	}
+
+	switch n.opcode {
+	case opFailure:
+		return false
+	case opGroupref:
+		s, ok := g.groups[n.params.(int)]
+		if ok {
+			g.buf = append(g.buf, s...)
+		}
+
+		return ok
+	case opBranch:
+		alts := n.params.([]*subPattern)
+		return g.seq(alts[g.rnd.Intn(len(alts))], flags)
+	case opSubpattern:
+		p := n.params.(subPatternParam)
+
+		start := len(g.buf)
+		if !g.seq(p.p, combineFlags(flags, p.addFlags, p.delFlags)) {
+			return false
+		}
+
+		if p.group > 0 {
+			g.groups[p.group] = string(g.buf[start:])
+		}
+
+		return true
+	case opAtomicGroup:
+		return g.seq(n.params.(*subPattern), flags)
+	case opGrouprefExists:
+		p := n.params.(grouprefExParam)
+
+		if _, ok := g.groups[p.condgroup]; ok {
+			return g.seq(p.itemYes, flags)
+		}
+		if p.itemNo != nil {
+			return g.seq(p.itemNo, flags)
+		}
+
+		return true
+	case opMinRepeat, opMaxRepeat, opPossessiveRepeat:
+		p := n.params.(repeatParams)
+
+		hi := p.max
+		if hi > g.maxRepeat {
+			hi = maxInt(g.maxRepeat, p.min)
+		}
+
+		count := p.min + g.rnd.Intn(hi-p.min+1)
+		for i := 0; i < count; i++ {
+			if !g.seq(p.item, flags) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	// positions and lookarounds do not generate any characters
+	return true
+}
+
+// pickString picks a random character of the set and returns it encoded as a string.
+// If the set is empty, an empty string is returned.
+func (g *Generator) pickString(set *charSet) string {
+	r := g.candidates(set)
+	if len(r) == 0 {
+		return ""
+	}
+
+	// pick a range and a character of it
+	i := 2 * g.rnd.Intn(len(r)/2)
+	c := r[i] + rune(g.rnd.Int63n(int64(r[i+1]-r[i])+1))
+
+	if !g.p.isStr {
+		return string([]byte{byte(c)})
+	}
+
+	return string(c)
+}
+
+// candidates returns the ranges of the set, from which characters are picked.
+// Characters of printable ASCII are preferred, followed by printable Latin characters.
+func (g *Generator) candidates(set *charSet) []rune {
+	all := []rune{0, 0xd7ff, 0xe000, utf8.MaxRune} // without surrogates
+	if !g.p.isStr {
+		all = []rune{0, 0xff}
+	}
+
+	r := intersectRanges(set.ranges(), printableRanges)
+	if len(r) == 0 {
+		r = intersectRanges(set.ranges(), latinRanges)
+	}
+	if len(r) == 0 {
+		r = intersectRanges(set.ranges(), all)
+	}
+
+	return r
+}
+
+// intersectRanges returns the intersection of the sorted and non-overlapping ranges.
+func intersectRanges(a, b []rune) []rune {
+	var res []rune
+
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		lo, hi := a[i], a[i+1]
+		if b[j] > lo {
+			lo = b[j]
+		}
+		if b[j+1] < hi {
+			hi = b[j+1]
+		}
+
+		if lo <= hi {
+			res = append(res, lo, hi)
+		}
+
+		if a[i+1] < b[j+1] {
+			i += 2
+		} else {
+			j += 2
+		}
+	}
+
+	return res
+}
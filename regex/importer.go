@@ -0,0 +1,1886 @@
+package regex
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ImportPattern converts a pattern of the regex dialect into a Python pattern with the same semantics and returns
+// it together with the flags, that the Python pattern must be compiled with. The supported dialects are RE2, PCRE
+// and ECMAScript (see `LookupDialect`). ECMAScript and PCRE patterns may be regex literals like `/\d+/gi`.
+// Constructs, that behave differently in Python, are rewritten: for example, `\d` only matches ASCII digits in
+// all three dialects, `$` only matches at the end of the string in RE2 and ECMAScript and case-insensitive
+// ECMAScript patterns only match "ſ" (U+017F) and the Kelvin sign with ASCII letters in unicode mode.
+// If the dialect has a construct without a Python equivalent, like recursion in PCRE or the sticky flag of
+// ECMAScript, an error is returned, that names the construct and its position.
+func ImportPattern(pattern string, isStr bool, dialect string) (string, uint32, error) {
+	d, err := LookupDialect(dialect)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if d == DialectDotNet {
+		return "", 0, fmt.Errorf("cannot import patterns from %s", dialectNames[d])
+	}
+
+	im := importer{
+		dialect: d,
+		s:       pattern,
+		end:     len(pattern),
+		isStr:   isStr,
+		closed:  make(map[int]bool),
+		names:   make(map[string]int),
+		refEnd:  -1,
+	}
+
+	if err := im.literalFlags(); err != nil {
+		return "", 0, err
+	}
+
+	im.countGroups()
+
+	im.ignoreCase = im.flags&FlagIgnoreCase != 0
+	im.stack = []importGroup{{ignoreCase: im.ignoreCase}}
+
+	if err := im.run(); err != nil {
+		return "", 0, err
+	}
+
+	var flags uint32
+	if im.stack[0].ignoreCase {
+		flags |= FlagIgnoreCase
+	}
+
+	return im.b.String(), flags, nil
+}
+
+// importer converts a pattern of another regex dialect into Python syntax.
+// The flags of the dialect are resolved while converting the pattern: anchors and dots are written with the
+// semantics of the current flags and verbose patterns are written without whitespace and comments. Only the
+// IGNORECASE flag is written into the Python pattern as a flag group like `(?i:...)`.
+type importer struct {
+	dialect string
+	s       string // the pattern, including the delimiters of a regex literal
+	pos     int    // current position in `s`
+	end     int    // end of the pattern source in `s`
+	isStr   bool
+	b       strings.Builder
+
+	flags   uint32 // current flags of the dialect; IGNORECASE, MULTILINE, DOTALL and VERBOSE
+	unicode bool   // whether the "u" flag of ECMAScript is set
+	ucp     bool   // whether the PCRE pattern starts with "(*UCP)", so categories match unicode characters
+
+	groups int            // number of capturing groups of the pattern
+	named  bool           // whether the pattern has named groups
+	opened int            // number of capturing groups opened so far
+	closed map[int]bool   // capturing groups, that are already closed
+	names  map[string]int // group numbers of the named groups opened so far
+
+	stack      []importGroup // open groups; the first element is the whole pattern
+	ignoreCase bool          // whether the written pattern ignores cases at the current position
+	refEnd     int           // end of the last numeric backreference in the written pattern
+}
+
+// importGroup is a group of the imported pattern, that is currently open.
+type importGroup struct {
+	pos        int    // position of the group in the pattern
+	flags      uint32 // flags of the dialect before the group
+	ignoreCase bool   // whether the written pattern ignores cases at the start of the group
+	outer      bool   // whether the written pattern ignores cases before the group
+	group      int    // number of the capturing group or 0
+	flagGroups int    // number of flag groups written for inline flags, like "(?i)", that end with the branch
+}
+
+// importAtom is an escape of the imported pattern, that is either a character,
+// a character set or Python pattern text, like a backreference.
+type importAtom struct {
+	char   bool   // whether the atom is the character `c`
+	c      rune   // character of the atom
+	set    []rune // ranges of a character set
+	negate bool   // whether the character set is negated
+	text   string // Python pattern text of the atom; for character sets, a Python category like `\d`
+	ref    bool   // whether the text is a numeric backreference, that must not be followed by a digit
+}
+
+// Ranges of the ASCII categories and the whitespace characters of ECMAScript.
+var (
+	asciiDigitRanges = []rune{'0', '9'}
+	asciiWordRanges  = []rune{'0', '9', 'A', 'Z', '_', '_', 'a', 'z'}
+	pcreSpaceRanges  = []rune{'\t', '\r', ' ', ' '}
+	re2SpaceRanges   = []rune{'\t', '\n', '\f', '\r', ' ', ' '}
+	jsSpaceRanges    = []rune{
+		'\t', '\r', ' ', ' ', 0xa0, 0xa0, 0x1680, 0x1680, 0x2000, 0x200a, 0x2028, 0x2029,
+		0x202f, 0x202f, 0x205f, 0x205f, 0x3000, 0x3000, 0xfeff, 0xfeff,
+	}
+	pcreHSpaceRanges = []rune{
+		'\t', '\t', ' ', ' ', 0xa0, 0xa0, 0x1680, 0x1680, 0x180e, 0x180e, 0x2000, 0x200a,
+		0x202f, 0x202f, 0x205f, 0x205f, 0x3000, 0x3000,
+	}
+	pcreVSpaceRanges = []rune{'\n', '\r', 0x85, 0x85, 0x2028, 0x2029}
+)
+
+// foldGroups contains the characters, that Python matches with ASCII letters, if cases are ignored.
+// Each group starts with the upper and lower case ASCII letter. ECMAScript only matches the non-ASCII characters
+// with the ASCII letters in unicode mode and only for "ſ" (U+017F) and the Kelvin sign (U+212A).
+var foldGroups = [][]rune{
+	{'I', 'i', 0x130, 0x131},
+	{'K', 'k', 0x212a},
+	{'S', 's', 0x17f},
+}
+
+// jsWordRanges contains the word characters of ECMAScript in unicode mode, if cases are ignored.
+var jsWordRanges = []rune{'0', '9', 'A', 'Z', '_', '_', 'a', 'z', 0x17f, 0x17f, 0x212a, 0x212a}
+
+// posixClasses contains the ranges of the POSIX character classes like `[:alpha:]`.
+var posixClasses = map[string][]rune{
+	"alnum":  {'0', '9', 'A', 'Z', 'a', 'z'},
+	"alpha":  {'A', 'Z', 'a', 'z'},
+	"ascii":  {0, 0x7f},
+	"blank":  {'\t', '\t', ' ', ' '},
+	"cntrl":  {0, 0x1f, 0x7f, 0x7f},
+	"digit":  {'0', '9'},
+	"graph":  {'!', '~'},
+	"lower":  {'a', 'z'},
+	"print":  {' ', '~'},
+	"punct":  {'!', '/', ':', '@', '[', '`', '{', '~'},
+	"space":  {'\t', '\r', ' ', ' '},
+	"upper":  {'A', 'Z'},
+	"word":   {'0', '9', 'A', 'Z', '_', '_', 'a', 'z'},
+	"xdigit": {'0', '9', 'A', 'F', 'a', 'f'},
+}
+
+// generalCategories contains the long names of the unicode general categories.
+var generalCategories = map[string]string{
+	"Letter": "L", "Cased_Letter": "LC", "Uppercase_Letter": "Lu", "Lowercase_Letter": "Ll",
+	"Titlecase_Letter": "Lt", "Modifier_Letter": "Lm", "Other_Letter": "Lo",
+	"Mark": "M", "Nonspacing_Mark": "Mn", "Spacing_Mark": "Mc", "Enclosing_Mark": "Me",
+	"Number": "N", "Decimal_Number": "Nd", "Letter_Number": "Nl", "Other_Number": "No",
+	"Punctuation": "P", "Connector_Punctuation": "Pc", "Dash_Punctuation": "Pd", "Open_Punctuation": "Ps",
+	"Close_Punctuation": "Pe", "Initial_Punctuation": "Pi", "Final_Punctuation": "Pf", "Other_Punctuation": "Po",
+	"Symbol": "S", "Math_Symbol": "Sm", "Currency_Symbol": "Sc", "Modifier_Symbol": "Sk", "Other_Symbol": "So",
+	"Separator": "Z", "Space_Separator": "Zs", "Line_Separator": "Zl", "Paragraph_Separator": "Zp",
+	"Other": "C", "Control": "Cc", "Format": "Cf", "Surrogate": "Cs", "Private_Use": "Co", "Unassigned": "Cn",
+}
+
+// Quantifiers of the dialects.
+var (
+	quantifierPattern     = regexp.MustCompile(`^\{[0-9]+(,[0-9]*)?\}`)
+	pcreQuantifierPattern = regexp.MustCompile(`^\{([0-9]+(,[0-9]*)?|,[0-9]+)\}`)
+)
+
+// errorf returns an error for the construct at the position, that cannot be imported.
+func (im *importer) errorf(pos int, construct string, args ...any) error {
+	construct = fmt.Sprintf(construct, args...)
+	return fmt.Errorf("cannot import %s at position %d from %s", construct, pos, dialectNames[im.dialect])
+}
+
+// literalFlags parses the flags of a regex literal like `/abc/gi`, if the pattern is one.
+// Regex literals are only supported by ECMAScript and PCRE.
+func (im *importer) literalFlags() error {
+	if im.dialect == DialectRE2 || !strings.HasPrefix(im.s, "/") {
+		return nil
+	}
+
+	end := strings.LastIndexByte(im.s, '/')
+	if end == 0 {
+		return im.errorf(0, "regex literal without a closing /")
+	}
+
+	im.pos, im.end = 1, end
+
+	for i, c := range im.s[end+1:] {
+		pos := end + 1 + i
+
+		switch {
+		case c == 'g' || c == 'd':
+			// global searches and match indices do not change the pattern
+			if c == 'd' && im.dialect != DialectECMAScript {
+				return im.errorf(pos, "flag %q", string(c))
+			}
+		case c == 'i':
+			im.flags |= FlagIgnoreCase
+		case c == 'm':
+			im.flags |= FlagMultiline
+		case c == 's':
+			im.flags |= FlagDotAll
+		case c == 'x' && im.dialect == DialectPCRE:
+			im.flags |= FlagVerbose
+		case c == 'u':
+			im.unicode = true
+		case c == 'y' && im.dialect == DialectECMAScript:
+			return im.errorf(pos, "sticky flag %q", string(c))
+		default:
+			return im.errorf(pos, "flag %q", string(c))
+		}
+	}
+
+	return nil
+}
+
+// countGroups counts the capturing groups of the pattern, because some escapes like `\10` are backreferences only
+// if the pattern has enough groups.
+func (im *importer) countGroups() {
+	s := im.s[:im.end]
+	inSet := false
+
+	for i := im.pos; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			inSet = true
+		case ']':
+			inSet = false
+		case '(':
+			if inSet {
+				break
+			}
+
+			rest := s[i+1:]
+			switch {
+			case !strings.HasPrefix(rest, "?") && !strings.HasPrefix(rest, "*"):
+				im.groups++
+			case strings.HasPrefix(rest, "?P<"), strings.HasPrefix(rest, "?'"),
+				strings.HasPrefix(rest, "?<") && !strings.HasPrefix(rest, "?<=") && !strings.HasPrefix(rest, "?<!"):
+				im.groups++
+				im.named = true
+			}
+		}
+	}
+}
+
+// run converts the pattern source.
+func (im *importer) run() error {
+	for im.pos < im.end {
+		c, size := utf8.DecodeRuneInString(im.s[im.pos:])
+
+		if im.flags&FlagVerbose != 0 && im.skipVerbose(c) {
+			continue
+		}
+
+		var err error
+
+		switch c {
+		case '\\':
+			err = im.escape()
+		case '[':
+			err = im.class()
+		case '(':
+			err = im.open()
+		case ')':
+			err = im.close()
+		case '|':
+			im.alternate()
+			im.pos++
+		case '.':
+			im.dot()
+			im.pos++
+		case '^':
+			im.caret()
+			im.pos++
+		case '$':
+			im.dollar()
+			im.pos++
+		case '*', '+', '?':
+			im.b.WriteRune(c)
+			im.pos++
+		case '{':
+			im.brace()
+		default:
+			err = im.literal(im.pos, c)
+			im.pos += size
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(im.stack) > 1 {
+		return im.errorf(im.stack[len(im.stack)-1].pos, "unterminated group")
+	}
+
+	im.closeFlagGroups(&im.stack[0])
+
+	return nil
+}
+
+// skipVerbose skips whitespace and comments of verbose patterns and reports, whether the character was skipped.
+func (im *importer) skipVerbose(c rune) bool {
+	switch c {
+	case ' ', '\t', '\n', '\r', '\f', '\v':
+		im.pos++
+		return true
+	case '#':
+		if i := strings.IndexByte(im.s[im.pos:im.end], '\n'); i >= 0 {
+			im.pos += i + 1
+		} else {
+			im.pos = im.end
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// top returns the innermost open group.
+func (im *importer) top() *importGroup {
+	return &im.stack[len(im.stack)-1]
+}
+
+// writeIgnoreCase writes a flag group, if the IGNORECASE flag of the dialect differs from the written pattern.
+// It reports, whether a group was written.
+func (im *importer) writeIgnoreCase(group string) bool {
+	ignoreCase := im.flags&FlagIgnoreCase != 0
+	if ignoreCase == im.ignoreCase {
+		if group != "" {
+			im.b.WriteString("(?:")
+		}
+
+		return false
+	}
+
+	if ignoreCase {
+		im.b.WriteString("(?i:")
+	} else {
+		im.b.WriteString("(?-i:")
+	}
+	im.ignoreCase = ignoreCase
+
+	return true
+}
+
+// closeFlagGroups closes the flag groups of the current branch of the group.
+func (im *importer) closeFlagGroups(g *importGroup) {
+	for ; g.flagGroups > 0; g.flagGroups-- {
+		im.b.WriteByte(')')
+	}
+
+	im.ignoreCase = g.ignoreCase
+}
+
+// alternate writes the start of a new branch. In PCRE and RE2, inline flags also apply to the following branches
+// of the group, so the flag groups are closed before the branch and opened again after the branch.
+func (im *importer) alternate() {
+	g := im.top()
+
+	im.closeFlagGroups(g)
+	im.b.WriteByte('|')
+
+	if im.writeIgnoreCase("") {
+		g.flagGroups++
+	}
+}
+
+// dot writes the dot with the semantics of the dialect.
+// The dot of ECMAScript does not match any line terminators.
+func (im *importer) dot() {
+	switch {
+	case im.flags&FlagDotAll != 0:
+		im.b.WriteString("(?s:.)")
+	case im.dialect == DialectECMAScript && im.isStr:
+		im.b.WriteString(`[^\n\r\u2028\u2029]`)
+	case im.dialect == DialectECMAScript:
+		im.b.WriteString(`[^\n\r]`)
+	default:
+		im.b.WriteByte('.')
+	}
+}
+
+// caret writes the start anchor with the semantics of the dialect.
+func (im *importer) caret() {
+	switch {
+	case im.flags&FlagMultiline == 0:
+		im.b.WriteByte('^')
+	case im.dialect == DialectECMAScript:
+		im.b.WriteString(`(?<!` + im.lineTerminators() + `)`)
+	default:
+		im.b.WriteString("(?m:^)")
+	}
+}
+
+// dollar writes the end anchor with the semantics of the dialect.
+// Without the MULTILINE flag, only the anchor of PCRE also matches before a newline at the end of the string.
+func (im *importer) dollar() {
+	switch {
+	case im.flags&FlagMultiline != 0 && im.dialect == DialectECMAScript:
+		im.b.WriteString(`(?!` + im.lineTerminators() + `)`)
+	case im.flags&FlagMultiline != 0:
+		im.b.WriteString("(?m:$)")
+	case im.dialect == DialectPCRE:
+		im.b.WriteByte('$')
+	default:
+		im.b.WriteString(`\Z`)
+	}
+}
+
+// lineTerminators returns a character set of all characters except the line terminators of ECMAScript.
+func (im *importer) lineTerminators() string {
+	if !im.isStr {
+		return `[^\n\r]`
+	}
+
+	return `[^\n\r\u2028\u2029]`
+}
+
+// brace writes a quantifier like `{2,5}` or a literal brace.
+func (im *importer) brace() {
+	q := quantifierPattern
+	if im.dialect == DialectPCRE {
+		q = pcreQuantifierPattern
+	}
+
+	if m := q.FindString(im.s[im.pos:im.end]); m != "" {
+		im.b.WriteString(m)
+		im.pos += len(m)
+		return
+	}
+
+	im.b.WriteString(`\{`)
+	im.pos++
+}
+
+// literal writes the character at the position as a literal outside of character sets.
+func (im *importer) literal(pos int, c rune) error {
+	if !im.isStr && c > 0xff {
+		return im.errorf(pos, "character U+%04X in a bytes pattern", c)
+	}
+
+	if c >= '0' && c <= '9' && im.b.Len() == im.refEnd {
+		fmt.Fprintf(&im.b, `\x%02x`, c) // the digit would continue the backreference
+		return nil
+	}
+
+	if im.writeFoldedSet(importAtom{set: []rune{c, c}}) {
+		return nil
+	}
+
+	writeImportedLiteral(&im.b, c, im.isStr)
+	return nil
+}
+
+// writeImportedLiteral writes the character escaped for Python patterns.
+// All ASCII punctuation characters are escaped, so the character is a literal inside and outside of character sets.
+func writeImportedLiteral(b *strings.Builder, c rune, isStr bool) {
+	switch {
+	case c < utf8.RuneSelf && (unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_'):
+		b.WriteRune(c)
+	case c < utf8.RuneSelf && (unicode.IsPunct(c) || unicode.IsSymbol(c) || c == ' '):
+		b.WriteByte('\\')
+		b.WriteRune(c)
+	case c <= 0xff && (!isStr || !unicode.IsPrint(c)):
+		fmt.Fprintf(b, `\x%02x`, c)
+	case unicode.IsPrint(c):
+		b.WriteRune(c)
+	case c <= 0xffff:
+		fmt.Fprintf(b, `\u%04x`, c)
+	default:
+		fmt.Fprintf(b, `\U%08x`, c)
+	}
+}
+
+// writeImportedSet writes the ranges of a character set as a Python character set.
+func (im *importer) writeImportedSet(a importAtom) {
+	if a.text != "" {
+		im.b.WriteString(a.text)
+		return
+	}
+
+	if !im.writeFoldedSet(a) {
+		im.writeSetRanges(a)
+	}
+}
+
+// writeSetRanges writes the ranges of a character set as a Python character set without a category.
+func (im *importer) writeSetRanges(a importAtom) {
+	if len(a.set) == 0 {
+		if a.negate {
+			im.b.WriteString("(?s:.)")
+		} else {
+			im.b.WriteString("(?!)")
+		}
+
+		return
+	}
+
+	im.b.WriteByte('[')
+	if a.negate {
+		im.b.WriteByte('^')
+	}
+	im.writeRanges(a.set)
+	im.b.WriteByte(']')
+}
+
+// splitFoldGroups returns the groups of `foldGroups`, whose characters are not all matched with each other
+// by ECMAScript, if cases are ignored. Other dialects match the characters like Python.
+func (im *importer) splitFoldGroups() [][]rune {
+	if im.dialect != DialectECMAScript || !im.isStr || im.flags&FlagIgnoreCase == 0 {
+		return nil
+	}
+	if im.unicode {
+		return foldGroups[:1]
+	}
+
+	return foldGroups
+}
+
+// writeFoldedSet writes the character set, if it contains characters, that are matched with different characters
+// by Python and ECMAScript, if cases are ignored. It reports, whether the set was written. The characters of the
+// affected groups are removed from the set and written as a separate case-sensitive set.
+func (im *importer) writeFoldedSet(a importAtom) bool {
+	groups := im.splitFoldGroups()
+
+	var all, matched []rune // all characters of the groups and the characters matched by ECMAScript
+	for _, g := range groups {
+		for _, c := range g {
+			// Only the ASCII letters are matched with each other.
+			class := []rune{c}
+			if c < utf8.RuneSelf {
+				class = g[:2]
+			}
+
+			found := false
+			for _, x := range class {
+				found = found || containsRune(a.set, x)
+			}
+
+			all = append(all, c, c)
+			if found != a.negate {
+				matched = append(matched, c, c)
+			}
+		}
+	}
+
+	all = normalizeRanges(all)
+	if len(intersectRanges(a.set, all)) == 0 {
+		return false
+	}
+
+	// Python ignores cases in the remaining set, but none of its characters are matched with the groups.
+	rest := importAtom{set: intersectRanges(a.set, negateRanges(all)), negate: a.negate}
+	if a.negate {
+		rest.set = normalizeRanges(append(rest.set, all...))
+	}
+
+	matched = normalizeRanges(matched)
+
+	switch {
+	case len(matched) == 0:
+		im.writeSetRanges(rest)
+	case !rest.negate && len(rest.set) == 0:
+		im.b.WriteString("(?-i:[")
+		im.writeRanges(matched)
+		im.b.WriteString("])")
+	default:
+		im.b.WriteString("(?:")
+		im.writeSetRanges(rest)
+		im.b.WriteString("|(?-i:[")
+		im.writeRanges(matched)
+		im.b.WriteString("]))")
+	}
+
+	return true
+}
+
+// containsRune reports, whether the sorted ranges contain the character.
+func containsRune(r []rune, c rune) bool {
+	for i := 0; i < len(r); i += 2 {
+		if c >= r[i] && c <= r[i+1] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeRanges writes the ranges as items of a Python character set.
+func (im *importer) writeRanges(r []rune) {
+	for i := 0; i < len(r); i += 2 {
+		writeImportedLiteral(&im.b, r[i], im.isStr)
+		if r[i] != r[i+1] {
+			im.b.WriteByte('-')
+			writeImportedLiteral(&im.b, r[i+1], im.isStr)
+		}
+	}
+}
+
+// setRanges returns the ranges of the character set atom. Negated sets are inverted.
+func (im *importer) setRanges(a importAtom) []rune {
+	if !a.negate {
+		return a.set
+	}
+
+	r := negateRanges(a.set)
+	if !im.isStr {
+		r = intersectRanges(r, []rune{0, 0xff})
+	}
+
+	return r
+}
+
+// escape writes the escape sequence outside of character sets.
+func (im *importer) escape() error {
+	start := im.pos
+
+	if strings.HasPrefix(im.s[im.pos:im.end], `\Q`) && im.dialect != DialectECMAScript {
+		return im.quote(func(c rune) error { return im.literal(im.pos, c) })
+	}
+	if strings.HasPrefix(im.s[im.pos:im.end], `\E`) && im.dialect != DialectECMAScript {
+		im.pos += 2 // stray ends of quoted sequences are ignored
+		return nil
+	}
+
+	a, err := im.parseEscape(false)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case a.char:
+		return im.literal(start, a.c)
+	case a.set != nil:
+		im.writeImportedSet(a)
+	default:
+		im.b.WriteString(a.text)
+
+		if a.ref {
+			im.refEnd = im.b.Len()
+		}
+	}
+
+	return nil
+}
+
+// quote writes the literal characters of a quoted sequence `\Q...\E`.
+func (im *importer) quote(literal func(c rune) error) error {
+	im.pos += 2
+
+	for im.pos < im.end {
+		if strings.HasPrefix(im.s[im.pos:im.end], `\E`) {
+			im.pos += 2
+			break
+		}
+
+		c, size := utf8.DecodeRuneInString(im.s[im.pos:])
+		if err := literal(c); err != nil {
+			return err
+		}
+
+		im.pos += size
+	}
+
+	return nil
+}
+
+// parseEscape parses an escape sequence and returns its atom.
+func (im *importer) parseEscape(inSet bool) (importAtom, error) {
+	start := im.pos
+	im.pos++ // skip the backslash
+
+	if im.pos >= im.end {
+		return importAtom{}, im.errorf(start, "trailing backslash")
+	}
+
+	c, size := utf8.DecodeRuneInString(im.s[im.pos:])
+	im.pos += size
+
+	js := im.dialect == DialectECMAScript
+	pcre := im.dialect == DialectPCRE
+	re2 := im.dialect == DialectRE2
+	strict := !js || im.unicode // whether unknown escapes are errors
+
+	char := func(c rune) (importAtom, error) { return importAtom{char: true, c: c}, nil }
+	text := func(s string) (importAtom, error) { return importAtom{text: s}, nil }
+
+	switch c {
+	case 'd', 'D', 'w', 'W', 's', 'S':
+		return im.category(c), nil
+	case 'h', 'H':
+		if pcre {
+			return importAtom{set: pcreHSpaceRanges, negate: c == 'H'}, nil
+		}
+	case 'v', 'V':
+		if pcre {
+			return importAtom{set: pcreVSpaceRanges, negate: c == 'V'}, nil
+		}
+		if c == 'v' {
+			return char('\v')
+		}
+	case 'N':
+		if pcre && !inSet {
+			if strings.HasPrefix(im.s[im.pos:im.end], "{U+") {
+				if end := strings.IndexByte(im.s[im.pos:im.end], '}'); end > 0 {
+					if v, err := strconv.ParseUint(im.s[im.pos+3:im.pos+end], 16, 32); err == nil && v <= unicode.MaxRune {
+						im.pos += end + 1
+						return char(rune(v))
+					}
+				}
+
+				return importAtom{}, im.errorf(start, "character name")
+			}
+
+			return importAtom{set: []rune{'\n', '\n'}, negate: true}, nil
+		}
+	case 'b':
+		if inSet {
+			return char('\b')
+		}
+		if im.ucp || !im.isStr {
+			return text(`\b`)
+		}
+		if js && im.unicode && im.flags&FlagIgnoreCase != 0 {
+			return text(im.jsWordBoundary(false))
+		}
+
+		return text(`(?a:\b)`)
+	case 'B':
+		if inSet {
+			return importAtom{}, im.errorf(start, `\B in a character set`)
+		}
+		if im.ucp || !im.isStr {
+			return text(`\B`)
+		}
+		if js && im.unicode && im.flags&FlagIgnoreCase != 0 {
+			return text(im.jsWordBoundary(true))
+		}
+
+		return text(`(?a:\B)`)
+	case 'A':
+		if !js && !inSet {
+			return text(`\A`)
+		}
+	case 'z':
+		if !js && !inSet {
+			return text(`\Z`)
+		}
+	case 'Z':
+		if pcre && !inSet {
+			return text(`(?=\n?\Z)`)
+		}
+	case 'G', 'K', 'X', 'C':
+		if !js {
+			return importAtom{}, im.errorf(start, `escape \%c`, c)
+		}
+	case 'R':
+		if pcre && !inSet {
+			if !im.isStr {
+				return text(`(?>\r\n|[\n\x0b\f\r\x85])`)
+			}
+
+			return text(`(?>\r\n|[\n\x0b\f\r\x85\u2028\u2029])`)
+		}
+	case 't':
+		return char('\t')
+	case 'n':
+		return char('\n')
+	case 'r':
+		return char('\r')
+	case 'f':
+		return char('\f')
+	case 'a':
+		if !js {
+			return char('\a')
+		}
+	case 'e':
+		if pcre {
+			return char(0x1b)
+		}
+	case 'c':
+		if !re2 && im.pos < im.end {
+			x := rune(im.s[im.pos])
+			if x >= 'a' && x <= 'z' || x >= 'A' && x <= 'Z' || pcre && x >= 0x20 && x < 0x7f {
+				im.pos++
+
+				if x >= 'a' && x <= 'z' {
+					x -= 'a' - 'A'
+				}
+
+				return char(x ^ 0x40)
+			}
+		}
+		if js && !strict {
+			im.pos-- // `\c` without a control letter is a backslash followed by "c"
+			return char('\\')
+		}
+	case 'x':
+		if v, ok := im.hexEscape(); ok {
+			return char(v)
+		}
+		if !strict {
+			return char('x')
+		}
+
+		return importAtom{}, im.errorf(start, `invalid escape \x`)
+	case 'u':
+		if js {
+			if v, ok := im.unicodeEscape(); ok {
+				return char(v)
+			}
+			if !strict {
+				return char('u')
+			}
+
+			return importAtom{}, im.errorf(start, `invalid escape \u`)
+		}
+	case 'o':
+		if pcre && strings.HasPrefix(im.s[im.pos:im.end], "{") {
+			if end := strings.IndexByte(im.s[im.pos:im.end], '}'); end > 0 {
+				if v, err := strconv.ParseUint(im.s[im.pos+1:im.pos+end], 8, 32); err == nil && v <= unicode.MaxRune {
+					im.pos += end + 1
+					return char(rune(v))
+				}
+			}
+
+			return importAtom{}, im.errorf(start, `invalid escape \o`)
+		}
+	case 'p', 'P':
+		if !js || im.unicode {
+			return im.property(start, c == 'P')
+		}
+	case 'k':
+		if !inSet && (pcre || js && (im.unicode || im.named)) {
+			return im.namedBackref(start)
+		}
+	case 'g':
+		if pcre && !inSet {
+			return im.pcreBackref(start)
+		}
+	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return im.number(start, c, inSet)
+	}
+
+	// identity escapes: ASCII punctuation is always a literal, other characters only in some dialects
+	switch {
+	case c < utf8.RuneSelf && (unicode.IsLetter(c) || unicode.IsDigit(c)):
+		if strict {
+			return importAtom{}, im.errorf(start, `escape \%c`, c)
+		}
+	case c >= utf8.RuneSelf || !unicode.IsPunct(c) && !unicode.IsSymbol(c):
+		if re2 || js && im.unicode {
+			return importAtom{}, im.errorf(start, "escape of %q", c)
+		}
+	}
+
+	return char(c)
+}
+
+// jsWordBoundary returns the word boundary of ECMAScript in unicode mode, if cases are ignored.
+// Then, "ſ" (U+017F) and the Kelvin sign (U+212A) are also word characters, so the boundary is written with
+// lookarounds.
+func (im *importer) jsWordBoundary(negate bool) string {
+	var b strings.Builder
+
+	b.WriteByte('[')
+	for i := 0; i < len(jsWordRanges); i += 2 {
+		writeImportedLiteral(&b, jsWordRanges[i], im.isStr)
+		if jsWordRanges[i] != jsWordRanges[i+1] {
+			b.WriteByte('-')
+			writeImportedLiteral(&b, jsWordRanges[i+1], im.isStr)
+		}
+	}
+	b.WriteByte(']')
+
+	w := b.String()
+	if negate {
+		return `(?-i:(?<=` + w + `)(?=` + w + `)|(?<!` + w + `)(?!` + w + `))`
+	}
+
+	return `(?-i:(?<=` + w + `)(?!` + w + `)|(?<!` + w + `)(?=` + w + `))`
+}
+
+// category returns the atom of the category escape.
+// The categories of all dialects only match ASCII characters, except for the whitespace characters of ECMAScript.
+func (im *importer) category(c rune) importAtom {
+	if im.ucp && im.isStr {
+		return importAtom{text: `\` + string(c)}
+	}
+
+	var set []rune
+
+	switch unicode.ToLower(c) {
+	case 'd':
+		set = asciiDigitRanges
+	case 'w':
+		set = asciiWordRanges
+	case 's':
+		switch im.dialect {
+		case DialectECMAScript:
+			set = jsSpaceRanges
+			if !im.isStr {
+				set = intersectRanges(set, []rune{0, 0xff})
+			}
+		case DialectRE2:
+			set = re2SpaceRanges
+		default:
+			set = pcreSpaceRanges
+		}
+	}
+
+	return importAtom{set: set, negate: unicode.IsUpper(c)}
+}
+
+// hexEscape parses the digits of a hexadecimal escape `\xHH` or `\x{...}`.
+func (im *importer) hexEscape() (rune, bool) {
+	rest := im.s[im.pos:im.end]
+
+	if im.dialect != DialectECMAScript && strings.HasPrefix(rest, "{") {
+		end := strings.IndexByte(rest, '}')
+		if end < 0 {
+			return 0, false
+		}
+
+		v, err := strconv.ParseUint(rest[1:end], 16, 32)
+		if err != nil || v > unicode.MaxRune {
+			return 0, false
+		}
+
+		im.pos += end + 1
+		return rune(v), true
+	}
+
+	n := 0
+	for n < 2 && n < len(rest) && isHexDigit(rest[n]) {
+		n++
+	}
+
+	if n < 2 && im.dialect != DialectPCRE {
+		return 0, false // PCRE allows up to two digits, where `\x` is the null character
+	}
+
+	v, _ := strconv.ParseUint("0"+rest[:n], 16, 32)
+	im.pos += n
+
+	return rune(v), true
+}
+
+// unicodeEscape parses the digits of an ECMAScript escape `\uHHHH` or `\u{...}`.
+// Surrogate pairs of two escapes are combined.
+func (im *importer) unicodeEscape() (rune, bool) {
+	rest := im.s[im.pos:im.end]
+
+	if im.unicode && strings.HasPrefix(rest, "{") {
+		end := strings.IndexByte(rest, '}')
+		if end < 0 {
+			return 0, false
+		}
+
+		v, err := strconv.ParseUint(rest[1:end], 16, 32)
+		if err != nil || v > unicode.MaxRune {
+			return 0, false
+		}
+
+		im.pos += end + 1
+		return rune(v), true
+	}
+
+	if len(rest) < 4 {
+		return 0, false
+	}
+
+	v, err := strconv.ParseUint(rest[:4], 16, 32)
+	if err != nil || strings.ContainsAny(rest[:4], "+-") {
+		return 0, false
+	}
+	im.pos += 4
+
+	if v >= 0xd800 && v < 0xdc00 && strings.HasPrefix(rest[4:], `\u`) && len(rest) >= 10 {
+		if lo, err := strconv.ParseUint(rest[6:10], 16, 32); err == nil && lo >= 0xdc00 && lo < 0xe000 {
+			im.pos += 6
+			return 0x10000 + rune(v-0xd800)<<10 + rune(lo-0xdc00), true
+		}
+	}
+
+	return rune(v), true
+}
+
+// isHexDigit reports, whether the byte is a hexadecimal digit.
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// property returns the atom of a unicode property like `\p{L}`, `\pL`, `\p{Script=Greek}` or `\p{^Lu}`.
+func (im *importer) property(start int, negate bool) (importAtom, error) {
+	if !im.isStr {
+		return importAtom{}, im.errorf(start, "unicode property in a bytes pattern")
+	}
+
+	var name string
+
+	rest := im.s[im.pos:im.end]
+	switch {
+	case strings.HasPrefix(rest, "{"):
+		end := strings.IndexByte(rest, '}')
+		if end < 0 {
+			return importAtom{}, im.errorf(start, "unterminated unicode property")
+		}
+
+		name = rest[1:end]
+		im.pos += end + 1
+	case rest != "" && im.dialect != DialectECMAScript:
+		name = rest[:1]
+		im.pos++
+	default:
+		return importAtom{}, im.errorf(start, "unicode property without a name")
+	}
+
+	if strings.HasPrefix(name, "^") && im.dialect != DialectECMAScript {
+		name = name[1:]
+		negate = !negate
+	}
+
+	r, ok := propertyRanges(name)
+	if !ok {
+		return importAtom{}, im.errorf(start, "unicode property %q", name)
+	}
+
+	return importAtom{set: r, negate: negate}, nil
+}
+
+// propertyRanges returns the ranges of the unicode property.
+func propertyRanges(name string) ([]rune, bool) {
+	if key, value, ok := strings.Cut(name, "="); ok {
+		switch key {
+		case "General_Category", "gc":
+			if short, ok := generalCategories[value]; ok {
+				value = short
+			}
+			if value == "LC" {
+				value = "L&"
+			}
+
+			if _, ok := unicode.Categories[value]; !ok && value != "L&" {
+				return nil, false
+			}
+		case "Script", "sc":
+			if _, ok := unicode.Scripts[value]; !ok {
+				return nil, false
+			}
+		default:
+			return nil, false // for example script extensions, which are not available
+		}
+
+		name = value
+	}
+
+	if short, ok := generalCategories[name]; ok {
+		name = short
+	}
+
+	switch name {
+	case "Any":
+		return []rune{0, unicode.MaxRune}, true
+	case "ASCII":
+		return []rune{0, unicode.MaxASCII}, true
+	case "L&", "LC":
+		return tableRanges(unicode.Lu, unicode.Ll, unicode.Lt), true
+	}
+
+	for _, tables := range []map[string]*unicode.RangeTable{unicode.Categories, unicode.Scripts, unicode.Properties} {
+		if t, ok := tables[name]; ok {
+			return tableRanges(t), true
+		}
+	}
+
+	return nil, false
+}
+
+// tableRanges returns the sorted and merged ranges of the unicode range tables.
+func tableRanges(tables ...*unicode.RangeTable) []rune {
+	var r [][2]rune
+
+	add := func(lo, hi, stride rune) {
+		if stride == 1 {
+			r = append(r, [2]rune{lo, hi})
+			return
+		}
+
+		for c := lo; c <= hi; c += stride {
+			r = append(r, [2]rune{c, c})
+		}
+	}
+
+	for _, t := range tables {
+		for _, rng := range t.R16 {
+			add(rune(rng.Lo), rune(rng.Hi), rune(rng.Stride))
+		}
+		for _, rng := range t.R32 {
+			add(rune(rng.Lo), rune(rng.Hi), rune(rng.Stride))
+		}
+	}
+
+	sort.Slice(r, func(i, j int) bool { return r[i][0] < r[j][0] })
+
+	var res []rune
+	for _, rng := range r {
+		if n := len(res); n > 0 && rng[0] <= res[n-1]+1 {
+			if rng[1] > res[n-1] {
+				res[n-1] = rng[1]
+			}
+
+			continue
+		}
+
+		res = append(res, rng[0], rng[1])
+	}
+
+	return res
+}
+
+// number parses an escape starting with a digit, which is either a backreference or an octal escape.
+func (im *importer) number(start int, c rune, inSet bool) (importAtom, error) {
+	digits := im.s[im.pos-1 : im.pos]
+	for im.pos < im.end && im.s[im.pos] >= '0' && im.s[im.pos] <= '9' {
+		digits += im.s[im.pos : im.pos+1]
+		im.pos++
+	}
+
+	n, _ := strconv.Atoi(digits)
+
+	js := im.dialect == DialectECMAScript
+
+	if c != '0' && !inSet {
+		switch {
+		case im.dialect == DialectRE2:
+			return importAtom{}, im.errorf(start, "backreference")
+		case n <= im.groups:
+			return im.backref(start, n, "")
+		case js && im.unicode || im.dialect == DialectPCRE && n < 10:
+			return importAtom{}, im.errorf(start, "backreference to the missing group %d", n)
+		}
+	}
+
+	if js && im.unicode {
+		if c == '0' && len(digits) == 1 {
+			return importAtom{char: true}, nil
+		}
+
+		return importAtom{}, im.errorf(start, `escape \%s`, digits)
+	}
+
+	// octal escapes of up to three digits; JavaScript also has identity escapes of "8" and "9"
+	im.pos -= len(digits)
+
+	v := rune(0)
+	for i := 0; i < 3 && im.pos < im.end && im.s[im.pos] >= '0' && im.s[im.pos] <= '7'; i++ {
+		next := v*8 + rune(im.s[im.pos]-'0')
+		if next > 0xff {
+			break
+		}
+
+		v = next
+		im.pos++
+	}
+
+	if im.pos == start+1 { // "\8" and "\9" are literals
+		im.pos++
+		return importAtom{char: true, c: c}, nil
+	}
+
+	return importAtom{char: true, c: v}, nil
+}
+
+// namedBackref parses a named backreference like `\k<name>`, `\k'name'` or `\k{name}`.
+func (im *importer) namedBackref(start int) (importAtom, error) {
+	closing := map[byte]byte{'<': '>', '\'': '\'', '{': '}'}
+
+	if im.pos < im.end {
+		if c, ok := closing[im.s[im.pos]]; ok && (c == '>' || im.dialect == DialectPCRE) {
+			if end := strings.IndexByte(im.s[im.pos+1:im.end], c); end >= 0 {
+				name := im.s[im.pos+1 : im.pos+1+end]
+				im.pos += end + 2
+
+				return im.backref(start, 0, name)
+			}
+		}
+	}
+
+	return importAtom{}, im.errorf(start, `invalid escape \k`)
+}
+
+// pcreBackref parses the PCRE backreferences `\gN`, `\g-N`, `\g{N}`, `\g{-N}` and `\g{name}`.
+func (im *importer) pcreBackref(start int) (importAtom, error) {
+	rest := im.s[im.pos:im.end]
+
+	var ref string
+	switch {
+	case strings.HasPrefix(rest, "{"):
+		end := strings.IndexByte(rest, '}')
+		if end < 0 {
+			return importAtom{}, im.errorf(start, `invalid escape \g`)
+		}
+
+		ref = rest[1:end]
+		im.pos += end + 1
+	case strings.HasPrefix(rest, "<"), strings.HasPrefix(rest, "'"):
+		return importAtom{}, im.errorf(start, "subroutine call")
+	default:
+		n := 0
+		if strings.HasPrefix(rest, "-") || strings.HasPrefix(rest, "+") {
+			n++
+		}
+		for n < len(rest) && rest[n] >= '0' && rest[n] <= '9' {
+			n++
+		}
+
+		ref = rest[:n]
+		im.pos += n
+	}
+
+	if n, err := strconv.Atoi(ref); err == nil {
+		if strings.HasPrefix(ref, "-") {
+			n = im.opened + 1 + n // relative reference
+		}
+		if n <= 0 || strings.HasPrefix(ref, "+") {
+			return importAtom{}, im.errorf(start, "backreference %q", ref)
+		}
+
+		return im.backref(start, n, "")
+	}
+
+	if ref == "" {
+		return importAtom{}, im.errorf(start, `invalid escape \g`)
+	}
+
+	return im.backref(start, 0, ref)
+}
+
+// backref returns the atom of a backreference to a group number or to a named group.
+// In ECMAScript, backreferences to groups, that did not match, match the empty string, so they are written as
+// conditional expressions. Backreferences to groups, that are not closed yet, always match the empty string.
+func (im *importer) backref(start, n int, name string) (importAtom, error) {
+	if name != "" {
+		if im.dialect == DialectECMAScript {
+			gid, ok := im.names[name]
+			if !ok && !im.named || ok && !im.closed[gid] {
+				return importAtom{text: "(?:)"}, nil
+			}
+
+			return importAtom{text: "(?(" + name + ")(?P=" + name + "))"}, nil
+		}
+
+		return importAtom{text: "(?P=" + name + ")"}, nil
+	}
+
+	if n >= 100 {
+		return importAtom{}, im.errorf(start, "backreference to group %d", n)
+	}
+
+	ref := `\` + strconv.Itoa(n)
+
+	if im.dialect == DialectECMAScript {
+		if !im.closed[n] {
+			return importAtom{text: "(?:)"}, nil
+		}
+
+		return importAtom{text: "(?(" + strconv.Itoa(n) + ")" + ref + ")"}, nil
+	}
+
+	return importAtom{text: ref, ref: true}, nil
+}
+
+// open writes the start of a group.
+func (im *importer) open() error {
+	start := im.pos
+	rest := im.s[im.pos:im.end]
+
+	js := im.dialect == DialectECMAScript
+	pcre := im.dialect == DialectPCRE
+	re2 := im.dialect == DialectRE2
+
+	g := importGroup{pos: start, flags: im.flags, outer: im.ignoreCase}
+
+	push := func(prefix string, skip int) {
+		im.b.WriteString(prefix)
+		im.pos += skip
+
+		g.ignoreCase = im.ignoreCase
+		im.stack = append(im.stack, g)
+	}
+
+	if strings.HasPrefix(rest, "(*") {
+		if !pcre {
+			return im.errorf(start, "nothing to repeat")
+		}
+
+		end := strings.IndexByte(rest, ')')
+		verb := rest[:maxInt(end+1, 2)]
+
+		switch verb {
+		case "(*UTF)", "(*UTF8)":
+		case "(*UCP)":
+			im.ucp = true
+		default:
+			return im.errorf(start, "verb %q", verb)
+		}
+
+		im.pos += len(verb)
+		return nil
+	}
+
+	if !strings.HasPrefix(rest, "(?") {
+		im.opened++
+		g.group = im.opened
+
+		push("(", 1)
+		return nil
+	}
+
+	switch {
+	case strings.HasPrefix(rest, "(?:"):
+		push("(?:", 3)
+	case strings.HasPrefix(rest, "(?="), strings.HasPrefix(rest, "(?!"):
+		if re2 {
+			return im.errorf(start, "lookahead assertion")
+		}
+
+		push(rest[:3], 3)
+	case strings.HasPrefix(rest, "(?<="), strings.HasPrefix(rest, "(?<!"):
+		if re2 {
+			return im.errorf(start, "lookbehind assertion")
+		}
+
+		push(rest[:4], 4)
+	case strings.HasPrefix(rest, "(?<"), strings.HasPrefix(rest, "(?P<"), strings.HasPrefix(rest, "(?'") && pcre:
+		if strings.HasPrefix(rest, "(?P<") && js {
+			return im.errorf(start, "group name syntax (?P<")
+		}
+
+		open := strings.IndexAny(rest, "<'")
+		closing := ">"
+		if rest[open] == '\'' {
+			closing = "'"
+		}
+
+		end := strings.Index(rest[open+1:], closing)
+		if end < 0 {
+			return im.errorf(start, "unterminated group name")
+		}
+
+		name := rest[open+1 : open+1+end]
+		if !isImportedGroupName(name) {
+			return im.errorf(start, "group name %q", name)
+		}
+
+		im.opened++
+		g.group = im.opened
+		im.names[name] = im.opened
+
+		push("(?P<"+name+">", open+end+2)
+	case strings.HasPrefix(rest, "(?P=") && pcre:
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			return im.errorf(start, "unterminated backreference")
+		}
+
+		a, err := im.backref(start, 0, rest[4:end])
+		if err != nil {
+			return err
+		}
+
+		im.b.WriteString(a.text)
+		im.pos += end + 1
+	case strings.HasPrefix(rest, "(?>"):
+		if !pcre {
+			return im.errorf(start, "atomic group")
+		}
+
+		push("(?>", 3)
+	case strings.HasPrefix(rest, "(?#") && pcre:
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			return im.errorf(start, "unterminated comment")
+		}
+
+		im.pos += end + 1
+	case strings.HasPrefix(rest, "(?(") && pcre:
+		return im.condition()
+	case strings.HasPrefix(rest, "(?|") && pcre:
+		return im.errorf(start, "branch reset group")
+	case strings.HasPrefix(rest, "(?C") && pcre:
+		return im.errorf(start, "callout")
+	case pcre && len(rest) > 2 && strings.ContainsRune("R&+0123456789", rune(rest[2])),
+		strings.HasPrefix(rest, "(?P>") && pcre,
+		strings.HasPrefix(rest, "(?-") && len(rest) > 3 && rest[3] >= '0' && rest[3] <= '9' && pcre:
+		return im.errorf(start, "recursion or subroutine call")
+	default:
+		return im.inlineFlags(start, push)
+	}
+
+	return nil
+}
+
+// isImportedGroupName reports, whether the group name is a valid Python group name.
+func isImportedGroupName(name string) bool {
+	for i, c := range name {
+		if !(unicode.IsLetter(c) || c == '_' || i > 0 && unicode.IsDigit(c)) {
+			return false
+		}
+	}
+
+	return name != ""
+}
+
+// inlineFlags parses inline flags like `(?i)`, `(?im-sx)`, `(?^i)` or scoped flags like `(?i:...)`.
+// Flags without a scope apply to the end of the current group.
+func (im *importer) inlineFlags(start int, push func(prefix string, skip int)) error {
+	pos := start + 2
+	flags := im.flags
+	del := false
+
+	for ; pos < im.end; pos++ {
+		c := im.s[pos]
+
+		var flag uint32
+		switch c {
+		case 'i':
+			flag = FlagIgnoreCase
+		case 'm':
+			flag = FlagMultiline
+		case 's':
+			flag = FlagDotAll
+		case 'x':
+			if im.dialect == DialectPCRE {
+				flag = FlagVerbose
+			}
+		case '-':
+			if !del {
+				del = true
+				continue
+			}
+		case '^':
+			if pos == start+2 && im.dialect == DialectPCRE {
+				flags &^= FlagIgnoreCase | FlagMultiline | FlagDotAll | FlagVerbose
+				continue
+			}
+		case ':', ')':
+			if c == ')' && im.dialect == DialectECMAScript {
+				return im.errorf(start, "inline flags without a group")
+			}
+
+			im.pos = pos
+			return im.applyFlags(flags, c == ':', push)
+		default:
+			if c < '0' || c > 'z' {
+				return im.errorf(start, "unknown extension ?%c", c)
+			}
+		}
+
+		if flag == 0 {
+			return im.errorf(pos, "inline flag %q", string(c))
+		}
+
+		if del {
+			flags &^= flag
+		} else {
+			flags |= flag
+		}
+	}
+
+	return im.errorf(start, "unterminated flags")
+}
+
+// applyFlags applies the parsed inline flags. The position is at the closing colon or parenthesis.
+// Inline flags at the start of the pattern become the global flags of the Python pattern.
+func (im *importer) applyFlags(flags uint32, scoped bool, push func(prefix string, skip int)) error {
+	im.flags = flags
+	im.pos++
+
+	switch {
+	case scoped:
+		im.writeIgnoreCase("(?:")
+		push("", 0)
+	case len(im.stack) == 1 && im.b.Len() == 0:
+		im.ignoreCase = flags&FlagIgnoreCase != 0
+		im.stack[0].ignoreCase = im.ignoreCase
+	default:
+		if im.writeIgnoreCase("") {
+			im.top().flagGroups++
+		}
+	}
+
+	return nil
+}
+
+// condition writes the start of a PCRE conditional expression like `(?(1)...)` or `(?(<name>)...)`.
+func (im *importer) condition() error {
+	start := im.pos
+	rest := im.s[im.pos+3 : im.end]
+
+	end := strings.IndexByte(rest, ')')
+	if end < 0 || strings.HasPrefix(rest, "?") {
+		return im.errorf(start, "conditional expression with an assertion")
+	}
+
+	ref := rest[:end]
+	if len(ref) >= 2 && (ref[0] == '<' && ref[len(ref)-1] == '>' || ref[0] == '\'' && ref[len(ref)-1] == '\'') {
+		ref = ref[1 : len(ref)-1]
+	} else if n, err := strconv.Atoi(ref); err == nil {
+		if strings.HasPrefix(ref, "-") {
+			n = im.opened + 1 + n
+		} else if strings.HasPrefix(ref, "+") {
+			n = im.opened + n
+		}
+		if n <= 0 {
+			return im.errorf(start, "conditional expression with group %q", ref)
+		}
+
+		ref = strconv.Itoa(n)
+	} else if ref == "DEFINE" || strings.HasPrefix(ref, "R") || strings.HasPrefix(ref, "VERSION") {
+		return im.errorf(start, "conditional expression with %q", ref)
+	}
+
+	im.b.WriteString("(?(" + ref + ")")
+	im.pos += 3 + end + 1
+
+	im.stack = append(im.stack, importGroup{pos: start, flags: im.flags, ignoreCase: im.ignoreCase, outer: im.ignoreCase})
+
+	return nil
+}
+
+// close writes the end of the current group and restores the flags from before the group.
+func (im *importer) close() error {
+	if len(im.stack) == 1 {
+		return im.errorf(im.pos, "unbalanced parenthesis")
+	}
+
+	g := im.top()
+
+	im.closeFlagGroups(g)
+	im.b.WriteByte(')')
+
+	if g.group > 0 {
+		im.closed[g.group] = true
+	}
+
+	im.flags = g.flags
+	im.ignoreCase = g.outer
+	im.stack = im.stack[:len(im.stack)-1]
+	im.pos++
+
+	return nil
+}
+
+// class writes a character set.
+func (im *importer) class() error {
+	start := im.pos
+	im.pos++
+
+	negate := false
+	if im.pos < im.end && im.s[im.pos] == '^' {
+		negate = true
+		im.pos++
+	}
+
+	var r []rune       // ranges of the set
+	var texts []string // Python categories of the set
+
+	add := func(a importAtom) {
+		if a.char {
+			r = append(r, a.c, a.c)
+		} else if a.text != "" {
+			texts = append(texts, a.text)
+		} else {
+			r = append(r, im.setRanges(a)...)
+		}
+	}
+
+	for first := true; ; first = false {
+		if im.pos >= im.end {
+			return im.errorf(start, "unterminated character set")
+		}
+
+		if im.s[im.pos] == ']' && (!first || im.dialect == DialectECMAScript) {
+			im.pos++
+			break
+		}
+
+		if strings.HasPrefix(im.s[im.pos:im.end], `\Q`) && im.dialect != DialectECMAScript {
+			err := im.quote(func(c rune) error {
+				add(importAtom{char: true, c: c})
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		lo, err := im.classAtom()
+		if err != nil {
+			return err
+		}
+
+		rest := im.s[im.pos:im.end]
+		if !lo.char || len(rest) < 2 || rest[0] != '-' || rest[1] == ']' {
+			add(lo)
+			continue
+		}
+
+		rangePos := im.pos
+		im.pos++
+
+		hi, err := im.classAtom()
+		if err != nil {
+			return err
+		}
+
+		if !hi.char {
+			if im.dialect == DialectRE2 || im.unicode {
+				return im.errorf(rangePos, "range with a character class")
+			}
+
+			add(lo)
+			add(importAtom{char: true, c: '-'})
+			add(hi)
+
+			continue
+		}
+
+		if hi.c < lo.c {
+			return im.errorf(rangePos, "bad character range")
+		}
+
+		r = append(r, lo.c, hi.c)
+	}
+
+	if !im.isStr {
+		for _, c := range r {
+			if c > 0xff {
+				return im.errorf(start, "character U+%04X in a bytes pattern", c)
+			}
+		}
+	}
+
+	if len(texts) == 0 {
+		im.writeImportedSet(importAtom{set: normalizeRanges(r), negate: negate})
+		return nil
+	}
+
+	im.b.WriteByte('[')
+	if negate {
+		im.b.WriteByte('^')
+	}
+	im.writeRanges(normalizeRanges(r))
+	for _, t := range texts {
+		im.b.WriteString(t)
+	}
+	im.b.WriteByte(']')
+
+	return nil
+}
+
+// classAtom parses a single item of a character set.
+func (im *importer) classAtom() (importAtom, error) {
+	rest := im.s[im.pos:im.end]
+
+	if strings.HasPrefix(rest, "[:") && im.dialect != DialectECMAScript {
+		if end := strings.Index(rest[2:], ":]"); end >= 0 {
+			name := rest[2 : 2+end]
+			negate := strings.HasPrefix(name, "^")
+			name = strings.TrimPrefix(name, "^")
+
+			set, ok := posixClasses[name]
+			if !ok {
+				return importAtom{}, im.errorf(im.pos, "POSIX class %q", name)
+			}
+
+			im.pos += end + 4
+			return importAtom{set: set, negate: negate}, nil
+		}
+	}
+
+	if strings.HasPrefix(rest, `\`) {
+		return im.parseEscape(true)
+	}
+
+	c, size := utf8.DecodeRuneInString(rest)
+	im.pos += size
+
+	return importAtom{char: true, c: c}, nil
+}
+
+// normalizeRanges sorts and merges the ranges of a character set.
+func normalizeRanges(r []rune) []rune {
+	pairs := make([][2]rune, 0, len(r)/2)
+	for i := 0; i < len(r); i += 2 {
+		pairs = append(pairs, [2]rune{r[i], r[i+1]})
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+
+	var res []rune
+	for _, p := range pairs {
+		if n := len(res); n > 0 && p[0] <= res[n-1]+1 {
+			if p[1] > res[n-1] {
+				res[n-1] = p[1]
+			}
+
+			continue
+		}
+
+		res = append(res, p[0], p[1])
+	}
+
+	return res
+}
+
+// ImportTemplate converts a replacement template of the regex dialect into a template of `re.sub`.
+// The engine is the compiled pattern, that the template is used with. The supported syntax of the dialects is:
+//   - ECMAScript: `$1` to `$99`, `$<name>`, `$&` and `$$`
+//   - PCRE: `$1`, `${1}`, `$name`, `${name}` and `$$`
+//   - RE2: `$1`, `${1}`, `$name`, `${name}` and `$$`, where `$1x` refers to the group "1x" like in Go
+//
+// All other characters, including backslashes, are literals. References to the text before or after the match,
+// like `$` + "`" in ECMAScript, and references to unknown groups, which are empty in RE2, result in an error.
+func ImportTemplate(r Engine, template string, isStr bool, dialect string) (string, error) {
+	d, err := LookupDialect(dialect)
+	if err != nil {
+		return "", err
+	}
+
+	if d == DialectDotNet {
+		return "", fmt.Errorf("cannot import templates from %s", dialectNames[d])
+	}
+
+	var b strings.Builder
+
+	group := func(ref string) {
+		b.WriteString(`\g<`)
+		b.WriteString(ref)
+		b.WriteByte('>')
+	}
+
+	named := false
+	for _, name := range r.SubexpNames() {
+		if name != "" {
+			named = true
+		}
+	}
+
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+
+		if c != '$' || i+1 == len(template) {
+			if c == '\\' {
+				b.WriteByte('\\')
+			}
+
+			b.WriteByte(c)
+			continue
+		}
+
+		rest := template[i+1:]
+
+		switch {
+		case rest[0] == '$':
+			b.WriteByte('$')
+			i++
+		case d == DialectECMAScript:
+			switch {
+			case rest[0] == '&':
+				group("0")
+				i++
+			case rest[0] == '`' || rest[0] == '\'':
+				return "", fmt.Errorf("cannot import replacement %q at position %d from %s", "$"+rest[:1], i, dialectNames[d])
+			case rest[0] == '<' && named:
+				end := strings.IndexByte(rest, '>')
+				if end < 0 {
+					b.WriteByte('$')
+					continue
+				}
+
+				name := rest[1:end]
+				if r.SubexpIndex(name) < 0 {
+					return "", fmt.Errorf("cannot import unknown group name %q at position %d from %s", name, i, dialectNames[d])
+				}
+
+				group(name)
+				i += end + 1
+			case rest[0] >= '0' && rest[0] <= '9':
+				// two digits are used, if the group exists; otherwise a single digit, if the group exists
+				n := 0
+				if len(rest) >= 2 && rest[1] >= '0' && rest[1] <= '9' {
+					if v, _ := strconv.Atoi(rest[:2]); v >= 1 && v <= r.SubexpCount() {
+						n = 2
+					}
+				}
+				if v := int(rest[0] - '0'); n == 0 && v >= 1 && v <= r.SubexpCount() {
+					n = 1
+				}
+
+				if n == 0 {
+					b.WriteByte('$')
+					continue
+				}
+
+				group(strings.TrimLeft(rest[:n], "0"))
+				i += n
+			default:
+				b.WriteByte('$')
+			}
+		default:
+			var ref string
+			end := 0
+
+			if rest[0] == '{' {
+				if e := strings.IndexByte(rest, '}'); e >= 0 {
+					ref, end = rest[1:e], e+1
+				}
+			} else {
+				for end < len(rest) && isWordByte(rest[end]) {
+					end++
+				}
+				ref = rest[:end]
+
+				if d == DialectPCRE && ref != "" && ref[0] >= '0' && ref[0] <= '9' {
+					// numbers end at the first non-digit in PCRE
+					n := 0
+					for n < len(ref) && ref[n] >= '0' && ref[n] <= '9' {
+						n++
+					}
+					ref, end = ref[:n], n
+				}
+			}
+
+			if ref == "" {
+				if d == DialectPCRE {
+					return "", fmt.Errorf("cannot import replacement %q at position %d from %s", "$"+rest[:1], i, dialectNames[d])
+				}
+
+				b.WriteByte('$') // Go copies invalid references literally
+				continue
+			}
+
+			if isDigitString(ref) {
+				if n, err := strconv.Atoi(ref); err != nil || n > r.SubexpCount() {
+					return "", fmt.Errorf("cannot import reference to unknown group %s at position %d from %s", ref, i, dialectNames[d])
+				}
+			} else if r.SubexpIndex(ref) < 0 {
+				return "", fmt.Errorf("cannot import reference to unknown group %q at position %d from %s", ref, i, dialectNames[d])
+			}
+
+			group(ref)
+			i += end
+		}
+	}
+
+	res := b.String()
+
+	if _, err := ParseTemplate(r, res, isStr); err != nil {
+		return "", err
+	}
+
+	return res, nil
+}
+
+// isWordByte reports, whether the byte is an ASCII letter, digit or underscore.
+func isWordByte(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
@@ -0,0 +1,143 @@
+package regex
+
+import (
+	"unsafe"
+
+	"github.com/magnetde/starlark-re/util"
+)
+
+// inputCacheSize is the number of prepared inputs stored in an `InputCache`.
+const inputCacheSize = 8
+
+// maxInputCacheBytes is the maximum number of bytes of the strings and prepared inputs stored in an `InputCache`.
+// Inputs of larger strings are not cached at all.
+const maxInputCacheBytes = 16 << 20
+
+// minCachedInput is the minimum length of a string, whose prepared input is stored in an `InputCache`.
+// Preparing shorter strings is cheap, and caching them would only evict the inputs of larger strings.
+const minCachedInput = 256
+
+// inputKind determines the kind of preparation, that was applied to an input string.
+// Engines with the same kind of input can reuse the prepared inputs of each other.
+type inputKind uint8
+
+const (
+	inputStdStr inputKind = iota
+	inputStdBytes
+	inputFallbStr
+	inputFallbBytes
+)
+
+// InputCache caches the inputs prepared by the regex engines for the most recently searched strings,
+// so searching multiple patterns in the same string does not prepare the string again for every search.
+// Strings are identified by the address of their data and their length, which is possible because strings
+// are immutable. The cache keeps references to the cached strings, so their addresses cannot be reused.
+// The cache is bounded by the number of entries and by the total size of the cached strings and prepared inputs.
+// The cache is not safe for concurrent use; it is intended to be used by a single Starlark thread.
+type InputCache struct {
+	entries [inputCacheSize]inputCacheEntry
+	next    int // index of the entry, that is replaced next
+	size    int // total size of all entries in bytes
+}
+
+// inputCacheEntry is a single prepared input of an `InputCache`.
+type inputCacheEntry struct {
+	s     string // string limited to `endpos`
+	kind  inputKind
+	str   string // prepared string of the default regex engine
+	chars []rune // prepared characters of the fallback engine
+	bits  *util.BitArray
+}
+
+// size returns the number of bytes of the string and the prepared input, that are kept by the entry.
+func (e *inputCacheEntry) size() int {
+	n := len(e.s) + 4*len(e.chars)
+	if !sameString(e.s, e.str) {
+		n += len(e.str)
+	}
+	if e.bits != nil {
+		n += e.bits.Size()
+	}
+
+	return n
+}
+
+// NewInputCache creates a new empty input cache.
+func NewInputCache() *InputCache {
+	return &InputCache{}
+}
+
+// BuildInput creates the input object of the regex engine `e` for the string `s`, limited to `endpos`.
+// If the input was already prepared for an engine of the same type, the prepared input is reused.
+// Engines, that do not prepare their inputs, are not cached. If the cache is nil, `e.BuildInput` is called.
+func (c *InputCache) BuildInput(e Engine, s string, endpos int) Input {
+	if c != nil && endpos >= minCachedInput {
+		switch r := e.(type) {
+		case *stdRegex:
+			return r.buildInput(s, endpos, c)
+		case *fallbEngine:
+			return r.buildInput(s, endpos, c)
+		}
+	}
+
+	return e.BuildInput(s, endpos)
+}
+
+// lookup returns the cached entry of the string `s` for the input kind.
+// If the cache is nil or the string is not cached, nil is returned.
+func (c *InputCache) lookup(s string, kind inputKind) *inputCacheEntry {
+	if c == nil {
+		return nil
+	}
+
+	for i := range c.entries {
+		e := &c.entries[i]
+		if e.kind == kind && sameString(e.s, s) {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// add stores the entry in the cache and replaces the oldest entries, if necessary.
+// Entries larger than `maxInputCacheBytes` are not stored. If the cache is nil, this function is a noop.
+func (c *InputCache) add(e inputCacheEntry) {
+	size := e.size()
+	if c == nil || size > maxInputCacheBytes {
+		return
+	}
+
+	c.remove(c.next)
+	for i := (c.next + 1) % len(c.entries); c.size+size > maxInputCacheBytes; i = (i + 1) % len(c.entries) {
+		c.remove(i)
+	}
+
+	c.entries[c.next] = e
+	c.size += size
+	c.next = (c.next + 1) % len(c.entries)
+}
+
+// remove removes the entry at index `i`.
+func (c *InputCache) remove(i int) {
+	c.size -= c.entries[i].size()
+	c.entries[i] = inputCacheEntry{}
+}
+
+// Reset removes all entries, so the cached strings and prepared inputs can be garbage collected.
+func (c *InputCache) Reset() {
+	if c != nil {
+		*c = InputCache{}
+	}
+}
+
+// sameString reports, whether both strings share the same data and have the same length.
+// Empty strings are never considered the same.
+func sameString(a, b string) bool {
+	return len(a) == len(b) && len(a) > 0 && stringData(a) == stringData(b)
+}
+
+// stringData returns the address of the data of the string.
+func stringData(s string) unsafe.Pointer {
+	return *(*unsafe.Pointer)(unsafe.Pointer(&s))
+}
@@ -0,0 +1,436 @@
+package regex
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/magnetde/starlark-re/util"
+)
+
+// Kinds of the pitfalls, that are reported by `Lint`.
+const (
+	LintBacktracking      = "backtracking"       // nested unbounded repeats or overlapping alternatives inside an unbounded repeat
+	LintRedundantGroup    = "redundant-group"    // non-capturing group, that can be removed without changing the pattern
+	LintUnreachableBranch = "unreachable-branch" // alternative, that is identical to a previous alternative
+	LintDotAllRepeat      = "dotall-repeat"      // `.` with the DOTALL flag inside of a greedy unbounded repeat
+	LintDuplicateRange    = "duplicate-range"    // duplicate or overlapping items of a character class
+)
+
+// LintFinding is a possible pitfall of a regex pattern, that was found by `Lint`.
+// The positions are byte offsets in the pattern, like the positions of parser errors.
+type LintFinding struct {
+	Kind    string // kind of the pitfall; one of the `Lint*` constants
+	Message string
+	Pos     int // start position of the pitfall
+	End     int // end position of the pitfall
+}
+
+// String returns the message of the finding together with its position.
+func (f LintFinding) String() string {
+	return fmt.Sprintf("%s at position %d", f.Message, f.Pos)
+}
+
+// Lint parses the regex pattern and reports possible pitfalls, ordered by their position:
+//   - unbounded repeats, that contain another unbounded repeat or a branch with overlapping alternatives,
+//     which may cause catastrophic backtracking in backtracking engines (like the fallback engine and Python),
+//   - redundant non-capturing groups,
+//   - unreachable alternatives of branches,
+//   - the `.` with the DOTALL flag inside of greedy unbounded repeats, which consumes the rest of the string,
+//   - duplicate and overlapping items of character classes.
+//
+// If the pattern is invalid, the parser error is returned.
+func Lint(pattern string, isStr bool, flags uint32) ([]LintFinding, error) {
+	var l linter
+
+	sp, err := parseLint(pattern, isStr, flags, &l)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &preprocessor{
+		pattern: pattern,
+		isStr:   isStr,
+		p:       sp,
+	}
+
+	l.walk(p, sp, sp.state.flags, nil)
+
+	slices.SortStableFunc(l.findings, func(a, b LintFinding) int {
+		return a.Pos - b.Pos
+	})
+
+	return l.findings, nil
+}
+
+// linter collects the pitfalls of a regex pattern.
+// Some pitfalls are reported by the parser, because its simplifications remove them from the parsed tree.
+// All methods, that are called by the parser, can be called on a nil linter.
+type linter struct {
+	findings   []LintFinding
+	reported   map[lintKey]bool     // kinds and positions of all findings, so nested repeats do not report findings twice
+	firsts     map[int][]*regexNode // first nodes of the alternatives of all alternations, before common prefixes were removed
+	lastAltern bool                 // whether the last parsed alternation had more than one alternative
+}
+
+// lintKey identifies the findings of a kind at a position.
+type lintKey struct {
+	kind string
+	pos  int
+}
+
+// report adds a finding, unless a finding of the same kind was already reported at the position.
+func (l *linter) report(kind string, pos, end int, format string, args ...any) {
+	key := lintKey{kind, pos}
+	if l.reported[key] {
+		return
+	}
+
+	if l.reported == nil {
+		l.reported = make(map[lintKey]bool)
+	}
+	l.reported[key] = true
+
+	l.findings = append(l.findings, LintFinding{
+		Kind:    kind,
+		Message: fmt.Sprintf(format, args...),
+		Pos:     pos,
+		End:     end,
+	})
+}
+
+// sourceText returns the representation of the pattern between the positions.
+func sourceText(s *source, pos, end int) string {
+	return util.Repr(s.orig[pos:end], s.isStr)
+}
+
+// alternatives checks the alternatives of an alternation, before they are simplified by the parser.
+// An alternative is unreachable, if a previous alternative is identical, because the previous alternative
+// always matches first. The slice `starts` contains the start positions of the alternatives.
+// Additionally, the first nodes of the alternatives are stored, because the parser removes common prefixes,
+// which makes overlapping alternatives undetectable in the parsed tree.
+func (l *linter) alternatives(s *source, items []*subPattern, starts []int) {
+	if l == nil {
+		return
+	}
+
+	l.lastAltern = len(items) > 1
+	if !l.lastAltern {
+		return
+	}
+
+	firsts := make([]*regexNode, len(items))
+	for i, item := range items {
+		if item.len() > 0 {
+			firsts[i] = item.get(0)
+		}
+	}
+
+	if l.firsts == nil {
+		l.firsts = make(map[int][]*regexNode)
+	}
+	l.firsts[starts[0]] = firsts
+
+	for j := 1; j < len(items); j++ {
+		end := s.tell()
+		if j+1 < len(starts) {
+			end = starts[j+1] - 1
+		}
+
+		for i := 0; i < j; i++ {
+			if sameSeq(items[i], items[j]) {
+				l.report(LintUnreachableBranch, starts[j], end, "alternative %s is unreachable, because it is identical to the alternative at position %d",
+					sourceText(s, starts[j], end), starts[i])
+				break
+			}
+		}
+	}
+}
+
+// alternation reports, whether the last parsed alternation had more than one alternative.
+func (l *linter) alternation() bool {
+	return l != nil && l.lastAltern
+}
+
+// group checks a non-capturing group without flags, that was just parsed.
+// The group is redundant, if it contains no alternation and if it is either not repeated
+// or contains only a single item, that can be repeated without the group.
+func (l *linter) group(s *source, n *regexNode, alternation bool) {
+	if l == nil || alternation {
+		return
+	}
+
+	p := n.params.(subPatternParam).p
+
+	if c, ok := s.peek(); ok && (c == '*' || c == '+' || c == '?' || c == '{') {
+		if p.len() != 1 || isRepeatCode(p.get(0).opcode) || p.get(0).opcode == opAt {
+			return
+		}
+	}
+
+	l.report(LintRedundantGroup, n.pos, n.end, "non-capturing group %s is redundant", sourceText(s, n.pos, n.end))
+}
+
+// class checks the items of a character class for duplicate literals and overlapping ranges,
+// before the duplicates are removed by the parser.
+func (l *linter) class(s *source, set []*regexNode) {
+	if l == nil {
+		return
+	}
+
+	for j, b := range set {
+		blo, bhi, ok := classRange(b)
+		if !ok {
+			continue
+		}
+
+		for _, a := range set[:j] {
+			alo, ahi, ok := classRange(a)
+			if !ok || bhi < alo || ahi < blo {
+				continue
+			}
+
+			if alo == blo && ahi == bhi {
+				l.report(LintDuplicateRange, b.pos, b.end, "duplicate item %s in character class", sourceText(s, b.pos, b.end))
+			} else {
+				l.report(LintDuplicateRange, b.pos, b.end, "item %s of character class overlaps with %s at position %d",
+					sourceText(s, b.pos, b.end), sourceText(s, a.pos, a.end), a.pos)
+			}
+
+			break
+		}
+	}
+}
+
+// classRange returns the range of characters of a literal or range item of a character class.
+func classRange(n *regexNode) (rune, rune, bool) {
+	switch n.opcode {
+	case opLiteral:
+		return n.c, n.c, true
+	case opRange:
+		params := n.params.(rangeParams)
+		return params.lo, params.hi, true
+	}
+
+	return 0, 0, false
+}
+
+// walk checks all nodes of the parsed subpattern.
+// The `flags` parameter contains the flags of the current group and `rep` is the innermost
+// greedy unbounded repeat, that contains the subpattern, or nil.
+func (l *linter) walk(p *preprocessor, sp *subPattern, flags uint32, rep *regexNode) {
+	for _, n := range sp.data {
+		switch n.opcode {
+		case opAny:
+			if rep != nil && flags&FlagDotAll != 0 {
+				l.report(LintDotAllRepeat, n.pos, n.end, "'.' matches newlines with the DOTALL flag, so the repeat at position %d consumes the rest of the string",
+					rep.pos)
+			}
+		case opBranch:
+			for _, item := range n.params.([]*subPattern) {
+				l.walk(p, item, flags, rep)
+			}
+		case opMinRepeat, opMaxRepeat, opPossessiveRepeat:
+			params := n.params.(repeatParams)
+
+			inner := rep
+			if params.max == maxRepeat {
+				if n.opcode != opPossessiveRepeat {
+					l.backtracking(p, n, params.item, flags)
+				}
+				if n.opcode != opMinRepeat {
+					inner = n
+				}
+			}
+
+			l.walk(p, params.item, flags, inner)
+		case opSubpattern:
+			params := n.params.(subPatternParam)
+			l.walk(p, params.p, combineFlags(flags, params.addFlags, params.delFlags), rep)
+		case opAtomicGroup:
+			l.walk(p, n.params.(*subPattern), flags, rep)
+		case opAssert, opAssertNot:
+			l.walk(p, n.params.(assertParams).p, flags, rep)
+		case opGrouprefExists:
+			params := n.params.(grouprefExParam)
+
+			l.walk(p, params.itemYes, flags, rep)
+			if params.itemNo != nil {
+				l.walk(p, params.itemNo, flags, rep)
+			}
+		}
+	}
+}
+
+// backtracking checks the item of the unbounded repeat `rep` for nested unbounded repeats and branches
+// with overlapping alternatives. In both cases, a backtracking engine can split the same text in exponentially
+// many ways between the iterations, before the match fails.
+func (l *linter) backtracking(p *preprocessor, rep *regexNode, item *subPattern, flags uint32) {
+	if inner := nestedRepeat(item); inner != nil {
+		l.report(LintBacktracking, rep.pos, rep.end, "unbounded repeat contains the unbounded repeat at position %d, which may cause catastrophic backtracking",
+			inner.pos)
+	}
+
+	l.overlappingBranches(p, rep, item, flags)
+}
+
+// nestedRepeat returns an unbounded and non-possessive repeat of the subpattern, if all other items
+// of the subpattern may match the empty string. Otherwise, the other items separate the iterations
+// of the repeats and nil is returned. Atomic groups and lookarounds are not searched.
+func nestedRepeat(sp *subPattern) *regexNode {
+	for i, n := range sp.data {
+		optional := true
+		for j, o := range sp.data {
+			if lo, _ := o.width(); j != i && lo > 0 {
+				optional = false
+				break
+			}
+		}
+		if !optional {
+			continue
+		}
+
+		switch n.opcode {
+		case opMinRepeat, opMaxRepeat:
+			if n.params.(repeatParams).max == maxRepeat {
+				return n
+			}
+		case opSubpattern:
+			if r := nestedRepeat(n.params.(subPatternParam).p); r != nil {
+				return r
+			}
+		case opBranch:
+			for _, alt := range n.params.([]*subPattern) {
+				if r := nestedRepeat(alt); r != nil {
+					return r
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// overlappingBranches reports the branches of the repeated subpattern, if the first characters of
+// two alternatives overlap. The alternatives are compared before their common prefixes were removed.
+// Nested repeats are not searched, because they are checked separately.
+func (l *linter) overlappingBranches(p *preprocessor, rep *regexNode, sp *subPattern, flags uint32) {
+	for _, n := range sp.data {
+		switch n.opcode {
+		case opSubpattern:
+			params := n.params.(subPatternParam)
+			l.overlappingBranches(p, rep, params.p, combineFlags(flags, params.addFlags, params.delFlags))
+		case opBranch:
+			firsts := l.firsts[n.pos]
+
+			sets := make([]*charSet, len(firsts))
+			for i, first := range firsts {
+				if first != nil {
+					sets[i] = p.firstSet(first, flags)
+				}
+			}
+
+		check:
+			for j := range sets {
+				for i := 0; i < j; i++ {
+					if sets[i] != nil && sets[j] != nil && sets[i].intersects(sets[j]) {
+						l.report(LintBacktracking, n.pos, n.end, "alternatives of the branch overlap inside of the unbounded repeat at position %d, which may cause catastrophic backtracking",
+							rep.pos)
+						break check
+					}
+				}
+			}
+		}
+	}
+}
+
+// firstSet returns the set of characters, that can be matched first by a subpattern starting with the node.
+// If the set cannot be determined easily, nil is returned.
+func (p *preprocessor) firstSet(n *regexNode, flags uint32) *charSet {
+	var sp *subPattern
+
+	switch n.opcode {
+	case opMinRepeat, opMaxRepeat, opPossessiveRepeat:
+		params := n.params.(repeatParams)
+		if params.min > 0 {
+			sp = params.item
+		}
+	case opSubpattern:
+		params := n.params.(subPatternParam)
+		sp = params.p
+		flags = combineFlags(flags, params.addFlags, params.delFlags)
+	case opAtomicGroup:
+		sp = n.params.(*subPattern)
+	default:
+		return p.compileCharSet(n, flags)
+	}
+
+	if sp == nil || sp.len() == 0 {
+		return nil
+	}
+
+	return p.firstSet(sp.get(0), flags)
+}
+
+// ranges returns the character set as sorted and non-overlapping ranges without negation.
+func (c *charSet) ranges() []rune {
+	if c.negate {
+		return negateRanges(c.r)
+	}
+
+	return c.r
+}
+
+// intersects reports, whether both character sets contain a common character.
+func (c *charSet) intersects(o *charSet) bool {
+	a, b := c.ranges(), o.ranges()
+
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		if a[i+1] < b[j] {
+			i += 2
+		} else if b[j+1] < a[i] {
+			j += 2
+		} else {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sameSeq reports, whether both subpatterns are identical, including all nested subpatterns.
+func sameSeq(a, b *subPattern) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return slices.EqualFunc(a.data, b.data, sameNode)
+}
+
+// sameNode reports, whether both regex nodes are identical. Unlike `regexNode.equals`,
+// nested subpatterns are compared by their content.
+func sameNode(a, b *regexNode) bool {
+	if a.opcode != b.opcode {
+		return false
+	}
+
+	switch a.opcode {
+	case opAssert, opAssertNot:
+		p1, p2 := a.params.(assertParams), b.params.(assertParams)
+		return p1.dir == p2.dir && sameSeq(p1.p, p2.p)
+	case opBranch:
+		return slices.EqualFunc(a.params.([]*subPattern), b.params.([]*subPattern), sameSeq)
+	case opGrouprefExists:
+		p1, p2 := a.params.(grouprefExParam), b.params.(grouprefExParam)
+		return p1.condgroup == p2.condgroup && sameSeq(p1.itemYes, p2.itemYes) && sameSeq(p1.itemNo, p2.itemNo)
+	case opMinRepeat, opMaxRepeat, opPossessiveRepeat:
+		p1, p2 := a.params.(repeatParams), b.params.(repeatParams)
+		return p1.min == p2.min && p1.max == p2.max && sameSeq(p1.item, p2.item)
+	case opSubpattern:
+		p1, p2 := a.params.(subPatternParam), b.params.(subPatternParam)
+		return p1.group == p2.group && p1.addFlags == p2.addFlags && p1.delFlags == p2.delFlags && sameSeq(p1.p, p2.p)
+	case opAtomicGroup:
+		return sameSeq(a.params.(*subPattern), b.params.(*subPattern))
+	}
+
+	return a.equals(b)
+}
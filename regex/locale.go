@@ -0,0 +1,189 @@
+package regex
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// CType is a set of character classes of a single byte.
+// The classes correspond to the C functions `isalnum`, `isspace`, `isupper` and `islower`.
+type CType uint8
+
+// Available character classes of the type `CType`.
+const (
+	CTypeAlnum CType = 1 << iota // alphanumeric character
+	CTypeSpace                   // whitespace character
+	CTypeUpper                   // upper case letter
+	CTypeLower                   // lower case letter
+)
+
+// Locale is a character table, that describes the bytes 0-255 like the ctype table of a C locale with
+// a single-byte encoding. It is used for bytes patterns with the LOCALE flag, to decide which bytes are
+// matched by `\w`, `\s` and `\b` and how cases are ignored. Unlike Python, the table does not depend on
+// the locale of the operating system, so matching stays deterministic.
+// A locale must not be modified after it was used to compile a pattern.
+type Locale struct {
+	name  string
+	ctype [256]CType
+	lower [256]byte
+	upper [256]byte
+}
+
+// NewLocale creates a new locale, that is equal to the "C" locale: only ASCII letters and digits
+// are alphanumeric and only ASCII whitespace characters are whitespace characters.
+// The locale may then be extended by using `SetClass` and `SetCase`.
+func NewLocale(name string) *Locale {
+	l := Locale{
+		name: name,
+	}
+
+	for i := 0; i < 256; i++ {
+		b := byte(i)
+
+		l.lower[i] = b
+		l.upper[i] = b
+
+		if isDigitByte(b) {
+			l.ctype[i] = CTypeAlnum
+		} else if isWhitespace(rune(b)) {
+			l.ctype[i] = CTypeSpace
+		}
+	}
+
+	for b := byte('A'); b <= 'Z'; b++ {
+		l.SetCase(b, b-'A'+'a')
+	}
+
+	return &l
+}
+
+// LocaleLatin1 returns a locale, that corresponds to a C locale with the encoding ISO-8859-1 (for example "en_US.ISO-8859-1").
+func LocaleLatin1() *Locale {
+	l := NewLocale("ISO-8859-1")
+	addLatin1Letters(l)
+	return l
+}
+
+// LocaleWindows1252 returns a locale, that corresponds to a C locale with the encoding Windows-1252.
+// It is identical to `LocaleLatin1`, but additionally contains the letters in the range 0x80-0x9f.
+func LocaleWindows1252() *Locale {
+	l := NewLocale("CP1252")
+	addLatin1Letters(l)
+
+	l.SetClass(0x83, CTypeAlnum|CTypeLower) // ƒ
+	l.SetCase(0x8a, 0x9a)                   // Š, š
+	l.SetCase(0x8c, 0x9c)                   // Œ, œ
+	l.SetCase(0x8e, 0x9e)                   // Ž, ž
+	l.SetCase(0x9f, 0xff)                   // Ÿ, ÿ
+
+	return l
+}
+
+// addLatin1Letters adds all letters of the ISO-8859-1 encoding in the range 0xa0-0xff to the locale.
+func addLatin1Letters(l *Locale) {
+	l.SetClass(0xaa, CTypeAlnum)            // ª
+	l.SetClass(0xb5, CTypeAlnum|CTypeLower) // µ
+	l.SetClass(0xba, CTypeAlnum)            // º
+	l.SetClass(0xdf, CTypeAlnum|CTypeLower) // ß
+	l.SetClass(0xff, CTypeAlnum|CTypeLower) // ÿ
+
+	for b := 0xc0; b <= 0xde; b++ {
+		if b != 0xd7 { // skip '×' and '÷'
+			l.SetCase(byte(b), byte(b+0x20))
+		}
+	}
+}
+
+// Name returns the name of the locale.
+func (l *Locale) Name() string {
+	return l.name
+}
+
+// Fingerprint returns a hash of the character table, so two locales with the same fingerprint match the
+// same bytes. The name of the locale is not part of the fingerprint.
+func (l *Locale) Fingerprint() string {
+	h := sha256.New()
+	for _, c := range l.ctype {
+		h.Write([]byte{byte(c)})
+	}
+	h.Write(l.lower[:])
+	h.Write(l.upper[:])
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SetClass sets the character classes of byte `b`.
+func (l *Locale) SetClass(b byte, c CType) {
+	l.ctype[b] = c
+}
+
+// SetCase declares the bytes `upper` and `lower` as the upper and lower case of the same letter.
+// Both bytes are then also marked as alphanumeric.
+func (l *Locale) SetCase(upper, lower byte) {
+	l.ctype[upper] = CTypeAlnum | CTypeUpper
+	l.ctype[lower] = CTypeAlnum | CTypeLower
+	l.lower[upper] = lower
+	l.upper[lower] = upper
+}
+
+// Class returns the character classes of byte `b`.
+func (l *Locale) Class(b byte) CType {
+	return l.ctype[b]
+}
+
+// ToLower returns the lower case of byte `b`, like the C function `tolower`.
+func (l *Locale) ToLower(b byte) byte {
+	return l.lower[b]
+}
+
+// ToUpper returns the upper case of byte `b`, like the C function `toupper`.
+func (l *Locale) ToUpper(b byte) byte {
+	return l.upper[b]
+}
+
+// isWord reports, whether the byte is matched by the category `\w`.
+func (l *Locale) isWord(b byte) bool {
+	return b == '_' || l.ctype[b]&CTypeAlnum != 0
+}
+
+// isSpace reports, whether the byte is matched by the category `\s`.
+func (l *Locale) isSpace(b byte) bool {
+	return l.ctype[b]&CTypeSpace != 0
+}
+
+// hasASCIIWords reports, whether the locale only contains the ASCII word characters.
+// In this case, `\b` and `\B` do not need to be rewritten.
+func (l *Locale) hasASCIIWords() bool {
+	for i := 0; i < 256; i++ {
+		b := byte(i)
+		ascii := b == '_' || isDigitByte(b) || isASCIILetterByte(b)
+
+		if l.isWord(b) != ascii {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ranges returns a slice of ranges, that includes all bytes matching the function `fn`.
+// If `negate` is true, the ranges include all bytes not matching `fn` instead.
+func (l *Locale) ranges(fn func(b byte) bool, negate bool) []rune {
+	var r []rune
+	for i := 0; i < 256; i++ {
+		if fn(byte(i)) != negate {
+			r = appendRange(r, rune(i), rune(i))
+		}
+	}
+
+	return r
+}
+
+// foldedRanges returns a slice of ranges, that contains all bytes, that are matched by the range `[lo-hi]`
+// if cases are ignored. Like in Python, a byte `c` matches the range if either `c`, `tolower(c)` or
+// `toupper(c)` are in the range.
+func (l *Locale) foldedRanges(lo, hi rune) []rune {
+	return l.ranges(func(b byte) bool {
+		return inRange(lo, hi, rune(b)) || inRange(lo, hi, rune(l.lower[b])) || inRange(lo, hi, rune(l.upper[b]))
+	}, false)
+}
@@ -0,0 +1,562 @@
+package regex
+
+import (
+	"sync"
+	"unicode"
+)
+
+// btOp is the opcode of an instruction of the backtracking engine.
+type btOp uint8
+
+// Opcodes of the backtracking engine. The instructions are executed one after another, unless they jump.
+// The bodies of atomic groups, lookarounds and possessive repeats end with `btEnd`, which only keeps the first
+// match of the body (see `btMatcher.run`).
+const (
+	btMatch            btOp = iota // the pattern matched
+	btFail                         // never matches
+	btChars                        // match a sequence of character sets
+	btAt                           // match a position
+	btJmp                          // continue at `x`
+	btSplit                        // continue at the next instruction; on backtracking, continue at `x`
+	btGroupStart                   // store the start position of group `x`
+	btGroupEnd                     // store the match of group `x`
+	btGroupref                     // match the text of group `x`
+	btGrouprefExists               // continue at the next instruction, if group `x` matched, otherwise at `y`
+	btRepeatInit                   // reset the counter of repeat `x`
+	btRepeatGreedy                 // repeat the body following the instruction as often as possible; continue at `y`
+	btRepeatLazy                   // repeat the body following the instruction as rarely as possible; continue at `y`
+	btRepeatPossessive             // repeat the body following the instruction without backtracking; continue at `y`
+	btCharRepeat                   // repeat a single character set
+	btAtomic                       // start of an atomic group
+	btLookahead                    // start of a lookahead; continue at `y`
+	btLookbehind                   // start of a lookbehind; continue at `y`
+	btEnd                          // end of an atomic group, a lookaround or a repetition of a possessive repeat
+)
+
+// btInst is an instruction of the backtracking engine.
+type btInst struct {
+	op       btOp
+	x, y     int    // group, repeat or jump targets
+	min, max int    // repeat counts or widths of lookbehinds
+	kind     opcode // type of a character repeat: `opMinRepeat`, `opMaxRepeat` or `opPossessiveRepeat`
+	negate   bool   // negative lookaround
+	sets     []*charSet
+	at       func(m *btMatcher, pos int) bool
+	equal    func(a, b rune) bool // compares characters of group references; nil for exact comparisons
+}
+
+// btProgram is a regex pattern compiled into instructions of the backtracking engine.
+type btProgram struct {
+	inst    []btInst
+	repeats int // number of repeats with counters
+}
+
+// charSet is a set of characters, that is matched by a single regex node.
+// The set is represented as sorted and non-overlapping ranges of characters.
+type charSet struct {
+	r      []rune
+	negate bool
+}
+
+// contains reports, whether the character is contained in the set.
+func (c *charSet) contains(ch rune) bool {
+	r := c.r
+	found := false
+
+	if len(r) <= 16 {
+		for i := 0; i < len(r); i += 2 {
+			if ch < r[i] {
+				break
+			}
+			if ch <= r[i+1] {
+				found = true
+				break
+			}
+		}
+	} else {
+		lo, hi := 0, len(r)/2
+		for lo < hi {
+			m := lo + (hi-lo)/2
+			if ch < r[2*m] {
+				hi = m
+			} else if ch > r[2*m+1] {
+				lo = m + 1
+			} else {
+				found = true
+				break
+			}
+		}
+	}
+
+	return found != c.negate
+}
+
+// asciiRanges contains the character sets of the categories `\d`, `\s` and `\w` for ASCII matching.
+var asciiRanges = map[catcode][]rune{
+	categoryDigit: {'0', '9'},
+	categorySpace: {'\t', '\r', ' ', ' '},
+	categoryWord:  {'0', '9', 'A', 'Z', '_', '_', 'a', 'z'},
+}
+
+var (
+	unicodeCategoriesOnce sync.Once          // guards the initialization of `unicodeCategories`
+	unicodeCategories     map[catcode][]rune // character sets of all categories for unicode matching
+)
+
+// unicodeCategoryRanges returns the character set of the category for unicode matching.
+// The character sets are built on the first call from `unicodeRanges`.
+func unicodeCategoryRanges(c catcode) []rune {
+	unicodeCategoriesOnce.Do(func() {
+		unicodeCategories = make(map[catcode][]rune, len(unicodeRanges))
+
+		for category := range unicodeRanges {
+			r, err := buildUnicodeRanges(category)
+			if err != nil {
+				panic(err)
+			}
+
+			unicodeCategories[category] = r
+		}
+	})
+
+	return unicodeCategories[c]
+}
+
+// negateRanges returns the complement of the sorted ranges within `[0, unicode.MaxRune]`.
+func negateRanges(r []rune) []rune {
+	var res []rune
+
+	next := rune(0)
+	for i := 0; i < len(r); i += 2 {
+		if r[i] > next {
+			res = append(res, next, r[i]-1)
+		}
+		next = r[i+1] + 1
+	}
+	if next <= unicode.MaxRune {
+		res = append(res, next, unicode.MaxRune)
+	}
+
+	return res
+}
+
+// categoryRanges returns the character set of the category for the flags of the current group.
+// Like in Python, only the categories `\w` and `\s` depend on the locale.
+func (p *preprocessor) categoryRanges(c catcode, flags uint32) []rune {
+	negate := false
+	switch c {
+	case categoryNotDigit, categoryNotSpace, categoryNotWord:
+		negate = true
+	}
+
+	if p.usesLocale(flags) {
+		l := p.locale
+
+		switch c {
+		case categorySpace, categoryNotSpace:
+			return l.ranges(l.isSpace, negate)
+		case categoryWord, categoryNotWord:
+			return l.ranges(l.isWord, negate)
+		}
+	}
+
+	if flags&FlagUnicode != 0 {
+		return unicodeCategoryRanges(c)
+	}
+
+	if negate {
+		return negateRanges(asciiRanges[c-1]) // each negated category directly follows its category
+	}
+
+	return asciiRanges[c]
+}
+
+// foldedRanges returns the character set of the range `[lo-hi]` for the flags of the current group.
+// If the IGNORECASE flag is set, the set contains all cases of the characters.
+func (p *preprocessor) foldedRanges(lo, hi rune, flags uint32) []rune {
+	if flags&FlagIgnoreCase == 0 {
+		return []rune{lo, hi}
+	}
+
+	if p.usesLocale(flags) {
+		return p.locale.foldedRanges(lo, hi)
+	}
+
+	return createFoldedRanges(lo, hi, flags&FlagASCII != 0 || !p.isStr)
+}
+
+// wordSet returns the set of word characters, that is used for word boundaries (`\b` and `\B`).
+func (p *preprocessor) wordSet(flags uint32) *charSet {
+	return &charSet{r: p.categoryRanges(categoryWord, flags)}
+}
+
+// compileCharSet compiles a regex node, that matches exactly one character, into a character set.
+// If the regex node does not match a single character, nil is returned.
+func (p *preprocessor) compileCharSet(n *regexNode, flags uint32) *charSet {
+	switch n.opcode {
+	case opLiteral:
+		return &charSet{r: p.foldedRanges(n.c, n.c, flags)}
+	case opNotLiteral:
+		return &charSet{r: p.foldedRanges(n.c, n.c, flags), negate: true}
+	case opAny:
+		if flags&FlagDotAll != 0 {
+			return &charSet{negate: true}
+		}
+
+		return &charSet{r: []rune{'\n', '\n'}, negate: true}
+	case opCategory:
+		return &charSet{r: p.categoryRanges(n.params.(catcode), flags)}
+	case opIn:
+		var (
+			r      []rune
+			negate bool
+		)
+
+		for _, item := range n.params.([]*regexNode) {
+			switch item.opcode {
+			case opNegate:
+				negate = true
+			case opLiteral:
+				r = append(r, p.foldedRanges(item.c, item.c, flags)...)
+			case opRange:
+				params := item.params.(rangeParams)
+				r = append(r, p.foldedRanges(params.lo, params.hi, flags)...)
+			case opCategory:
+				r = append(r, p.categoryRanges(item.params.(catcode), flags)...)
+			}
+		}
+
+		return &charSet{r: cleanClass(&r), negate: negate}
+	}
+
+	return nil
+}
+
+// compileProgram compiles the parsed regex pattern into a program for the backtracking engine.
+func (p *preprocessor) compileProgram(flags uint32) *btProgram {
+	c := btCompiler{p: p}
+	c.seq(p.p, flags)
+	c.emit(btInst{op: btMatch})
+
+	return &c.prog
+}
+
+// btCompiler compiles regex nodes into instructions of the backtracking engine.
+type btCompiler struct {
+	p    *preprocessor
+	prog btProgram
+}
+
+// emit appends the instruction to the program and returns its index.
+func (c *btCompiler) emit(inst btInst) int {
+	c.prog.inst = append(c.prog.inst, inst)
+	return len(c.prog.inst) - 1
+}
+
+// next returns the index of the next instruction.
+func (c *btCompiler) next() int {
+	return len(c.prog.inst)
+}
+
+// seq compiles the subpattern. The `flags` parameter contains the flags of the current group.
+// Consecutive regex nodes, that match single characters, are combined into a single instruction.
+func (c *btCompiler) seq(sp *subPattern, flags uint32) {
+	var chars []*charSet
+
+	flush := func() {
+		if len(chars) > 0 {
+			c.emit(btInst{op: btChars, sets: chars})
+			chars = nil
+		}
+	}
+
+	for _, n := range sp.data {
+		if set := c.p.compileCharSet(n, flags); set != nil {
+			chars = append(chars, set)
+			continue
+		}
+
+		flush()
+		c.node(n, flags)
+	}
+
+	flush()
+}
+
+// node compiles a regex node, that does not match a single character.
+func (c *btCompiler) node(n *regexNode, flags uint32) {
+	switch n.opcode {
+	case opFailure:
+		c.emit(btInst{op: btFail})
+	case opAt:
+		c.emit(btInst{op: btAt, at: c.p.compileAt(n.params.(atcode), flags)})
+	case opBranch:
+		items := n.params.([]*subPattern)
+
+		var jumps []int
+		for i, item := range items {
+			if i == len(items)-1 {
+				c.seq(item, flags)
+				break
+			}
+
+			split := c.emit(btInst{op: btSplit})
+			c.seq(item, flags)
+			jumps = append(jumps, c.emit(btInst{op: btJmp}))
+			c.prog.inst[split].x = c.next()
+		}
+
+		for _, j := range jumps {
+			c.prog.inst[j].x = c.next()
+		}
+	case opGroupref:
+		c.emit(btInst{op: btGroupref, x: n.params.(int), equal: c.p.foldEqual(flags)})
+	case opGrouprefExists:
+		params := n.params.(grouprefExParam)
+
+		cond := c.emit(btInst{op: btGrouprefExists, x: params.condgroup})
+		c.seq(params.itemYes, flags)
+
+		if params.itemNo != nil {
+			jump := c.emit(btInst{op: btJmp})
+			c.prog.inst[cond].y = c.next()
+			c.seq(params.itemNo, flags)
+			c.prog.inst[jump].x = c.next()
+		} else {
+			c.prog.inst[cond].y = c.next()
+		}
+	case opAssert, opAssertNot:
+		params := n.params.(assertParams)
+
+		inst := btInst{op: btLookahead, negate: n.opcode == opAssertNot}
+		if params.dir < 0 {
+			inst.op = btLookbehind
+			inst.min, inst.max = params.p.width()
+		}
+
+		start := c.emit(inst)
+		c.seq(params.p, flags)
+		c.emit(btInst{op: btEnd})
+		c.prog.inst[start].y = c.next()
+	case opMinRepeat, opMaxRepeat, opPossessiveRepeat:
+		params := n.params.(repeatParams)
+
+		if params.item.len() == 1 {
+			if set := c.p.compileCharSet(params.item.get(0), flags); set != nil {
+				c.emit(btInst{op: btCharRepeat, min: params.min, max: params.max, kind: n.opcode, sets: []*charSet{set}})
+				return
+			}
+		}
+
+		id := c.prog.repeats
+		c.prog.repeats++
+
+		op := btRepeatGreedy
+		switch n.opcode {
+		case opMinRepeat:
+			op = btRepeatLazy
+		case opPossessiveRepeat:
+			op = btRepeatPossessive
+		}
+
+		c.emit(btInst{op: btRepeatInit, x: id})
+		start := c.emit(btInst{op: op, x: id, min: params.min, max: params.max})
+		c.seq(params.item, flags)
+
+		if op == btRepeatPossessive {
+			c.emit(btInst{op: btEnd}) // continues with the next repetition
+		} else {
+			c.emit(btInst{op: btJmp, x: start})
+		}
+
+		c.prog.inst[start].y = c.next()
+	case opSubpattern:
+		params := n.params.(subPatternParam)
+		flags := combineFlags(flags, params.addFlags, params.delFlags)
+
+		if params.group < 0 {
+			c.seq(params.p, flags)
+			return
+		}
+
+		c.emit(btInst{op: btGroupStart, x: params.group})
+		c.seq(params.p, flags)
+		c.emit(btInst{op: btGroupEnd, x: params.group})
+	case opAtomicGroup:
+		c.emit(btInst{op: btAtomic})
+		c.seq(n.params.(*subPattern), flags)
+		c.emit(btInst{op: btEnd})
+	default:
+		// Character nodes are compiled by `compileCharSet`.
+		c.emit(btInst{op: btChars, sets: []*charSet{c.p.compileCharSet(n, flags)}})
+	}
+}
+
+// compileAt compiles a positional match (`^`, `\A`, `\b`, `\B`, `$` or `\Z`) with the semantics of Python.
+func (p *preprocessor) compileAt(at atcode, flags uint32) func(m *btMatcher, pos int) bool {
+	multiline := flags&FlagMultiline != 0
+
+	switch at {
+	case atBeginning:
+		return func(m *btMatcher, pos int) bool {
+			return pos == 0 || (multiline && m.s[pos-1] == '\n')
+		}
+	case atBeginningString:
+		return func(_ *btMatcher, pos int) bool {
+			return pos == 0
+		}
+	case atEnd:
+		return func(m *btMatcher, pos int) bool {
+			n := len(m.s)
+			if multiline {
+				return pos == n || m.s[pos] == '\n'
+			}
+
+			return pos == n || (pos == n-1 && m.s[pos] == '\n')
+		}
+	case atEndString:
+		return func(m *btMatcher, pos int) bool {
+			return pos == len(m.s)
+		}
+	}
+
+	word := p.wordSet(flags)
+	boundary := at == atBoundary
+
+	return func(m *btMatcher, pos int) bool {
+		// Like in Python, word boundaries never match in empty strings.
+		if len(m.s) == 0 {
+			return false
+		}
+
+		c1, size1 := m.prev(pos)
+		c2, size2 := m.next(pos)
+
+		w1 := size1 > 0 && word.contains(c1)
+		w2 := size2 > 0 && word.contains(c2)
+
+		return (w1 != w2) == boundary
+	}
+}
+
+// foldEqual returns a function, that compares two characters while ignoring cases, if the IGNORECASE flag is set.
+// If the flag is not set, nil is returned.
+func (p *preprocessor) foldEqual(flags uint32) func(a, b rune) bool {
+	if flags&FlagIgnoreCase == 0 {
+		return nil
+	}
+
+	if p.usesLocale(flags) {
+		l := p.locale
+
+		return func(a, b rune) bool {
+			return a == b || (a < 256 && b < 256 && l.lower[a] == l.lower[b])
+		}
+	}
+
+	fold := simpleFold
+	if flags&FlagASCII != 0 || !p.isStr {
+		fold = simpleFoldASCII
+	}
+
+	return func(a, b rune) bool {
+		if a == b {
+			return true
+		}
+
+		for f := fold(a); f != a; f = fold(f) {
+			if f == b {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// width returns the minimum and maximum number of characters, that are matched by the subpattern.
+// The maximum width is `maxRepeat`, if the subpattern may match an unlimited number of characters.
+func (p *subPattern) width() (int, int) {
+	lo, hi := 0, 0
+
+	for _, n := range p.data {
+		l, h := n.width()
+		lo = addWidth(lo, l)
+		hi = addWidth(hi, h)
+	}
+
+	return lo, hi
+}
+
+// width returns the minimum and maximum number of characters, that are matched by the regex node.
+func (n *regexNode) width() (int, int) {
+	switch n.opcode {
+	case opLiteral, opNotLiteral, opAny, opIn, opCategory:
+		return 1, 1
+	case opBranch:
+		lo, hi := maxRepeat, 0
+
+		for _, item := range n.params.([]*subPattern) {
+			l, h := item.width()
+			if l < lo {
+				lo = l
+			}
+			if h > hi {
+				hi = h
+			}
+		}
+
+		return lo, hi
+	case opGroupref:
+		return 0, maxRepeat
+	case opGrouprefExists:
+		params := n.params.(grouprefExParam)
+
+		lo, hi := params.itemYes.width()
+
+		l, h := 0, 0
+		if params.itemNo != nil {
+			l, h = params.itemNo.width()
+		}
+		if l < lo {
+			lo = l
+		}
+		if h > hi {
+			hi = h
+		}
+
+		return lo, hi
+	case opMinRepeat, opMaxRepeat, opPossessiveRepeat:
+		params := n.params.(repeatParams)
+
+		lo, hi := params.item.width()
+		return mulWidth(lo, params.min), mulWidth(hi, params.max)
+	case opSubpattern:
+		return n.params.(subPatternParam).p.width()
+	case opAtomicGroup:
+		return n.params.(*subPattern).width()
+	}
+
+	return 0, 0
+}
+
+// addWidth adds two widths, limited to `maxRepeat`.
+func addWidth(a, b int) int {
+	if a+b > maxRepeat {
+		return maxRepeat
+	}
+
+	return a + b
+}
+
+// mulWidth multiplies a width with a repeat count, limited to `maxRepeat`.
+func mulWidth(w, count int) int {
+	if w == 0 || count == 0 {
+		return 0
+	}
+	if count >= maxRepeat/w {
+		return maxRepeat
+	}
+
+	return w * count
+}
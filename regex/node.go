@@ -7,6 +7,8 @@ type regexNode struct {
 	opcode opcode // regex operator
 	c      rune   // literals are the most common node, so add an extra field for them
 	params any    // extra parameters; may be nil
+	pos    int    // start position of the node in the pattern
+	end    int    // end position of the node in the pattern
 }
 
 // Extra types, when more than one field exists in the extra parameters:
@@ -95,6 +97,14 @@ func (n *regexNode) equals(o *regexNode) bool {
 	return false
 }
 
+// span sets the position of the node in the pattern to `[pos, end)` and returns the node.
+// Nodes, that were not created by the parser, have no position.
+func (n *regexNode) span(pos, end int) *regexNode {
+	n.pos = pos
+	n.end = end
+	return n
+}
+
 // newEmptyNode creates a new node with a given opcode and no extra parameters.
 // Valid operators are FAILURE, ANY and NEGATE.
 func newEmptyNode(op opcode) *regexNode {
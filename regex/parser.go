@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"slices"
 	"strconv"
+	"strings"
 	"unicode/utf8"
 
 	"github.com/magnetde/starlark-re/util"
@@ -19,6 +20,7 @@ type state struct {
 	groupsclosed     []bool
 	lookbehindgroups int
 	grouprefpos      map[int]int
+	lint             *linter // receives pitfalls, that are removed by the simplifications of the parser; may be nil
 }
 
 // init initializes the parser state.
@@ -84,11 +86,19 @@ func (s *state) checkLookbehindGroup(gid int, src *source) error {
 // The parser is based on the parser used in the Python "re" module,
 // with all errors corresponding to those of the Python parser.
 func parse(str string, isStr bool, flags uint32) (*subPattern, error) {
+	return parseLint(str, isStr, flags, nil)
+}
+
+// parseLint is equivalent to `parse`, but additionally reports redundant groups, unreachable branches and
+// duplicate items of character classes to the linter, because these are removed while parsing.
+// The linter may be nil.
+func parseLint(str string, isStr bool, flags uint32, l *linter) (*subPattern, error) {
 	var s source
 	s.init(str, isStr)
 
 	var state state
 	state.init(flags)
+	state.lint = l
 
 	p, err := parseSub(&s, &state, flags&FlagVerbose != 0, 0)
 	if err != nil {
@@ -149,8 +159,13 @@ func parseSub(s *source, state *state, verbose bool, nested int) (*subPattern, e
 	// parse an alternation: a|b|c
 
 	var items []*subPattern
+	var starts []int
+
+	start := s.tell()
 
 	for {
+		starts = append(starts, s.tell())
+
 		t, err := parseInternal(s, state, verbose, nested+1, nested == 0 && len(items) == 0)
 		if err != nil {
 			return nil, err
@@ -167,6 +182,8 @@ func parseSub(s *source, state *state, verbose bool, nested int) (*subPattern, e
 		}
 	}
 
+	state.lint.alternatives(s, items, starts)
+
 	if len(items) == 1 {
 		return items[0], nil
 	}
@@ -229,9 +246,9 @@ func parseSub(s *source, state *state, verbose bool, nested int) (*subPattern, e
 	if appendSet {
 		// we can store this as a character set instead of a
 		// branch (the compiler may optimize this even more)
-		sp.append(newItemsNode(opIn, unique(set)))
+		sp.append(newItemsNode(opIn, unique(set)).span(start, s.tell()))
 	} else {
-		sp.append(newSubPatternsNode(opBranch, items))
+		sp.append(newSubPatternsNode(opBranch, items).span(start, s.tell()))
 	}
 
 	return sp, nil
@@ -255,6 +272,7 @@ func parseInternal(s *source, state *state, verbose bool, nested int, first bool
 			break // end of subpattern
 		}
 
+		pos := s.tell()
 		s.read()
 
 		if verbose {
@@ -270,7 +288,7 @@ func parseInternal(s *source, state *state, verbose bool, nested int, first bool
 
 		switch c {
 		default:
-			sp.append(newLiteral(c))
+			sp.append(newLiteral(c).span(pos, s.tell()))
 		// ')', '|' already handled
 		case '\\':
 			code, err := parseEscape(s, state, false /* not class */)
@@ -278,7 +296,7 @@ func parseInternal(s *source, state *state, verbose bool, nested int, first bool
 				return nil, err
 			}
 
-			sp.append(code)
+			sp.append(code.span(pos, s.tell()))
 
 		case '[':
 			here := s.tell() - 1
@@ -309,6 +327,8 @@ func parseInternal(s *source, state *state, verbose bool, nested int, first bool
 					code1 = newLiteral(c)
 				}
 
+				code1.span(start, s.tell())
+
 				if s.match('-') {
 					// potential range
 					ch, ok := s.read()
@@ -319,10 +339,10 @@ func parseInternal(s *source, state *state, verbose bool, nested int, first bool
 					if ch == ']' {
 						if code1.opcode == opIn {
 							items := code1.params.([]*regexNode)
-							code1 = items[0]
+							code1 = items[0].span(code1.pos, code1.end)
 						}
 
-						set = append(set, code1, newLiteral('-'))
+						set = append(set, code1, newLiteral('-').span(s.tell()-2, s.tell()-1))
 						break
 					}
 
@@ -346,25 +366,26 @@ func parseInternal(s *source, state *state, verbose bool, nested int, first bool
 						return nil, s.errorp(fmt.Sprintf("bad character range %s", s.orig[start:s.tell()]), start)
 					}
 
-					set = append(set, newRangeNode(opRange, lo, hi))
+					set = append(set, newRangeNode(opRange, lo, hi).span(start, s.tell()))
 				} else {
 					if code1.opcode == opIn {
 						items := code1.params.([]*regexNode)
-						code1 = items[0]
+						code1 = items[0].span(code1.pos, code1.end)
 					}
 
 					set = append(set, code1)
 				}
 			}
 
+			state.lint.class(s, set)
 			set = unique(set)
 
 			if len(set) == 1 && set[0].opcode == opLiteral {
 				// optimization
 				if negate {
-					sp.append(newCharNode(opNotLiteral, set[0].c))
+					sp.append(newCharNode(opNotLiteral, set[0].c).span(pos, s.tell()))
 				} else {
-					sp.append(set[0])
+					sp.append(set[0].span(pos, s.tell()))
 				}
 			} else {
 				if negate {
@@ -373,7 +394,7 @@ func parseInternal(s *source, state *state, verbose bool, nested int, first bool
 
 				// charmap optimization can't be added here because
 				// global flags still are not known
-				sp.append(newItemsNode(opIn, set))
+				sp.append(newItemsNode(opIn, set).span(pos, s.tell()))
 			}
 
 		case '?', '*', '+', '{':
@@ -390,30 +411,24 @@ func parseInternal(s *source, state *state, verbose bool, nested int, first bool
 				min, max = 1, maxRepeat
 			case '{':
 				if next, ok := s.peek(); ok && next == '}' {
-					sp.append(newLiteral(c))
+					sp.append(newLiteral(c).span(pos, here))
 					continue
 				}
 
 				var lo, hi int // temporary values
 				var hasLo, hasHi bool
 
-				lo, hasLo, err = s.nextInt()
-				if err != nil {
-					return nil, err
-				}
+				lo, hasLo = s.nextInt()
 
 				if s.match(',') {
-					hi, hasHi, err = s.nextInt()
-					if err != nil {
-						return nil, err
-					}
+					hi, hasHi = s.nextInt()
 				} else {
 					hi = lo
 					hasHi = hasLo
 				}
 
 				if !s.match('}') {
-					sp.append(newLiteral(c))
+					sp.append(newLiteral(c).span(pos, here))
 					s.seek(here)
 					continue
 				}
@@ -467,19 +482,22 @@ func parseInternal(s *source, state *state, verbose bool, nested int, first bool
 				subitem.append(item)
 			}
 
+			var op opcode
 			if s.match('?') {
 				// Non-Greedy Match
-				sp.set(-1, newRepeatNode(opMinRepeat, min, max, subitem))
+				op = opMinRepeat
 			} else if s.match('+') {
 				// Possessive Match (Always Greedy)
-				sp.set(-1, newRepeatNode(opPossessiveRepeat, min, max, subitem))
+				op = opPossessiveRepeat
 			} else {
 				// Greedy Match
-				sp.set(-1, newRepeatNode(opMaxRepeat, min, max, subitem))
+				op = opMaxRepeat
 			}
 
+			sp.set(-1, newRepeatNode(op, min, max, subitem).span(item.pos, s.tell()))
+
 		case '.':
-			sp.append(newEmptyNode(opAny))
+			sp.append(newEmptyNode(opAny).span(pos, s.tell()))
 
 		case '(':
 			start := s.tell() - 1
@@ -536,7 +554,7 @@ func parseInternal(s *source, state *state, verbose bool, nested int, first bool
 							return nil, err
 						}
 
-						sp.append(newGrouprefNode(opGroupref, gid))
+						sp.append(newGrouprefNode(opGroupref, gid).span(pos, s.tell()))
 						continue
 
 					} else {
@@ -601,11 +619,11 @@ func parseInternal(s *source, state *state, verbose bool, nested int, first bool
 					}
 
 					if char == '=' {
-						sp.append(newAssertNode(opAssert, dir, p))
+						sp.append(newAssertNode(opAssert, dir, p).span(pos, s.tell()))
 					} else if p.len() > 0 {
-						sp.append(newAssertNode(opAssertNot, dir, p))
+						sp.append(newAssertNode(opAssertNot, dir, p).span(pos, s.tell()))
 					} else {
-						sp.append(newEmptyNode(opFailure))
+						sp.append(newEmptyNode(opFailure).span(pos, s.tell()))
 					}
 
 					continue
@@ -618,7 +636,7 @@ func parseInternal(s *source, state *state, verbose bool, nested int, first bool
 					}
 
 					var condgroup int
-					if ugroup, e := strconv.ParseUint(condname, 10, 32); e != nil {
+					if !isDigitString(condname) {
 						err = s.checkGroupName(condname, 1)
 						if err != nil {
 							return nil, err
@@ -629,11 +647,12 @@ func parseInternal(s *source, state *state, verbose bool, nested int, first bool
 							return nil, s.erroro(fmt.Sprintf("unknown group name %s", util.Repr(condname, true)), len(condname)+1)
 						}
 					} else {
-						if ugroup == 0 {
+						ugroup, e := strconv.ParseUint(condname, 10, 32)
+						if e == nil && ugroup == 0 {
 							return nil, s.erroro("bad group number", len(condname)+1)
 						}
-						if ugroup >= maxGroups {
-							return nil, s.erroro(fmt.Sprintf("invalid group reference %d", condgroup), len(condname)+1)
+						if e != nil || ugroup >= maxGroups {
+							return nil, s.erroro("invalid group reference "+strings.TrimLeft(condname, "0"), len(condname)+1)
 						}
 
 						condgroup = int(ugroup)
@@ -670,7 +689,7 @@ func parseInternal(s *source, state *state, verbose bool, nested int, first bool
 						return nil, s.errorp("missing ), unterminated subpattern", start)
 					}
 
-					sp.append(newGrouprefExistsNode(opGrouprefExists, condgroup, itemYes, itemNo))
+					sp.append(newGrouprefExistsNode(opGrouprefExists, condgroup, itemYes, itemNo).span(pos, s.tell()))
 					continue
 
 				case '>':
@@ -718,6 +737,8 @@ func parseInternal(s *source, state *state, verbose bool, nested int, first bool
 				return nil, err
 			}
 
+			alternation := state.lint.alternation()
+
 			if !s.match(')') {
 				return nil, s.errorp("missing ), unterminated subpattern", start)
 			}
@@ -727,15 +748,20 @@ func parseInternal(s *source, state *state, verbose bool, nested int, first bool
 			}
 
 			if atomic {
-				sp.append(newAtomicGroupNode(opAtomicGroup, p))
+				sp.append(newAtomicGroupNode(opAtomicGroup, p).span(pos, s.tell()))
 			} else {
-				sp.append(newSubPatternNode(opSubpattern, group, addFlags, delFlags, p))
+				n := newSubPatternNode(opSubpattern, group, addFlags, delFlags, p).span(pos, s.tell())
+				if group == -1 && addFlags == 0 && delFlags == 0 {
+					state.lint.group(s, n, alternation)
+				}
+
+				sp.append(n)
 			}
 
 		case '^':
-			sp.append(newAtNode(opAt, atBeginning))
+			sp.append(newAtNode(opAt, atBeginning).span(pos, s.tell()))
 		case '$':
-			sp.append(newAtNode(opAt, atEnd))
+			sp.append(newAtNode(opAt, atEnd).span(pos, s.tell()))
 		}
 	}
 
@@ -0,0 +1,172 @@
+package regex
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// prefilter is a literal, that is contained in every match of a regex pattern.
+// Before a regex engine searches the input, the prefilter skips all regions of the input, where no match
+// can start, by searching the literal with `strings.Index`. This is particularly useful for the engines,
+// that try to match the pattern at every start position.
+type prefilter struct {
+	literal   string // literal contained in every match
+	maxOffset int    // maximum number of bytes before the literal in a match; -1 if unbounded
+}
+
+// newPrefilter creates a prefilter for the literal, which is preceded by at most `maxOffset` bytes in a match.
+// If the literal is empty, nil is returned.
+func newPrefilter(literal string, maxOffset int) *prefilter {
+	if literal == "" {
+		return nil
+	}
+
+	f := prefilter{
+		literal:   literal,
+		maxOffset: maxOffset,
+	}
+
+	return &f
+}
+
+// index returns the position of the next occurrence of the literal in `s`, starting at position `pos`.
+// If the literal does not occur, -1 is returned.
+func (f *prefilter) index(s string, pos int) int {
+	i := strings.Index(s[pos:], f.literal)
+	if i < 0 {
+		return -1
+	}
+
+	return pos + i
+}
+
+// start returns the first position at or after `pos`, where a match containing the occurrence
+// of the literal at position `occ` may start. The position is always the start of a character.
+func (f *prefilter) start(s string, pos, occ int) int {
+	if f.maxOffset < 0 || occ-f.maxOffset <= pos {
+		return pos
+	}
+
+	start := occ - f.maxOffset
+	for start > pos && !utf8.RuneStart(s[start]) {
+		start--
+	}
+
+	return start
+}
+
+// skip returns the first position at or after `pos`, where a match may start.
+// If the input cannot contain a match after `pos`, -1 is returned.
+// If the prefilter is nil, `pos` is returned.
+func (f *prefilter) skip(s string, pos int) int {
+	if f == nil || pos > len(s) {
+		return pos
+	}
+
+	occ := f.index(s, pos)
+	if occ < 0 {
+		return -1
+	}
+
+	return f.start(s, pos, occ)
+}
+
+// prefilter extracts the longest literal, that is contained in every match of the regex pattern.
+// Only literals of the top-level sequence of the pattern are considered, including literals of groups,
+// since each of these regex nodes must be matched. If multiple literals have the same length, the literal
+// closest to the start of the pattern is used. If no literal is found, or if the pattern can only match
+// at the beginning of the string, nil is returned.
+func (p *preprocessor) prefilter() *prefilter {
+	nodes, flags := p.flatten(p.p, p.flags(), nil, nil)
+
+	if len(nodes) > 0 && nodes[0].opcode == opAt {
+		switch nodes[0].params.(atcode) {
+		case atBeginningString:
+			return nil
+		case atBeginning:
+			if flags[0]&FlagMultiline == 0 {
+				return nil
+			}
+		}
+	}
+
+	charSize := 1
+	if p.isStr {
+		charSize = utf8.UTFMax
+	}
+
+	var (
+		best, curr             []byte
+		bestOffset, currOffset int
+	)
+
+	offset := 0 // maximum number of characters before the current node
+
+	for i, n := range nodes {
+		if c, ok := p.prefilterLiteral(n, flags[i]); ok {
+			if len(curr) == 0 {
+				currOffset = offset
+			}
+
+			if p.isStr {
+				curr = utf8.AppendRune(curr, c)
+			} else {
+				curr = append(curr, byte(c))
+			}
+		} else {
+			if len(curr) > len(best) {
+				best, bestOffset = curr, currOffset
+			}
+			curr = nil
+		}
+
+		_, hi := n.width()
+		offset = addWidth(offset, hi)
+	}
+
+	if len(curr) > len(best) {
+		best, bestOffset = curr, currOffset
+	}
+
+	maxOffset := -1
+	if bestOffset < maxRepeat {
+		maxOffset = bestOffset * charSize
+	}
+
+	return newPrefilter(string(best), maxOffset)
+}
+
+// flatten appends all regex nodes of the sequence of the subpattern to `nodes`, together with their flags.
+// The nodes of groups and atomic groups are added instead of the group itself.
+func (p *preprocessor) flatten(sp *subPattern, flags uint32, nodes []*regexNode, nodeFlags []uint32) ([]*regexNode, []uint32) {
+	for _, n := range sp.data {
+		switch n.opcode {
+		case opSubpattern:
+			params := n.params.(subPatternParam)
+			nodes, nodeFlags = p.flatten(params.p, combineFlags(flags, params.addFlags, params.delFlags), nodes, nodeFlags)
+		case opAtomicGroup:
+			nodes, nodeFlags = p.flatten(n.params.(*subPattern), flags, nodes, nodeFlags)
+		default:
+			nodes = append(nodes, n)
+			nodeFlags = append(nodeFlags, flags)
+		}
+	}
+
+	return nodes, nodeFlags
+}
+
+// prefilterLiteral reports, whether the regex node is a literal, that is matched by exactly the same bytes
+// in the input. This is not the case, if cases are ignored. For strings, the characters U+0080 to U+00FF
+// are also excluded, because the regex engines match them with invalid UTF-8 bytes of the same value.
+func (p *preprocessor) prefilterLiteral(n *regexNode, flags uint32) (rune, bool) {
+	if n.opcode != opLiteral || flags&FlagIgnoreCase != 0 {
+		return 0, false
+	}
+
+	c := n.c
+	if p.isStr && ((c >= utf8.RuneSelf && c <= 0xff) || !utf8.ValidRune(c)) {
+		return 0, false
+	}
+
+	return c, true
+}
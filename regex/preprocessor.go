@@ -20,22 +20,27 @@ const (
 // preprocessor is a type, that converts a Python-compatible regex pattern to regex pattern,
 // that is compatible with either the `regexp.Regexp` or `regexp2.Regexp` engines.
 type preprocessor struct {
-	isStr bool
-	p     *subPattern
+	pattern string // original regex pattern
+	isStr   bool
+	p       *subPattern
+	locale  *Locale // may be nil
 }
 
 // newPreprocessor creates a new regex preprocessor by parsing the regex pattern.
 // If the regex pattern where passed as a bytes object, the `isStr` parameter should be set to false.
 // The `flags` parameter should contain flags compatible with Python.
-func newPreprocessor(s string, isStr bool, flags uint32) (*preprocessor, error) {
+// The locale is used for bytes patterns with the LOCALE flag and may be nil.
+func newPreprocessor(s string, isStr bool, flags uint32, loc *Locale) (*preprocessor, error) {
 	sp, err := parse(s, isStr, flags)
 	if err != nil {
 		return nil, err
 	}
 
 	p := &preprocessor{
-		isStr: isStr,
-		p:     sp,
+		pattern: s,
+		isStr:   isStr,
+		p:       sp,
+		locale:  loc,
 	}
 
 	return p, nil
@@ -52,20 +57,24 @@ func (p *preprocessor) groupNames() map[string]int {
 	return p.p.state.groupdict
 }
 
-// isSupported checks, if the current pattern is supported by the regexp engine `regexp.Regexp`
-// (regex engine of the Go standard library).
-func (p *preprocessor) isSupported() bool {
-	if p.p.isUnsupported() {
-		return false
-	}
+// capabilities returns the capabilities, that a regex engine requires to match the current pattern.
+// The regexp engine `regexp.Regexp` (regex engine of the Go standard library) does not support any of them.
+func (p *preprocessor) capabilities() Capabilities {
+	c := p.p.capabilities()
 
 	for group := range p.p.state.groupdict {
 		if !isGoIdentifer(group) {
-			return false
+			c |= CapGroupNames
+			break
 		}
 	}
 
-	return true
+	// Word boundaries of locales with non-ASCII word characters are rewritten to lookarounds.
+	if p.locale != nil && !p.locale.hasASCIIWords() && p.hasLocaleBoundary(p.p, p.flags()) {
+		c |= CapLookaround
+	}
+
+	return c
 }
 
 // isGoIdentifer checks, if name is a valid Go identifier.
@@ -180,6 +189,10 @@ func (p *preprocessor) defaultReplacer(w *subPatternWriter, n *regexNode, ctx *s
 		flags = combineFlags(flags, addFlags, delFlags)
 	}
 
+	if p.usesLocale(flags) {
+		return p.localeReplacer(w, n, ctx, flags, std)
+	}
+
 	isUnicode := flags&FlagUnicode != 0
 	ignorecase := flags&FlagIgnoreCase != 0
 	ascii := flags&FlagASCII != 0 || !p.isStr
@@ -191,12 +204,20 @@ func (p *preprocessor) defaultReplacer(w *subPatternWriter, n *regexNode, ctx *s
 		// as `regexp.Regexp` only matches ASCII patterns by default.
 		// Categories are always inside of character sets.
 
+		category := n.params.(catcode)
+
+		// Without unicode matching, only the category `\s` differs, because the ASCII classes of the
+		// regex engines do not contain the vertical tab `\v`.
 		if !isUnicode {
+			switch category {
+			case categorySpace, categoryNotSpace:
+				writeRanges(w, p.categoryRanges(category, flags))
+				return true
+			}
+
 			return false
 		}
 
-		category := n.params.(catcode)
-
 		// Check if the shorter unicode character sets can be added to the regex, which are only fully
 		// supported by the default regex engine. Also, they can only be used if the current category does
 		// not negate the set or if the current category regex node is the only element in the character set.
@@ -297,6 +318,177 @@ func combineFlags(flags, addFlags, delFlags uint32) uint32 {
 	return (flags | addFlags) & ^delFlags
 }
 
+// usesLocale reports, whether regex nodes with the given flags are matched by using the locale.
+// This is only the case for bytes patterns with the LOCALE flag, if a locale was passed to the preprocessor.
+func (p *preprocessor) usesLocale(flags uint32) bool {
+	return !p.isStr && flags&FlagLocale != 0 && p.locale != nil
+}
+
+// localeReplacer is the replacer for regex nodes, that are matched by using the locale.
+// Similar to `defaultReplacer`, it rewrites the nodes of type CATEGORY, LITERAL and RANGE, but the characters
+// are determined by using the locale table instead of the unicode tables. Since the case folding of the
+// locale is not symmetric, nodes of type NOT_LITERAL are also rewritten if the IGNORECASE flag is set.
+// Only the categories `\w` and `\s` depend on the locale; the category `\d` always matches ASCII digits.
+// Word boundaries (`\b` and `\B`) are rewritten to lookarounds for the fallback engine, if the locale
+// contains non-ASCII word characters.
+func (p *preprocessor) localeReplacer(w *subPatternWriter, n *regexNode, ctx *subPatternContext, flags uint32, std bool) bool {
+	l := p.locale
+	ignorecase := flags&FlagIgnoreCase != 0
+
+	switch n.opcode {
+	case opCategory:
+		// Categories are always inside of character sets.
+
+		var r []rune
+
+		switch category := n.params.(catcode); category {
+		case categorySpace, categoryNotSpace:
+			r = l.ranges(l.isSpace, category == categoryNotSpace)
+		case categoryWord, categoryNotWord:
+			r = l.ranges(l.isWord, category == categoryNotWord)
+		default:
+			return false
+		}
+
+		writeLocaleRanges(w, r)
+		return true
+	case opLiteral:
+		if !ignorecase {
+			return false
+		}
+
+		r := l.foldedRanges(n.c, n.c)
+
+		if len(r) == 2 && r[0] == r[1] {
+			w.writeLiteral(r[0])
+		} else if ctx.inSet {
+			writeRanges(w, r)
+		} else {
+			w.writeByte('[')
+			writeRanges(w, r)
+			w.writeByte(']')
+		}
+
+		return true
+	case opNotLiteral:
+		if !ignorecase {
+			return false
+		}
+
+		w.writeString("[^")
+		writeLocaleRanges(w, l.foldedRanges(n.c, n.c))
+		w.writeByte(']')
+
+		return true
+	case opRange:
+		if !ignorecase {
+			return false
+		}
+
+		p := n.params.(rangeParams)
+
+		writeLocaleRanges(w, l.foldedRanges(p.lo, p.hi))
+		return true
+	case opAt:
+		at := n.params.(atcode)
+		if std || (at != atBoundary && at != atNonBoundary) || l.hasASCIIWords() {
+			return false
+		}
+
+		// A word boundary is the position, where exactly one of both adjacent characters is a word character.
+		// So `\b` is rewritten to `(?:(?<=W)(?!W)|(?<!W)(?=W))` and `\B` to `(?:(?<=W)(?=W)|(?<!W)(?!W))`,
+		// where `W` is the set of all word characters.
+
+		word := l.ranges(l.isWord, false)
+
+		writeWord := func(prefix string) {
+			w.writeString(prefix)
+			w.writeByte('[')
+			writeLocaleRanges(w, word)
+			w.writeString("])")
+		}
+
+		w.writeString("(?:")
+		writeWord("(?<=")
+		if at == atBoundary {
+			writeWord("(?!")
+		} else {
+			writeWord("(?=")
+		}
+		w.writeByte('|')
+		writeWord("(?<!")
+		if at == atBoundary {
+			writeWord("(?=")
+		} else {
+			writeWord("(?!")
+		}
+		w.writeByte(')')
+
+		return true
+	}
+
+	return false
+}
+
+// writeLocaleRanges writes the slice of byte ranges to the subpattern writer.
+// If the slice is empty, the character U+0100 is written instead, which cannot appear in the input of bytes patterns.
+// This is necessary, because empty character sets are not allowed.
+func writeLocaleRanges(w *subPatternWriter, r []rune) {
+	if len(r) == 0 {
+		w.writeLiteral(0x100)
+		return
+	}
+
+	writeRanges(w, r)
+}
+
+// hasLocaleBoundary reports, whether the subpattern contains any word boundaries (`\b` or `\B`),
+// that are matched by using the locale. The `flags` parameter contains the flags of the current group.
+func (p *preprocessor) hasLocaleBoundary(sp *subPattern, flags uint32) bool {
+	for _, n := range sp.data {
+		switch n.opcode {
+		case opAt:
+			at := n.params.(atcode)
+			if (at == atBoundary || at == atNonBoundary) && p.usesLocale(flags) {
+				return true
+			}
+		case opAssert, opAssertNot:
+			if p.hasLocaleBoundary(n.params.(assertParams).p, flags) {
+				return true
+			}
+		case opBranch:
+			for _, item := range n.params.([]*subPattern) {
+				if p.hasLocaleBoundary(item, flags) {
+					return true
+				}
+			}
+		case opGrouprefExists:
+			params := n.params.(grouprefExParam)
+			if p.hasLocaleBoundary(params.itemYes, flags) {
+				return true
+			}
+			if params.itemNo != nil && p.hasLocaleBoundary(params.itemNo, flags) {
+				return true
+			}
+		case opMinRepeat, opMaxRepeat, opPossessiveRepeat:
+			if p.hasLocaleBoundary(n.params.(repeatParams).item, flags) {
+				return true
+			}
+		case opSubpattern:
+			params := n.params.(subPatternParam)
+			if p.hasLocaleBoundary(params.p, combineFlags(flags, params.addFlags, params.delFlags)) {
+				return true
+			}
+		case opAtomicGroup:
+			if p.hasLocaleBoundary(n.params.(*subPattern), flags) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 // buildUnicodeRanges creates a slice of ranges, that includes all unicode characters matching the regex category.
 func buildUnicodeRanges(c catcode) ([]rune, error) {
 	r, ok := unicodeRanges[c]
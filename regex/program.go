@@ -0,0 +1,86 @@
+package regex
+
+import "fmt"
+
+// Names of the available regex engines.
+const (
+	EngineStd       = "std"       // default regex engine `regexp.Regexp`
+	EngineFallback  = "fallback"  // fallback regex engine `regexp2.Regexp`
+	EngineBacktrack = "backtrack" // native backtracking engine
+)
+
+// Program is the serializable form of a compiled regex engine.
+// It contains the preprocessed regex pattern, so that the engine can be restored with `Restore`
+// without parsing and preprocessing the original pattern again.
+// The field `GroupNames` is only used by the fallback engine, because its preprocessed regex pattern
+// does not contain any group names (see `preprocessor.fallbackPattern`).
+// The backtracking engine has no preprocessed regex pattern, so its program contains the original pattern,
+// which is parsed again when restoring the engine. Since the locale is not serializable, the field `Locale`
+// must be set to the locale, that was used to compile the pattern, before restoring the program.
+// The fields `Literal` and `LiteralOffset` contain the literal, that is contained in every match, and
+// the maximum number of bytes before the literal in a match (-1 if unbounded). They are used to skip
+// regions of the input, that cannot contain a match.
+type Program struct {
+	Engine        string         `json:"engine"`
+	Pattern       string         `json:"pattern"`
+	Flags         uint32         `json:"flags"`
+	IsStr         bool           `json:"is_str"`
+	GroupNames    map[string]int `json:"group_names,omitempty"`
+	Literal       string         `json:"literal,omitempty"`
+	LiteralOffset int            `json:"literal_offset,omitempty"`
+	Locale        *Locale        `json:"-"`
+}
+
+// Restore compiles the preprocessed regex pattern of the program with the selected regex engine.
+// The program should have been created by calling `Program` on a compiled regex engine.
+func Restore(p *Program) (Engine, error) {
+	info := lookupEngine(p.Engine)
+	if info == nil {
+		return nil, fmt.Errorf("unknown regex engine %q", p.Engine)
+	}
+	if info.Restore == nil {
+		return nil, fmt.Errorf("regex engine %q cannot be restored", p.Engine)
+	}
+
+	return info.Restore(p)
+}
+
+// prefilter returns the prefilter of the program or nil, if the program has no literal.
+func (p *Program) prefilter() *prefilter {
+	return newPrefilter(p.Literal, p.LiteralOffset)
+}
+
+// setPrefilter stores the prefilter in the program. The prefilter may be nil.
+func (p *Program) setPrefilter(f *prefilter) {
+	if f != nil {
+		p.Literal = f.literal
+		p.LiteralOffset = f.maxOffset
+	}
+}
+
+// Program is the implementation of the `Program` function for the `Engine` interface.
+func (r *stdRegex) Program() *Program {
+	p := Program{
+		Engine:  EngineStd,
+		Pattern: r.re.String(),
+		Flags:   r.flags,
+		IsStr:   r.isStr,
+	}
+
+	p.setPrefilter(r.filter)
+	return &p
+}
+
+// Program is the implementation of the `Program` function for the `Engine` interface.
+func (r *fallbEngine) Program() *Program {
+	p := Program{
+		Engine:     EngineFallback,
+		Pattern:    r.re.String(),
+		Flags:      r.flags,
+		IsStr:      r.isStr,
+		GroupNames: r.groupNames,
+	}
+
+	p.setPrefilter(r.filter)
+	return &p
+}
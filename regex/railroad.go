@@ -0,0 +1,371 @@
+package regex
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+// Layout constants of railroad diagrams in pixels.
+const (
+	rrCharWidth = 8  // width of a character of the monospace font
+	rrBoxHeight = 22 // height of the boxes of literals, classes and positions
+	rrBoxPad    = 10 // horizontal padding inside of boxes
+	rrGap       = 10 // length of the lines between items and the spacing between alternatives
+	rrRail      = 20 // width reserved for the rails of branches and repeats on each side
+	rrLabel     = 14 // height of the labels of groups and repeats
+	rrMargin    = 20 // margin around the diagram
+)
+
+// RailroadSVG parses the regex pattern and returns a railroad diagram of the pattern as an SVG image.
+// Literals are drawn as rounded boxes, classes, categories and positions as boxes with their source text.
+// Branches are drawn as parallel tracks, repeats as loops below the repeated item (with a track above it, if
+// the item is optional) and groups and lookarounds as labeled frames.
+// If the pattern is invalid, the parser error is returned.
+func RailroadSVG(pattern string, isStr bool, flags uint32) (string, error) {
+	sp, err := parse(pattern, isStr, flags)
+	if err != nil {
+		return "", err
+	}
+
+	e := newExplainer(pattern, sp, isStr)
+	root := e.railroadSeq(sp)
+
+	w, up, down := root.size()
+	width := 2*rrMargin + 2*rrGap + w + 2*rrGap
+	height := 2*rrMargin + up + down
+	y := rrMargin + up
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" class="railroad-diagram" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		width, height, width, height)
+	b.WriteString("<style>" +
+		"path{stroke-width:2;stroke:black;fill:none}" +
+		"rect{stroke-width:2;stroke:black;fill:#f3f3ff}" +
+		"rect.group{fill:none;stroke:gray;stroke-width:1}" +
+		"rect.lookaround{fill:none;stroke:gray;stroke-width:1;stroke-dasharray:4}" +
+		"text{font:12px monospace;text-anchor:middle}" +
+		"text.label{font-size:10px;text-anchor:start;fill:gray}" +
+		"</style>\n")
+
+	// start and end of the diagram
+	x := rrMargin
+	fmt.Fprintf(&b, `<path d="M%d %dv20M%d %dv20"/>`+"\n", x, y-10, x+rrGap/2, y-10)
+	railroadLine(&b, x, y, 2*rrGap)
+
+	x += 2 * rrGap
+	root.draw(&b, x, y)
+
+	x += w
+	railroadLine(&b, x, y, 2*rrGap)
+	fmt.Fprintf(&b, `<path d="M%d %dv20M%d %dv20"/>`+"\n", x+rrGap+rrGap/2, y-10, x+2*rrGap, y-10)
+
+	b.WriteString("</svg>\n")
+
+	return b.String(), nil
+}
+
+// railroadElem is an element of a railroad diagram.
+// All elements are entered on the left side and left on the right side at the height of their main line.
+type railroadElem interface {
+	// size returns the width of the element and its heights above and below the main line.
+	size() (w, up, down int)
+
+	// draw draws the element, where `x` is the left side of the element and `y` the height of its main line.
+	draw(b *strings.Builder, x, y int)
+}
+
+// railroadSeq creates the element of a subpattern.
+func (e *explainer) railroadSeq(sp *subPattern) railroadElem {
+	var seq rrSeq
+
+	for _, item := range e.diagramItems(sp) {
+		seq.items = append(seq.items, e.railroadItem(item))
+	}
+
+	return &seq
+}
+
+// railroadItem creates the element of a single item of a subpattern.
+func (e *explainer) railroadItem(item diagramItem) railroadElem {
+	n := item.n
+
+	switch n.opcode {
+	case opLiteral:
+		return &rrBox{text: item.label, rounded: true}
+	case opBranch:
+		var c rrChoice
+		for _, alt := range n.params.([]*subPattern) {
+			c.alts = append(c.alts, e.railroadSeq(alt))
+		}
+
+		return &c
+	case opSubpattern:
+		p := n.params.(subPatternParam)
+		return &rrFrame{label: e.subpattern(p), item: e.railroadSeq(p.p)}
+	case opAtomicGroup:
+		return &rrFrame{label: "atomic group", item: e.railroadSeq(n.params.(*subPattern))}
+	case opAssert, opAssertNot:
+		p := n.params.(assertParams)
+		return &rrFrame{label: describeAssert(n.opcode, p.dir), item: e.railroadSeq(p.p), dashed: true}
+	case opGrouprefExists:
+		p := n.params.(grouprefExParam)
+
+		no := railroadElem(&rrSeq{})
+		if p.itemNo != nil {
+			no = e.railroadSeq(p.itemNo)
+		}
+
+		c := &rrChoice{alts: []railroadElem{e.railroadSeq(p.itemYes), no}}
+		return &rrFrame{label: "if " + e.group(p.condgroup) + " matched, else", item: c}
+	case opMinRepeat, opMaxRepeat, opPossessiveRepeat:
+		p := n.params.(repeatParams)
+
+		label := ""
+		if p.max > 1 {
+			label = repeatRange(p.min, p.max)
+
+			switch n.opcode {
+			case opMinRepeat:
+				label += " lazy"
+			case opPossessiveRepeat:
+				label += " possessive"
+			}
+		}
+
+		return &rrRepeat{item: e.railroadSeq(p.item), min: p.min, max: p.max, label: label}
+	}
+
+	return &rrBox{text: item.label}
+}
+
+// repeatRange returns the minimum and maximum number of repetitions in a short form, like "2..5" or "1..∞".
+func repeatRange(min, max int) string {
+	if min == max {
+		return fmt.Sprintf("%d", min)
+	}
+	if max == maxRepeat {
+		return fmt.Sprintf("%d..∞", min)
+	}
+
+	return fmt.Sprintf("%d..%d", min, max)
+}
+
+// railroadLine draws a horizontal line of length `w`.
+func railroadLine(b *strings.Builder, x, y, w int) {
+	if w > 0 {
+		fmt.Fprintf(b, `<path d="M%d %dh%d"/>`+"\n", x, y, w)
+	}
+}
+
+// railroadText draws a text with the class, which may be empty.
+func railroadText(b *strings.Builder, x, y int, class, text string) {
+	if class != "" {
+		class = ` class="` + class + `"`
+	}
+
+	fmt.Fprintf(b, `<text x="%d" y="%d"%s>%s</text>`+"\n", x, y, class, html.EscapeString(text))
+}
+
+// rrBox is a box with a text, like a literal or a class.
+type rrBox struct {
+	text    string
+	rounded bool
+}
+
+func (r *rrBox) size() (int, int, int) {
+	return utf8.RuneCountInString(r.text)*rrCharWidth + 2*rrBoxPad, rrBoxHeight / 2, rrBoxHeight / 2
+}
+
+func (r *rrBox) draw(b *strings.Builder, x, y int) {
+	w, _, _ := r.size()
+
+	radius := 0
+	if r.rounded {
+		radius = rrBoxHeight / 2
+	}
+
+	fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" rx="%d"/>`+"\n", x, y-rrBoxHeight/2, w, rrBoxHeight, radius)
+	railroadText(b, x+w/2, y+4, "", r.text)
+}
+
+// rrSeq is a sequence of elements connected by lines.
+type rrSeq struct {
+	items []railroadElem
+}
+
+func (r *rrSeq) size() (int, int, int) {
+	if len(r.items) == 0 {
+		return rrGap, 0, 0
+	}
+
+	w, up, down := rrGap*(len(r.items)-1), 0, 0
+	for _, item := range r.items {
+		iw, iu, id := item.size()
+
+		w += iw
+		up = maxInt(up, iu)
+		down = maxInt(down, id)
+	}
+
+	return w, up, down
+}
+
+func (r *rrSeq) draw(b *strings.Builder, x, y int) {
+	if len(r.items) == 0 {
+		railroadLine(b, x, y, rrGap)
+		return
+	}
+
+	for i, item := range r.items {
+		if i > 0 {
+			railroadLine(b, x, y, rrGap)
+			x += rrGap
+		}
+
+		item.draw(b, x, y)
+
+		w, _, _ := item.size()
+		x += w
+	}
+}
+
+// rrChoice are alternatives drawn as parallel tracks. The first alternative is on the main line.
+type rrChoice struct {
+	alts []railroadElem
+}
+
+func (r *rrChoice) size() (int, int, int) {
+	w, up, down := 0, 0, 0
+
+	for i, alt := range r.alts {
+		aw, au, ad := alt.size()
+
+		w = maxInt(w, aw)
+		if i == 0 {
+			up, down = au, ad
+		} else {
+			down += rrGap + au + ad
+		}
+	}
+
+	return w + 2*rrRail, up, down
+}
+
+func (r *rrChoice) draw(b *strings.Builder, x, y int) {
+	w, _, _ := r.size()
+	inner := w - 2*rrRail
+	left, right := x+rrRail/2, x+w-rrRail/2
+
+	railroadLine(b, x, y, rrRail/2)
+	railroadLine(b, right, y, rrRail/2)
+
+	ay := y
+	for i, alt := range r.alts {
+		aw, au, ad := alt.size()
+		if i > 0 {
+			ay += rrGap + au
+		}
+
+		fmt.Fprintf(b, `<path d="M%d %dV%dH%d"/>`+"\n", left, y, ay, x+rrRail)
+		alt.draw(b, x+rrRail, ay)
+		railroadLine(b, x+rrRail+aw, ay, inner-aw)
+		fmt.Fprintf(b, `<path d="M%d %dH%dV%d"/>`+"\n", x+rrRail+inner, ay, right, y)
+
+		ay += ad
+	}
+}
+
+// rrRepeat is a repeated element. The loop below the element is drawn if the element may be repeated
+// more than once; the track above the element is drawn if the element is optional.
+type rrRepeat struct {
+	item     railroadElem
+	min, max int
+	label    string
+}
+
+func (r *rrRepeat) size() (int, int, int) {
+	w, up, down := r.item.size()
+
+	if r.min == 0 {
+		up += rrGap
+	}
+	if r.max > 1 {
+		down += rrGap
+		if r.label != "" {
+			down += rrLabel
+		}
+	}
+
+	w = maxInt(w+2*rrRail, utf8.RuneCountInString(r.label)*rrCharWidth+rrRail)
+	return w, up, down
+}
+
+func (r *rrRepeat) draw(b *strings.Builder, x, y int) {
+	w, _, _ := r.size()
+	iw, iu, id := r.item.size()
+
+	ix := x + (w-iw)/2
+	left, right := x+rrRail/2, x+w-rrRail/2
+
+	railroadLine(b, x, y, ix-x)
+	r.item.draw(b, ix, y)
+	railroadLine(b, ix+iw, y, x+w-ix-iw)
+
+	if r.min == 0 {
+		fmt.Fprintf(b, `<path d="M%d %dV%dH%dV%d"/>`+"\n", left, y, y-iu-rrGap, right, y)
+	}
+
+	if r.max > 1 {
+		bottom := y + id + rrGap
+		fmt.Fprintf(b, `<path d="M%d %dV%dH%dV%d"/>`+"\n", right, y, bottom, left, y)
+
+		if r.label != "" {
+			railroadText(b, x+w/2, bottom+rrLabel-2, "", r.label)
+		}
+	}
+}
+
+// rrFrame is a labeled frame around an element, like a group or a lookaround.
+type rrFrame struct {
+	label  string
+	item   railroadElem
+	dashed bool
+}
+
+func (r *rrFrame) size() (int, int, int) {
+	w, up, down := r.item.size()
+
+	w = maxInt(w+2*rrGap, utf8.RuneCountInString(r.label)*(rrCharWidth-2)+rrGap)
+	return w, up + rrGap + rrLabel, down + rrGap
+}
+
+func (r *rrFrame) draw(b *strings.Builder, x, y int) {
+	w, up, down := r.size()
+	iw, iu, _ := r.item.size()
+
+	class := "group"
+	if r.dashed {
+		class = "lookaround"
+	}
+
+	top := y - iu - rrGap
+	fmt.Fprintf(b, `<rect class="%s" x="%d" y="%d" width="%d" height="%d" rx="4"/>`+"\n", class, x, top, w, y+down-top)
+	railroadText(b, x+4, y-up+rrLabel-4, "label", r.label)
+
+	ix := x + (w-iw)/2
+	railroadLine(b, x, y, ix-x)
+	r.item.draw(b, ix, y)
+	railroadLine(b, ix+iw, y, x+w-ix-iw)
+}
+
+// maxInt returns the maximum of two integers.
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
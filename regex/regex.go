@@ -1,11 +1,12 @@
 package regex
 
 import (
-	"io"
+	"fmt"
 	"reflect"
 	"regexp"
 	"regexp/syntax"
 	"strings"
+	"sync"
 	"unicode"
 	"unicode/utf8"
 	"unsafe"
@@ -16,8 +17,9 @@ import (
 )
 
 // Engine is a wrapper type for the regex engine.
-// Currently, the regex engines `regexp.Regexp` (see https://pkg.go.dev/regexp) and the fallback
-// engine `regexp2.Regexp` (see https://pkg.go.dev/github.com/dlclark/regexp2) are supported.
+// By default, the regex engines `regexp.Regexp` (see https://pkg.go.dev/regexp), the native backtracking
+// engine and the fallback engine `regexp2.Regexp` (see https://pkg.go.dev/github.com/dlclark/regexp2) are supported.
+// Additional regex engines can be registered with `RegisterEngine`.
 // Since these engines work differently and do not share a common interface, wrapper functions are available.
 type Engine interface {
 
@@ -40,7 +42,7 @@ type Engine interface {
 	SubexpIndex(name string) int
 
 	// SupportsLongest returns, if the regex engine supports the longest match search.
-	// Currently, the longest match search is only supported by `regexp.Regexp`.
+	// Currently, the longest match search is only supported by `regexp.Regexp` and the backtracking engine.
 	SupportsLongest() bool
 
 	// BuildInput creates a input object that is used for searching the regex pattern.
@@ -52,6 +54,10 @@ type Engine interface {
 	// operations. A maximum of `endpos` bytes are extracted from `s`. `endpos` must be
 	// within the range of `[0, len(s)]`.
 	BuildInput(s string, endpos int) Input
+
+	// Program returns the serializable form of the compiled regex engine.
+	// The engine can be restored from the program by using `Restore`.
+	Program() *Program
 }
 
 // Input is the type to perform a regex search.
@@ -71,64 +77,241 @@ type Input interface {
 	Find(pos int, longest bool, dstCap []int) ([]int, error)
 }
 
+// AdvanceInput is an input, that can search for successive matches like Python.
+// If an input implements this interface, `FindAll` uses it instead of searching empty matches a second time.
+type AdvanceInput interface {
+	Input
+
+	// FindAdvance searches the input for the next match starting at position `pos` like `Find`,
+	// but a match starting at position `pos` must not be empty. Matches at later positions may be empty.
+	FindAdvance(pos int, dstCap []int) ([]int, error)
+}
+
+// FindAll calls `deliver` for all matches of the input `in`, that was built by the regex engine `r`
+// for the string `s`. The search starts at position `pos` and finds at most `n` matches, if `n` is positive.
+// Like Python, an empty match directly after a previous match is also found. The match slice passed to
+// `deliver` may be reused for the next match. Errors of `deliver` stop the search and are returned.
+func FindAll(r Engine, in Input, s string, pos, n int, deliver func(a []int) error) error {
+	if ai, ok := in.(AdvanceInput); ok {
+		return findAllAdvance(ai, s, pos, n, deliver)
+	}
+
+	end := len(s)
+	lastMatch := [2]int{-1, 0}
+
+	// After empty matches, str inputs advance by one character and bytes inputs by one byte.
+	// Engines, that do not report the type of their pattern, are assumed to match strings.
+	isStr := true
+	if t, ok := r.(typedEngine); ok {
+		isStr = t.isString()
+	}
+
+	// The Go regex engine only finds one match at a given position, but there are rare cases,
+	// where multiple matches exists at the same position.
+	// To avoid this behavior, a position, where a empty match was found, is searched again in an second pass.
+	// But at the second time, the longest match is searched.
+	firstPass := true
+
+	var dstCap [4]int
+	for i := 0; (n <= 0 || i < n) && pos <= end; {
+		a, err := in.Find(pos, !firstPass, dstCap[:0])
+		if err != nil {
+			return err
+		}
+
+		if len(a) == 0 {
+			break
+		}
+
+		// If the last match was different from the current:
+		if a[0] != lastMatch[0] || a[1] != lastMatch[1] {
+			err = deliver(a)
+			if err != nil {
+				return err
+			}
+
+			copy(lastMatch[:], a[:2])
+			i++
+		}
+
+		if firstPass {
+			// If an empty match was found, try to search this position again,
+			// but now look for the longest match, but only if supported.
+			if r.SupportsLongest() && a[0] == a[1] {
+				firstPass = false
+				continue
+			}
+		} else {
+			firstPass = true
+		}
+
+		// Advance past this match; always advance at least one character.
+		width := 1
+		if isStr {
+			_, width = utf8.DecodeRuneInString(s[pos:])
+		}
+
+		if pos+width > a[1] {
+			pos += width
+		} else if pos+1 > a[1] {
+			// This clause is only needed at the end of the input
+			// string. In that case, DecodeRuneInString returns width=0.
+			pos++
+		} else {
+			pos = a[1]
+		}
+	}
+
+	return nil
+}
+
+// typedEngine is implemented by the built-in regex engines, which know, whether their pattern is of type `str`.
+type typedEngine interface {
+	isString() bool
+}
+
+// findAllAdvance is the implementation of `FindAll` for inputs, that support must-advance searches.
+// Like in Python, the search continues at the end of the previous match. If the previous match was empty,
+// the next match at the same position must not be empty.
+func findAllAdvance(in AdvanceInput, s string, pos, n int, deliver func(a []int) error) error {
+	mustAdvance := false
+
+	var dstCap [4]int
+	for i := 0; (n <= 0 || i < n) && pos <= len(s); i++ {
+		var a []int
+		var err error
+
+		if mustAdvance {
+			a, err = in.FindAdvance(pos, dstCap[:0])
+		} else {
+			a, err = in.Find(pos, false, dstCap[:0])
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if len(a) == 0 {
+			break
+		}
+
+		err = deliver(a)
+		if err != nil {
+			return err
+		}
+
+		pos = a[1]
+		mustAdvance = a[0] == a[1]
+	}
+
+	return nil
+}
+
 // Compile compiles the Python-compatible regex pattern and return a regex engine.
-// If the fallback engine (`regexp2.Regexp`) is enabled and either unsupported subpatterns exist or
-// the FALLBACK flag is enabled, then the fallback engine is used. Otherwise, the preprocessed regex
-// pattern is compiled using the default regex engine (regexp.Regexp). If the DEBUG flag is enabled,
+// If the fallback engines (the backtracking engine and `regexp2.Regexp`) are enabled, the regex engine is selected by the capabilities
+// required by the pattern (see `RegisterEngine`); if the FALLBACK flag is enabled, the fallback engine is used.
+// Otherwise, the preprocessed regex pattern is compiled using the default regex engine (regexp.Regexp). If the DEBUG flag is enabled,
 // the second return value is be a debug description of the parsed regex pattern.
-func Compile(pattern string, isStr bool, flags uint32, fallbackEnabled bool) (Engine, string, error) {
+// The locale is used for bytes patterns with the LOCALE flag. If the locale is nil, the LOCALE flag has no effect.
+func Compile(pattern string, isStr bool, flags uint32, fallbackEnabled bool, loc *Locale) (Engine, string, error) {
 	// Create a preprocessor of the regex string to replace unicode patterns,
 	// that are supported by Python but not supported by Go.
-	p, err := newPreprocessor(pattern, isStr, flags)
+	p, err := newPreprocessor(pattern, isStr, flags, loc)
 	if err != nil {
 		return nil, "", err
 	}
 
 	flags = p.flags()
-	useFallback := fallbackEnabled && (flags&FlagFallback != 0 || !p.isSupported())
 
-	var e Engine
-	if !useFallback {
-		s := p.stdPattern()
+	// Select the regex engine by the capabilities required by the pattern.
+	// If the fallback engine is disabled, only the default regex engine is used.
+	info := lookupEngine(EngineStd)
+	if fallbackEnabled {
+		info = selectEngine(p.capabilities(), flags)
+	}
 
-		r, err := regexp.Compile(s)
-		if err != nil {
-			return nil, "", err
-		}
+	return compileParsed(p, info)
+}
 
-		e = &stdRegex{
-			re:     r,
-			flags:  flags,
-			isStr:  isStr,
-			numCap: numCap(r),
-		}
-	} else {
-		s := p.fallbackPattern()
+// CompileEngine compiles the Python-compatible regex pattern like `Compile`, but always with the registered regex engine `name`,
+// unless the FALLBACK flag is enabled. This allows to compare the results of different engines for the same pattern.
+// An error is returned, if the engine is not registered or does not support all capabilities required by the pattern.
+func CompileEngine(name string, pattern string, isStr bool, flags uint32, loc *Locale) (Engine, string, error) {
+	p, err := newPreprocessor(pattern, isStr, flags, loc)
+	if err != nil {
+		return nil, "", err
+	}
 
-		r2, err := regexp2.Compile(s, regexp2.RE2)
-		if err != nil {
-			return nil, "", err
-		}
+	info := lookupEngine(name)
+	if p.flags()&FlagFallback != 0 {
+		info = lookupEngine(EngineFallback)
+	} else if info == nil {
+		return nil, "", fmt.Errorf("unknown regex engine %q", name)
+	} else if missing := p.capabilities() &^ info.Capabilities; missing != 0 {
+		return nil, "", fmt.Errorf("regex engine %q does not support %s", name, missing)
+	}
 
-		e = &fallbEngine{
-			re:         r2,
-			flags:      flags,
-			isStr:      isStr,
-			numSubexp:  numCapFallb(r2) - 1,
-			groupNames: p.groupNames(),
-		}
+	return compileParsed(p, info)
+}
+
+// compileParsed compiles the preprocessed regex pattern with the regex engine `info`.
+// If the DEBUG flag is enabled, the second return value is a debug description of the parsed regex pattern.
+func compileParsed(p *preprocessor, info *EngineInfo) (Engine, string, error) {
+	e, err := info.Compile(&Parsed{p: p})
+	if err != nil {
+		return nil, "", err
 	}
 
 	// Create a debug information if needed.
 
 	dump := ""
-	if flags&FlagDebug != 0 {
+	if p.flags()&FlagDebug != 0 {
 		dump = p.p.dump()
 	}
 
 	return e, dump, nil
 }
 
+// newStdRegex compiles the preprocessed regex pattern `s` with the default regex engine `regexp.Regexp`.
+// The prefilter may be nil.
+func newStdRegex(s string, flags uint32, isStr bool, filter *prefilter) (*stdRegex, error) {
+	r, err := regexp.Compile(s)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &stdRegex{
+		re:     r,
+		flags:  flags,
+		isStr:  isStr,
+		numCap: numCap(r),
+		filter: filter,
+	}
+
+	return e, nil
+}
+
+// newFallbEngine compiles the preprocessed regex pattern `s` with the fallback engine `regexp2.Regexp`.
+// Since the preprocessed pattern does not contain any group names, the mapping of group names must be passed.
+// The prefilter may be nil.
+func newFallbEngine(s string, flags uint32, isStr bool, groupNames map[string]int, filter *prefilter) (*fallbEngine, error) {
+	r2, err := regexp2.Compile(s, regexp2.RE2)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &fallbEngine{
+		re:         r2,
+		flags:      flags,
+		isStr:      isStr,
+		numSubexp:  numCapFallb(r2) - 1,
+		groupNames: groupNames,
+		filter:     filter,
+	}
+
+	return e, nil
+}
+
 // numCap returns the unexported field `r.prog.NumCap`.
 func numCap(r *regexp.Regexp) int {
 	v := reflect.ValueOf(r).Elem()
@@ -150,11 +333,16 @@ type stdRegex struct {
 	flags  uint32
 	isStr  bool
 	numCap int
+	filter *prefilter // may be nil
+
+	longestOnce sync.Once
+	longest     *regexp.Regexp // copy of `re` for the longest match search; created on the first use
 }
 
 // stdInput is the type, that represents the processed input of `stdRegex`.
 type stdInput struct {
 	re   *stdRegex
+	src  string // original input, limited to `endpos`
 	str  string
 	bits *util.BitArray
 }
@@ -166,11 +354,13 @@ type fallbEngine struct {
 	isStr      bool
 	numSubexp  int
 	groupNames map[string]int // fallback preprocessor removes group names, so the original mapping must be saved
+	filter     *prefilter     // may be nil
 }
 
 // fallbInput is the type, that represents the processed input of `fallbEngine`.
 type fallbInput struct {
 	re    *fallbEngine
+	src   string // original input, limited to `endpos`
 	chars []rune
 	bits  *util.BitArray
 }
@@ -208,12 +398,39 @@ func (r *stdRegex) SupportsLongest() bool {
 	return true
 }
 
+// isString reports, whether the pattern is of type `str` (see `typedEngine`).
+func (r *stdRegex) isString() bool {
+	return r.isStr
+}
+
 // BuildInput is the implementation of the `BuildInput` function for the `Engine` interface.
-func (r *stdRegex) BuildInput(s string, endpos int) Input {
-	s, bits := r.replaceInvalidChars(s, endpos)
+func (r *stdRegex) BuildInput(src string, endpos int) Input {
+	return r.buildInput(src, endpos, nil)
+}
+
+// buildInput creates the input object and reuses the prepared input of the cache, if available.
+// The cache may be nil.
+func (r *stdRegex) buildInput(src string, endpos int, c *InputCache) Input {
+	kind := inputStdBytes
+	if r.isStr {
+		kind = inputStdStr
+	}
+
+	var (
+		s    string
+		bits *util.BitArray
+	)
+
+	if e := c.lookup(src[:endpos], kind); e != nil {
+		s, bits = e.str, e.bits
+	} else {
+		s, bits = r.replaceInvalidChars(src, endpos)
+		c.add(inputCacheEntry{s: src[:endpos], kind: kind, str: s, bits: bits})
+	}
 
 	i := &stdInput{
 		re:   r,
+		src:  src[:endpos],
 		str:  s,
 		bits: bits,
 	}
@@ -311,15 +528,17 @@ func (r *stdRegex) replaceInvalidChars(s string, endpos int) (string, *util.BitA
 	return b.String(), &bits
 }
 
-//go:linkname doExecute regexp.(*Regexp).doExecute
-func doExecute(re *regexp.Regexp, r io.RuneReader, b []byte, s string, pos int, ncap int, dstCap []int) []int
-
 // Find is the implementation of the `Find` function for the `Input` interface.
 func (i *stdInput) Find(pos int, longest bool, dstCap []int) ([]int, error) {
 	re := i.re.re
 	if longest {
-		re = re.Copy()
-		re.Longest()
+		re = i.re.longestRegex()
+	}
+
+	// Skip all positions, where no match can start.
+	pos = i.re.filter.skip(i.src, pos)
+	if pos < 0 {
+		return nil, nil
 	}
 
 	if i.bits != nil {
@@ -330,11 +549,39 @@ func (i *stdInput) Find(pos int, longest bool, dstCap []int) ([]int, error) {
 	}
 
 	a := doExecute(re, nil, nil, i.str, pos, i.re.numCap, dstCap)
+	a = i.re.pad(a)
 
 	applyBitsRank(a, i.bits)
 	return a, nil
 }
 
+// pad extends the match with unmatched positions, so it contains the positions of all capture groups.
+// The Go regex engine removes capture groups, that can never match (like `(a){0}`), from the compiled program,
+// so the match may contain fewer positions than expected. See also `regexp.(*Regexp).pad`.
+func (r *stdRegex) pad(a []int) []int {
+	if a == nil {
+		return nil
+	}
+
+	n := 2 * (r.re.NumSubexp() + 1)
+	for len(a) < n {
+		a = append(a, -1)
+	}
+
+	return a
+}
+
+// longestRegex returns the copy of the regex engine, that prefers the longest match.
+// The copy is only created once, so searching for the longest match does not allocate a new engine on every call.
+func (r *stdRegex) longestRegex() *regexp.Regexp {
+	r.longestOnce.Do(func() {
+		r.longest = r.re.Copy()
+		r.longest.Longest()
+	})
+
+	return r.longest
+}
+
 // applyBitsRank modifies the positions in `a` by applying `rank(a[i] - 1)` to each position.
 // If `a[i]` is negative, it remains unchanged.
 // If `a` or `bits` is `nil`, this function is a noop.
@@ -384,12 +631,39 @@ func (r *fallbEngine) SupportsLongest() bool {
 	return false
 }
 
+// isString reports, whether the pattern is of type `str` (see `typedEngine`).
+func (r *fallbEngine) isString() bool {
+	return r.isStr
+}
+
 // BuildInput is the implementation of the `BuildInput` function for the `Engine` interface.
 func (r *fallbEngine) BuildInput(s string, endpos int) Input {
-	chars, bits := r.getRuneOffsets(s, endpos)
+	return r.buildInput(s, endpos, nil)
+}
+
+// buildInput creates the input object and reuses the prepared input of the cache, if available.
+// The cache may be nil.
+func (r *fallbEngine) buildInput(s string, endpos int, c *InputCache) Input {
+	kind := inputFallbBytes
+	if r.isStr {
+		kind = inputFallbStr
+	}
+
+	var (
+		chars []rune
+		bits  *util.BitArray
+	)
+
+	if e := c.lookup(s[:endpos], kind); e != nil {
+		chars, bits = e.chars, e.bits
+	} else {
+		chars, bits = r.getRuneOffsets(s, endpos)
+		c.add(inputCacheEntry{s: s[:endpos], kind: kind, chars: chars, bits: bits})
+	}
 
 	return &fallbInput{
 		re:    r,
+		src:   s[:endpos],
 		chars: chars,
 		bits:  bits,
 	}
@@ -459,6 +733,12 @@ func (r *fallbEngine) getRuneOffsets(s string, endpos int) ([]rune, *util.BitArr
 
 // Find is the implementation of the `Find` function for the `Input` interface.
 func (i *fallbInput) Find(pos int, _ bool, dstCap []int) ([]int, error) {
+	// Skip all positions, where no match can start.
+	pos = i.re.filter.skip(i.src, pos)
+	if pos < 0 {
+		return nil, nil
+	}
+
 	if i.bits != nil {
 		pos = i.bits.Rank(pos - 1)
 	}
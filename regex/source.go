@@ -127,8 +127,9 @@ func (s *source) getUntil(c rune, name string) (string, error) {
 // nextInt returns the decimal integer at the current reading position.
 // If there is no integer present, this function returns false as the second value.
 // Afterwards, the cursor is moved to the first non-numeric character.
-// If the integer exceeds the maximum value of type `int`, an error is returned.
-func (s *source) nextInt() (int, bool, error) {
+// If the integer exceeds the maximum value of type `int`, the maximum value is returned,
+// so the caller can decide whether the number is too large (like Python, which parses arbitrary large integers).
+func (s *source) nextInt() (int, bool) {
 	i := 0
 	found := false
 
@@ -140,17 +141,17 @@ func (s *source) nextInt() (int, bool, error) {
 		d := toDigitByte(s.cur[0])
 
 		if i > maxValueDiv10 || (i == maxValueDiv10 && d > maxValueMod10) {
-			return 0, false, errors.New("overflow error")
+			i = math.MaxInt
+		} else {
+			i *= 10
+			i += d
 		}
 
-		i *= 10
-		i += d
-
 		found = true
 		s.cur = s.cur[1:]
 	}
 
-	return i, found, nil
+	return i, found
 }
 
 // nextHex returns a string of hexadecimal characters at the current reading position with a maximum length of n.
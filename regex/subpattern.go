@@ -65,62 +65,77 @@ func (p *subPattern) replace(i int, sp *subPattern) {
 	p.data = slices.Replace(p.data, i, i+1, sp.data...)
 }
 
-// isUnsupported returns, whether the subpattern is not supported by the regexp engine `regex.Regexp`.
-func (p *subPattern) isUnsupported() bool {
+// capabilities returns the capabilities, that a regex engine requires to match the subpattern.
+func (p *subPattern) capabilities() Capabilities {
+	var c Capabilities
 	for _, item := range p.data {
-		if isUnsupported(item) {
-			return true
-		}
+		c |= nodeCapabilities(item)
 	}
 
-	return false
+	return c
 }
 
-// isUnsupported returns, whether the regex node is not supported by the regexp engine `regex.Regexp`.
-// Currently, the following regex node types are not supported:
+// nodeCapabilities returns the capabilities, that a regex engine requires to match the regex node.
+// Currently, the following regex node types require additional capabilities:
 // ASSERT, ASSERT_NOT, GROUPREF, GROUPREF_EXISTS, ATOMIC_GROUP, POSSESSIVE_REPEAT, FAILURE and AT with the AT_END_STRING position.
 // If the regex node is a repetition of type `{m,n}` and the minimum and maximum repetion counts exceed the value `maxRepeatEngine`,
-// then the regex node is also not supported.
-func isUnsupported(n *regexNode) bool {
+// then the regex node requires the capability `CapLargeRepeat`.
+func nodeCapabilities(n *regexNode) Capabilities {
 	switch n.opcode {
-	case opAssert, opAssertNot,
-		opGroupref, opGrouprefExists,
-		opAtomicGroup,
-		opPossessiveRepeat,
-		opFailure:
-		return true
+	case opAssert, opAssertNot:
+		return CapLookaround | n.params.(assertParams).p.capabilities()
+	case opFailure:
+		return CapLookaround
+	case opGroupref:
+		return CapBackrefs
+	case opGrouprefExists:
+		p := n.params.(grouprefExParam)
+
+		c := CapBackrefs | p.itemYes.capabilities()
+		if p.itemNo != nil {
+			c |= p.itemNo.capabilities()
+		}
+
+		return c
+	case opAtomicGroup:
+		return CapAtomic | n.params.(*subPattern).capabilities()
 	case opAt:
 		c := n.params.(atcode)
 
 		if c == atEndString {
-			return true
+			return CapEndString
 		}
 	case opBranch:
-		items := n.params.([]*subPattern)
+		var c Capabilities
 
-		for _, item := range items {
-			if item.isUnsupported() {
-				return true
-			}
+		for _, item := range n.params.([]*subPattern) {
+			c |= item.capabilities()
 		}
-	case opMinRepeat, opMaxRepeat:
+
+		return c
+	case opMinRepeat, opMaxRepeat, opPossessiveRepeat:
 		p := n.params.(repeatParams)
 
+		c := p.item.capabilities()
+		if n.opcode == opPossessiveRepeat {
+			c |= CapPossessive
+		}
+
 		if p.min > 1 || p.max < maxRepeat {
 			// the repetition is of type `{m,n}`
 			if p.min > maxRepeatEngine || p.max > maxRepeatEngine {
-				return true
+				c |= CapLargeRepeat
 			}
 		}
 
-		return p.item.isUnsupported()
+		return c
 	case opSubpattern:
 		p := n.params.(subPatternParam)
 
-		return p.p.isUnsupported()
+		return p.p.capabilities()
 	}
 
-	return false
+	return 0
 }
 
 // dump returns debug information about the compiled expression.
@@ -281,10 +296,13 @@ func (p *subPattern) write(w *strings.Builder, isStr bool, replace func(w *subPa
 
 // subPatternWriter is a type to write the regex pattern.
 // It uses a `strings.Builder` and provides functions to write subpatterns, regex nodes, integers, and literals.
+// The `literal` function writes literals in the escape syntax of other regex dialects; if it is nil,
+// literals are written as hexadecimal escapes (see `writeHexLiteral`).
 type subPatternWriter struct {
 	w       *strings.Builder
 	isStr   bool
 	replace func(w *subPatternWriter, n *regexNode, ctx *subPatternContext) bool
+	literal func(w *subPatternWriter, c rune)
 }
 
 // subPatternContext describes the content of the current regex node.
@@ -437,8 +455,8 @@ func (w *subPatternWriter) writeNode(n *regexNode, ctx *subPatternContext) {
 		p := n.params.(repeatParams)
 
 		needsGroup := false
-		if p.item.len() > 1 {
-			needsGroup = true
+		if p.item.len() != 1 {
+			needsGroup = true // also write empty items as a group, so the repeat has an operand
 		} else {
 			switch p.item.get(0).opcode {
 			case opBranch, opMinRepeat, opMaxRepeat, opPossessiveRepeat:
@@ -504,25 +522,22 @@ func (w *subPatternWriter) writeNode(n *regexNode, ctx *subPatternContext) {
 				w.writeByte('>')
 			}
 		} else {
+			// Flags can only appear, when no group name exists.
+			// The group is always written as a non-capturing group with a colon, even if it is empty or
+			// no supported flags remain; otherwise it would capture or change the flags of the enclosing group.
+
 			addFlags := p.addFlags & supportedFlags
 			delFlags := p.delFlags & supportedFlags
 
-			if addFlags != 0 || delFlags != 0 {
-				// Flags can only appear, when no group name exists
-
-				w.writeByte('?')
-				if addFlags != 0 {
-					w.writeFlags(addFlags)
-				}
-				if delFlags != 0 {
-					w.writeByte('-')
-					w.writeFlags(delFlags)
-				}
-
-				if p.p.len() > 0 {
-					w.writeByte(':')
-				}
+			w.writeByte('?')
+			if addFlags != 0 {
+				w.writeFlags(addFlags)
 			}
+			if delFlags != 0 {
+				w.writeByte('-')
+				w.writeFlags(delFlags)
+			}
+			w.writeByte(':')
 		}
 
 		if p.p.len() > 0 {
@@ -571,10 +586,20 @@ func (w *subPatternWriter) writeInt(i int) {
 var hexDigits = "0123456789abcdef"
 
 // writeLiteral writes the literal to the subpattern writer.
+// If the writer has no literal function, the literal is written as a hexadecimal escape.
+func (w *subPatternWriter) writeLiteral(c rune) {
+	if w.literal != nil {
+		w.literal(w, c)
+	} else {
+		w.writeHexLiteral(c)
+	}
+}
+
+// writeHexLiteral writes the literal to the subpattern writer.
 // The value is always appended in hexadecimal format, as it is clear and unambiguous
 // without introducing any scoping errors in the parser of the regex engine.
 // It will have either the format "\x.." or "\x{...}".
-func (w *subPatternWriter) writeLiteral(c rune) {
+func (w *subPatternWriter) writeHexLiteral(c rune) {
 	w.writeString(`\x`)
 
 	if c <= unicode.MaxASCII || (!w.isStr && c <= 0xff) {
@@ -3,6 +3,7 @@ package regex
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/magnetde/starlark-re/util"
 )
@@ -84,7 +85,7 @@ func ParseTemplate(r Engine, template string, isString bool) ([]TemplateRule, er
 
 			var index int
 
-			if uindex, e := strconv.ParseUint(name, 10, 32); e != nil {
+			if !isDigitString(name) {
 				err = s.checkGroupName(name, 1)
 				if err != nil {
 					return nil, err
@@ -95,8 +96,9 @@ func ParseTemplate(r Engine, template string, isString bool) ([]TemplateRule, er
 					return nil, s.erroro(fmt.Sprintf("unknown group name %s", util.Repr(name, true)), len(name)+1)
 				}
 			} else {
-				if uindex >= maxGroups {
-					return nil, s.erroro(fmt.Sprintf("invalid group reference %d", index), len(name)+1)
+				uindex, e := strconv.ParseUint(name, 10, 32)
+				if e != nil || uindex >= maxGroups {
+					return nil, s.erroro("invalid group reference "+strings.TrimLeft(name, "0"), len(name)+1)
 				}
 
 				index = int(uindex)
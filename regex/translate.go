@@ -0,0 +1,498 @@
+package regex
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Regex dialects supported by `Translate`.
+const (
+	DialectRE2        = "re2"        // RE2 and the Go package `regexp`
+	DialectPCRE       = "pcre"       // PCRE2 and Perl
+	DialectECMAScript = "ecmascript" // JavaScript; the pattern is written as a regex literal with its flags
+	DialectDotNet     = "dotnet"     // .NET `System.Text.RegularExpressions.Regex`
+)
+
+// dialectAliases contains alternative names of the regex dialects.
+var dialectAliases = map[string]string{
+	"go":         DialectRE2,
+	"perl":       DialectPCRE,
+	"js":         DialectECMAScript,
+	"javascript": DialectECMAScript,
+	".net":       DialectDotNet,
+}
+
+// dialectNames contains the names of the regex dialects used in error messages.
+var dialectNames = map[string]string{
+	DialectRE2:        "RE2",
+	DialectPCRE:       "PCRE",
+	DialectECMAScript: "ECMAScript",
+	DialectDotNet:     ".NET",
+}
+
+// Maximum repeat counts of the dialects with a limit.
+const (
+	maxRepeatRE2  = 1000
+	maxRepeatPCRE = 65535
+)
+
+// LookupDialect returns the regex dialect with the name, which is case-insensitive and may be an alias,
+// like "js" for ECMAScript. If the dialect is unknown, an error is returned.
+func LookupDialect(name string) (string, error) {
+	d := strings.ToLower(name)
+	if alias, ok := dialectAliases[d]; ok {
+		d = alias
+	}
+
+	if _, ok := dialectNames[d]; !ok {
+		return "", fmt.Errorf("unknown regex dialect %q", name)
+	}
+
+	return d, nil
+}
+
+// Translate parses the Python regex pattern and returns an equivalent pattern in the regex dialect.
+// The pattern is written from the parsed tree like the preprocessed patterns of the regex engines: literals are
+// escaped, categories of unicode patterns are written as unicode classes and the global flags are written as
+// inline flags. ECMAScript patterns are returned as regex literals with their flags, like `/\x61+/iu`.
+// If the dialect cannot express a construct of the pattern, like a lookbehind assertion in RE2, an error is
+// returned, that names the construct and its position. Unicode patterns for PCRE require the UTF mode.
+// Word boundaries are written unchanged, so they use the word characters of the dialect. Since RE2 and ECMAScript
+// only know ASCII word characters, word boundaries of unicode patterns without the ASCII flag are not translated.
+func Translate(pattern string, isStr bool, flags uint32, dialect string) (string, error) {
+	d, err := LookupDialect(dialect)
+	if err != nil {
+		return "", err
+	}
+
+	p, err := newPreprocessor(pattern, isStr, flags, nil)
+	if err != nil {
+		return "", err
+	}
+
+	t := translator{p: p, dialect: d}
+	t.numberGroups(p.p)
+
+	if p.flags()&FlagLocale != 0 {
+		return "", t.errorf(0, "the LOCALE flag")
+	}
+	if err := t.check(p.p, p.flags()); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+
+	if d != DialectECMAScript {
+		p.writeFlags(&b, true)
+	}
+
+	w := subPatternWriter{
+		w:       &b,
+		isStr:   isStr,
+		replace: t.replace,
+	}
+
+	switch d {
+	case DialectECMAScript:
+		w.literal = writeECMAScriptLiteral
+	case DialectDotNet:
+		w.literal = writeDotNetLiteral
+	}
+
+	w.writePattern(p.p, nil)
+
+	if d == DialectECMAScript {
+		return t.ecmaScriptLiteral(b.String()), nil
+	}
+
+	return b.String(), nil
+}
+
+// translator translates the parsed tree of a pattern into another regex dialect.
+type translator struct {
+	p       *preprocessor
+	dialect string
+	groups  map[int]int // group numbers of .NET, where named groups are numbered after all unnamed groups
+}
+
+// errorf returns an error for the construct at the position, that cannot be translated.
+func (t *translator) errorf(pos int, construct string, args ...any) error {
+	construct = fmt.Sprintf(construct, args...)
+	return fmt.Errorf("cannot translate %s at position %d to %s", construct, pos, dialectNames[t.dialect])
+}
+
+// numberGroups determines the group numbers of .NET. Unlike Python, .NET numbers named groups
+// after all unnamed groups, so numeric references to unnamed groups need to be renumbered.
+func (t *translator) numberGroups(sp *subPattern) {
+	if t.dialect != DialectDotNet {
+		return
+	}
+
+	t.groups = make(map[int]int)
+
+	n := 0
+	for gid := 1; gid < sp.state.groups(); gid++ {
+		if groupName(sp, gid) == "" {
+			n++
+			t.groups[gid] = n
+		}
+	}
+}
+
+// check reports the first construct of the subpattern, that cannot be expressed in the dialect.
+func (t *translator) check(sp *subPattern, flags uint32) error {
+	re2 := t.dialect == DialectRE2
+	ecma := t.dialect == DialectECMAScript
+
+	for _, n := range sp.data {
+		var items []*subPattern
+
+		switch n.opcode {
+		case opAt:
+			at := n.params.(atcode)
+
+			if (at == atBoundary || at == atNonBoundary) && (re2 || ecma) && t.p.isStr && flags&FlagASCII == 0 {
+				return t.errorf(n.pos, "word boundary")
+			}
+		case opAssert, opAssertNot:
+			p := n.params.(assertParams)
+
+			if re2 {
+				return t.errorf(n.pos, "%s", describeAssertion(n.opcode, p.dir))
+			}
+
+			items = append(items, p.p)
+		case opGroupref:
+			if re2 {
+				return t.errorf(n.pos, "backreference")
+			}
+		case opGrouprefExists:
+			p := n.params.(grouprefExParam)
+
+			if re2 || ecma {
+				return t.errorf(n.pos, "conditional expression")
+			}
+
+			items = append(items, p.itemYes)
+			if p.itemNo != nil {
+				items = append(items, p.itemNo)
+			}
+		case opAtomicGroup:
+			if re2 || ecma {
+				return t.errorf(n.pos, "atomic group")
+			}
+
+			items = append(items, n.params.(*subPattern))
+		case opMinRepeat, opMaxRepeat, opPossessiveRepeat:
+			p := n.params.(repeatParams)
+
+			if n.opcode == opPossessiveRepeat && (re2 || ecma) {
+				return t.errorf(n.pos, "possessive repeat")
+			}
+
+			if p.min > 1 || p.max < maxRepeat {
+				if re2 && (p.min > maxRepeatRE2 || p.max > maxRepeatRE2 && p.max < maxRepeat) {
+					return t.errorf(n.pos, "repeat count greater than %d", maxRepeatRE2)
+				}
+				if t.dialect == DialectPCRE && (p.min > maxRepeatPCRE || p.max > maxRepeatPCRE && p.max < maxRepeat) {
+					return t.errorf(n.pos, "repeat count greater than %d", maxRepeatPCRE)
+				}
+			}
+
+			items = append(items, p.item)
+		case opSubpattern:
+			p := n.params.(subPatternParam)
+
+			name := groupName(p.p, p.group)
+			if p.group > 0 && name != "" && (re2 || t.dialect == DialectPCRE) && !isGoIdentifer(name) {
+				return t.errorf(n.pos, "group name %q", name)
+			}
+
+			if ecma && (p.addFlags|p.delFlags)&FlagIgnoreCase != 0 {
+				return t.errorf(n.pos, "inline flags")
+			}
+
+			if err := t.check(p.p, combineFlags(flags, p.addFlags, p.delFlags)); err != nil {
+				return err
+			}
+		case opBranch:
+			items = n.params.([]*subPattern)
+		case opLiteral, opNotLiteral:
+			if err := t.checkChar(n.pos, n.c, false); err != nil {
+				return err
+			}
+		case opIn:
+			if err := t.checkSet(n); err != nil {
+				return err
+			}
+		}
+
+		for _, item := range items {
+			if err := t.check(item, flags); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkChar reports, if the character cannot be expressed in the dialect.
+func (t *translator) checkChar(pos int, c rune, inSet bool) error {
+	if !t.p.isStr && c > unicode.MaxASCII && t.dialect == DialectRE2 {
+		return t.errorf(pos, "non-ASCII byte")
+	}
+
+	if inSet && c > 0xffff && t.dialect == DialectDotNet {
+		return t.errorf(pos, "character U+%04X outside of the Basic Multilingual Plane in a character class", c)
+	}
+
+	return nil
+}
+
+// checkSet reports, if the items of the character set cannot be expressed in the dialect.
+func (t *translator) checkSet(n *regexNode) error {
+	items := n.params.([]*regexNode)
+
+	for _, item := range items {
+		switch item.opcode {
+		case opLiteral:
+			if err := t.checkChar(item.pos, item.c, true); err != nil {
+				return err
+			}
+		case opRange:
+			p := item.params.(rangeParams)
+			if err := t.checkChar(item.pos, p.hi, true); err != nil {
+				return err
+			}
+		case opCategory:
+			// Negated categories are written as ranges of all characters, if the set has other items.
+			if t.dialect != DialectDotNet || len(items) == 1 {
+				break
+			}
+
+			switch item.params.(catcode) {
+			case categoryNotDigit, categoryNotSpace, categoryNotWord:
+				if t.p.isStr {
+					return t.errorf(item.pos, "negated category with other items in a character class")
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// describeAssertion returns the name of a lookahead or lookbehind assertion.
+func describeAssertion(op opcode, dir int) string {
+	text := "lookahead assertion"
+	if dir < 0 {
+		text = "lookbehind assertion"
+	}
+	if op == opAssertNot {
+		text = "negative " + text
+	}
+
+	return text
+}
+
+// replace writes the regex nodes, that are written differently in the dialect.
+func (t *translator) replace(w *subPatternWriter, n *regexNode, ctx *subPatternContext) bool {
+	flags := t.p.flags()
+	if ctx.group != nil {
+		flags = combineFlags(flags, ctx.group.addFlags, ctx.group.delFlags)
+	}
+
+	switch n.opcode {
+	case opAt:
+		multiline := flags&FlagMultiline != 0
+
+		switch n.params.(atcode) {
+		case atBeginning:
+			// ECMAScript also treats "\r", "\u2028" and "\u2029" as line terminators, so the MULTILINE flag is not used.
+			if t.dialect == DialectECMAScript && multiline {
+				w.writeString(`(?<![^\n])`)
+				return true
+			}
+		case atEnd:
+			if t.dialect == DialectECMAScript && multiline {
+				w.writeString(`(?![^\n])`)
+				return true
+			}
+		case atBeginningString:
+			if t.dialect == DialectECMAScript {
+				w.writeString(`(?<![\s\S])`)
+				return true
+			}
+		case atEndString:
+			if t.dialect == DialectECMAScript {
+				w.writeString(`(?![\s\S])`)
+			} else {
+				w.writeString(`\z`)
+			}
+
+			return true
+		}
+	case opAny:
+		if t.dialect == DialectECMAScript {
+			// The dot of ECMAScript does not match any line terminators and there are no scoped flags.
+			if flags&FlagDotAll != 0 {
+				w.writeString(`[\s\S]`)
+			} else {
+				w.writeString(`[^\n]`)
+			}
+
+			return true
+		}
+	case opFailure:
+		if t.dialect == DialectRE2 {
+			w.writeString(`[^\x00-\x{10ffff}]`)
+			return true
+		}
+	case opCategory:
+		if t.dialect == DialectECMAScript || t.dialect == DialectDotNet {
+			// The categories of both dialects do not match the ASCII categories of Python.
+			if flags&FlagUnicode == 0 {
+				r := t.p.categoryRanges(n.params.(catcode), flags)
+				if !t.p.isStr {
+					r = intersectRanges(r, []rune{0, 0xff})
+				} else if t.dialect == DialectDotNet {
+					r = intersectRanges(r, []rune{0, 0xffff}) // character classes of .NET only contain UTF-16 code units
+				}
+
+				writeRanges(w, r)
+				return true
+			}
+		}
+	case opGroupref:
+		if t.dialect == DialectDotNet {
+			gid := n.params.(int)
+
+			if name := groupName(t.p.p, gid); name != "" {
+				w.writeString(`\k<`)
+				w.writeString(name)
+				w.writeByte('>')
+			} else {
+				w.writeString(`\`)
+				w.writeInt(t.groups[gid])
+			}
+
+			return true
+		}
+	case opGrouprefExists:
+		if t.dialect == DialectDotNet {
+			p := n.params.(grouprefExParam)
+
+			w.writeString("(?(")
+			if name := groupName(t.p.p, p.condgroup); name != "" {
+				w.writeString(name)
+			} else {
+				w.writeInt(t.groups[p.condgroup])
+			}
+			w.writeByte(')')
+			w.writePattern(p.itemYes, ctx.group)
+			if p.itemNo != nil {
+				w.writeByte('|')
+				w.writePattern(p.itemNo, ctx.group)
+			}
+			w.writeByte(')')
+
+			return true
+		}
+	case opPossessiveRepeat:
+		if t.dialect == DialectDotNet {
+			// possessive repeats are atomic groups of greedy repeats
+			w.writeString("(?>")
+			w.writeNode(&regexNode{opcode: opMaxRepeat, params: n.params, pos: n.pos, end: n.end}, ctx)
+			w.writeByte(')')
+
+			return true
+		}
+	case opSubpattern:
+		if t.dialect == DialectECMAScript || t.dialect == DialectDotNet {
+			p := n.params.(subPatternParam)
+
+			w.writeByte('(')
+			if p.group < 0 {
+				if t.dialect == DialectDotNet {
+					w.writeString(flagGroup(p.addFlags&supportedFlags, p.delFlags&supportedFlags))
+				} else {
+					w.writeString("?:")
+				}
+			} else if name := groupName(p.p, p.group); name != "" {
+				w.writeString("?<")
+				w.writeString(name)
+				w.writeByte('>')
+			}
+
+			if p.p.len() > 0 {
+				w.writePattern(p.p, &p)
+			}
+			w.writeByte(')')
+
+			return true
+		}
+	}
+
+	return t.p.defaultReplacer(w, n, ctx, true)
+}
+
+// flagGroup returns the start of a non-capturing group with flags, like "?i-m:".
+func flagGroup(addFlags, delFlags uint32) string {
+	if addFlags == 0 && delFlags == 0 {
+		return "?:"
+	}
+
+	return "?" + flagString(addFlags, delFlags) + ":"
+}
+
+// ecmaScriptLiteral returns the ECMAScript regex literal of the translated pattern.
+// The flags "m" and "s" are never used, because all anchors and dots are written explicitly.
+func (t *translator) ecmaScriptLiteral(source string) string {
+	if source == "" {
+		source = "(?:)" // an empty literal would be a comment
+	}
+
+	flags := t.p.flags()
+
+	var b strings.Builder
+
+	b.WriteByte('/')
+	b.WriteString(source)
+	b.WriteByte('/')
+
+	// the IGNORECASE flag is done by the preprocessor for bytes patterns and with the ASCII flag
+	if flags&FlagIgnoreCase != 0 && flags&FlagASCII == 0 && t.p.isStr {
+		b.WriteByte('i')
+	}
+	if t.p.isStr {
+		b.WriteByte('u')
+	}
+
+	return b.String()
+}
+
+// writeECMAScriptLiteral writes the literal as an ECMAScript escape, either as "\x.." or as "\u{...}".
+// Patterns of type str are always translated with the "u" flag, which is required for the "\u{...}" escapes.
+func writeECMAScriptLiteral(w *subPatternWriter, c rune) {
+	if c <= 0xff {
+		fmt.Fprintf(w.w, `\x%02x`, c)
+	} else {
+		fmt.Fprintf(w.w, `\u{%x}`, c)
+	}
+}
+
+// writeDotNetLiteral writes the literal as a .NET escape, either as "\x.." or as "\u....".
+// Characters outside of the Basic Multilingual Plane are written as surrogate pairs.
+func writeDotNetLiteral(w *subPatternWriter, c rune) {
+	switch {
+	case c <= 0xff:
+		fmt.Fprintf(w.w, `\x%02x`, c)
+	case c <= 0xffff:
+		fmt.Fprintf(w.w, `\u%04x`, c)
+	default:
+		c -= 0x10000
+		fmt.Fprintf(w.w, `\u%04x\u%04x`, 0xd800+(c>>10), 0xdc00+(c&0x3ff))
+	}
+}
@@ -1,6 +1,7 @@
 package regex
 
 import (
+	"fmt"
 	"slices"
 	"strings"
 	"unicode"
@@ -36,6 +37,21 @@ func isDigitByte(c byte) bool {
 	return isDigit(rune(c))
 }
 
+// isDigitString checks if the string is not empty and only contains decimal digits.
+func isDigitString(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		if !isDigitByte(s[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
 // isOctDigit checks if the given character is an octal digit.
 func isOctDigit(b rune) bool {
 	return '0' <= b && b <= '7'
@@ -149,6 +165,23 @@ func getFlag(c rune) uint32 {
 	}
 }
 
+// ParseFlags converts the flag characters of inline flags, like "im", into regex flags.
+// An error is returned, if a character is not a valid regex flag (see `isFlag`).
+// Incompatible flags, like "au", are reported when the pattern is compiled.
+func ParseFlags(s string) (uint32, error) {
+	var flags uint32
+
+	for _, c := range s {
+		if !isFlag(c) {
+			return 0, fmt.Errorf("unknown flag %q", c)
+		}
+
+		flags |= getFlag(c)
+	}
+
+	return flags, nil
+}
+
 // isRepeatCode checks if the opcode represents a repetition operator.
 // Valid repeating operators are "MIN_REPEAT", "MAX_REPEAT" or "POSSESSIVE_REPEAT".
 func isRepeatCode(o opcode) bool {
@@ -3,7 +3,7 @@ package re
 import "go.starlark.net/starlark"
 
 // split splits `str` at all occurrences of pattern `p`. See also `reSplit`.
-func split(p *Pattern, str strOrBytes, maxSplit int) (*starlark.List, error) {
+func split(thread *starlark.Thread, p *Pattern, str strOrBytes, maxSplit int) (*starlark.List, error) {
 	s := str.value
 
 	var list []starlark.Value
@@ -11,7 +11,7 @@ func split(p *Pattern, str strOrBytes, maxSplit int) (*starlark.List, error) {
 	beg := 0
 	end := 0
 
-	err := findMatches(p.re, s, 0, len(s), maxSplit, func(match []int) error {
+	err := findMatches(thread, p.re, s, 0, len(s), maxSplit, func(match []int) error {
 		end = match[0]
 
 		list = append(list, p.pattern.asType(s[beg:end]))
@@ -0,0 +1,72 @@
+package re
+
+import (
+	"slices"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// CacheStats contains statistics about the pattern cache of a module.
+// The statistics are reset, when the cache is purged.
+// If the pattern cache is disabled or does not provide statistics, all statistics are zero.
+type CacheStats struct {
+	Hits      int            // number of patterns found in the cache
+	Misses    int            // number of patterns not found in the cache, that needed to be compiled
+	Evictions int            // number of patterns removed because the cache exceeded its capacity
+	Size      int            // current number of patterns in the cache
+	MaxSize   int            // maximum number of patterns in the cache; 0 if the cache is bounded by cost
+	Cost      int            // current estimated cost of all patterns in the cache, if the cache is bounded by cost
+	MaxCost   int            // maximum cost of all patterns in the cache; 0 if the cache is bounded by size
+	Engines   map[string]int // current number of patterns in the cache per regex engine
+}
+
+// Stats returns statistics about the pattern cache, like the number of cache hits, misses and evictions.
+// If the module uses a shared cache, the statistics of the whole shared cache are returned.
+// These statistics may help to determine an appropriate maximum cache size.
+func (m *Module) Stats() CacheStats {
+	if c, ok := m.cache.(statsCache); ok {
+		return c.Stats()
+	}
+
+	stats := CacheStats{
+		Engines: make(map[string]int),
+	}
+
+	return stats
+}
+
+// reCacheInfo returns the statistics of the pattern cache as a struct with the fields `hits`, `misses`,
+// `maxsize` and `currsize`, like the function `cache_info` of `functools.lru_cache` in Python.
+// Additionally, the struct contains the fields `evictions` and `engines`, which is a dict containing
+// the number of cached patterns per regex engine.
+func reCacheInfo(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+
+	stats := b.Receiver().(*Module).Stats()
+
+	// Sort the engine names to obtain a deterministic order.
+	names := make([]string, 0, len(stats.Engines))
+	for name := range stats.Engines {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	engines := starlark.NewDict(len(names))
+	for _, name := range names {
+		_ = engines.SetKey(starlark.String(name), starlark.MakeInt(stats.Engines[name]))
+	}
+
+	info := starlarkstruct.FromStringDict(starlark.String("CacheInfo"), starlark.StringDict{
+		"hits":      starlark.MakeInt(stats.Hits),
+		"misses":    starlark.MakeInt(stats.Misses),
+		"maxsize":   starlark.MakeInt(stats.MaxSize),
+		"currsize":  starlark.MakeInt(stats.Size),
+		"evictions": starlark.MakeInt(stats.Evictions),
+		"engines":   engines,
+	})
+
+	return info, nil
+}
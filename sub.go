@@ -40,10 +40,37 @@ type callableReplacer struct {
 	p      *Pattern
 }
 
+// mappingReplacer is the replacer for mappings, like dicts, of match texts to replacements.
+// The text of the group with the index `group` is looked up in the mapping.
+// If the key does not exist or the group did not match, the default replacement is used instead.
+// The lookup is case-sensitive, even if the pattern has the IGNORECASE flag.
+type mappingReplacer struct {
+	m     starlark.Mapping
+	group int
+	dflt  starlark.Value // default replacement; nil if missing keys are an error
+	p     *Pattern
+}
+
+// mappingParams represents the parameters `group` and `default` of `sub` and `subn`,
+// which are only supported for mapping replacements. The values are nil, if they are not set.
+type mappingParams struct {
+	group starlark.Value
+	dflt  starlark.Value
+}
+
+// formatReplacer is the replacer for format strings (see `regex.ParseFormat`).
+type formatReplacer struct {
+	rules    []regex.FormatRule
+	match    bool
+	isString bool
+}
+
 // Check if the types satisfy the replacer interface.
 var (
 	_ matchReplacer = (*templateReplacer)(nil)
 	_ matchReplacer = (*callableReplacer)(nil)
+	_ matchReplacer = (*formatReplacer)(nil)
+	_ matchReplacer = (*mappingReplacer)(nil)
 )
 
 // withMatch returns true, if the template does not contain any references.
@@ -97,10 +124,93 @@ func (r *callableReplacer) replace(w *strings.Builder, m *Match) error {
 	return nil
 }
 
+// withMatch always returns true.
+func (r *mappingReplacer) withMatch() bool {
+	return true
+}
+
+// replace replaces the current match by the value of the group text in the mapping.
+func (r *mappingReplacer) replace(w *strings.Builder, m *Match) error {
+	var key, v starlark.Value = starlark.None, nil
+
+	if g := &m.groups[r.group]; !g.empty() {
+		key = m.str.asType(m.groupStr(g))
+
+		res, found, err := r.m.Get(key)
+		if err != nil {
+			return err
+		}
+		if found {
+			v = res
+		}
+	}
+
+	if v == nil {
+		if r.dflt == nil {
+			return fmt.Errorf("key %s not found in mapping", key.String())
+		}
+
+		v = r.dflt
+	}
+
+	// check if the replacement is str or bytes of the expected type
+	var res strOrBytes
+	if err := res.Unpack(v); err != nil {
+		return err
+	}
+	if err := res.sameType(r.p.pattern); err != nil {
+		return err
+	}
+
+	w.WriteString(res.value)
+
+	return nil
+}
+
+// withMatch returns true, if the format string contains replacement fields.
+func (r *formatReplacer) withMatch() bool {
+	return r.match
+}
+
+// replace replaces the current match by formatting the groups of the match.
+func (r *formatReplacer) replace(w *strings.Builder, m *Match) error {
+	for i := range r.rules {
+		t := &r.rules[i]
+
+		if t.IsLiteral() {
+			w.WriteString(t.Literal)
+		} else {
+			var value string
+
+			g := &m.groups[t.Group]
+			if !g.empty() {
+				value = m.groupStr(g)
+			}
+
+			t.Write(w, value, r.isString)
+		}
+	}
+
+	return nil
+}
+
 // buildReplacer creates a new match replacer based on the input parameter type.
 // If the parameter is of type `str` or `bytes`, a template replacer is created.
+// If the parameter is a compiled template, its template replacer is reused.
 // If the parameter is callable, a function replacer is returned instead.
-func buildReplacer(thread *starlark.Thread, p *Pattern, r starlark.Value) (matchReplacer, error) {
+// If the parameter is a mapping, a mapping replacer is returned, that uses the parameters `mp`.
+// These parameters are only supported for mappings.
+func buildReplacer(thread *starlark.Thread, p *Pattern, r starlark.Value, mp mappingParams) (matchReplacer, error) {
+	if m, ok := r.(starlark.Mapping); ok {
+		if _, ok := r.(starlark.Callable); !ok {
+			return newMappingReplacer(p, m, mp)
+		}
+	}
+
+	if mp.group != nil || mp.dflt != nil {
+		return nil, errors.New("group and default are only supported for mapping replacements")
+	}
+
 	switch r := r.(type) {
 	case starlark.String:
 		if !p.pattern.isString {
@@ -114,6 +224,8 @@ func buildReplacer(thread *starlark.Thread, p *Pattern, r starlark.Value) (match
 		}
 
 		return newTemplateReplacer(p.re, string(r), false /* is not string */)
+	case *Template:
+		return r.replacerFor(p)
 	case starlark.Callable:
 		c := callableReplacer{
 			c:      r,
@@ -123,14 +235,14 @@ func buildReplacer(thread *starlark.Thread, p *Pattern, r starlark.Value) (match
 
 		return &c, nil
 	default:
-		return nil, fmt.Errorf("got %s, want %s or function", r.Type(), p.pattern.typeString())
+		return nil, fmt.Errorf("got %s, want %s, function or mapping", r.Type(), p.pattern.typeString())
 	}
 }
 
 // newTemplateReplacer creates a new template replacer for a template.
 // If the template does not contain any backslashes, it does need to be parsed.
 // Otherwise, the template must be parsed and transformed into a slice of template rules.
-func newTemplateReplacer(r regex.Engine, repl string, isString bool) (matchReplacer, error) {
+func newTemplateReplacer(r regex.Engine, repl string, isString bool) (*templateReplacer, error) {
 	var rules []regex.TemplateRule
 	withMatch := false
 
@@ -161,9 +273,70 @@ func newTemplateReplacer(r regex.Engine, repl string, isString bool) (matchRepla
 	return tr, nil
 }
 
+// newMappingReplacer creates a new mapping replacer. The group defaults to the whole match.
+// The default replacement must be of the type of the pattern.
+func newMappingReplacer(p *Pattern, m starlark.Mapping, mp mappingParams) (*mappingReplacer, error) {
+	group := 0
+	if mp.group != nil {
+		var err error
+
+		group, err = p.groupIndex(mp.group)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if mp.dflt != nil {
+		var dflt strOrBytes
+		if err := dflt.Unpack(mp.dflt); err != nil {
+			return nil, fmt.Errorf("default: %w", err)
+		}
+		if err := dflt.sameType(p.pattern); err != nil {
+			return nil, fmt.Errorf("default: %w", err)
+		}
+	}
+
+	mr := &mappingReplacer{
+		m:     m,
+		group: group,
+		dflt:  mp.dflt,
+		p:     p,
+	}
+
+	return mr, nil
+}
+
+// newFormatReplacer creates a new format replacer for the format string of the pattern `p`.
+func newFormatReplacer(p *Pattern, format strOrBytes) (*formatReplacer, error) {
+	if err := format.sameType(p.pattern); err != nil {
+		return nil, err
+	}
+
+	rules, err := regex.ParseFormat(p.re, format.value, format.isString)
+	if err != nil {
+		return nil, err
+	}
+
+	withMatch := false
+	for i := range rules {
+		if !rules[i].IsLiteral() {
+			withMatch = true
+			break
+		}
+	}
+
+	fr := &formatReplacer{
+		rules:    rules,
+		match:    withMatch,
+		isString: format.isString,
+	}
+
+	return fr, nil
+}
+
 // sub replaces all matches of the pattern `p` in `str` with the replacement `r`.
 // At most `count` matches will be replaced. If `subn` is true, then the number of replacements is also returned.
-func sub(p *Pattern, r matchReplacer, str strOrBytes, count int, subn bool) (starlark.Value, error) {
+func sub(thread *starlark.Thread, p *Pattern, r matchReplacer, str strOrBytes, count int, subn bool) (starlark.Value, error) {
 	s := str.value
 
 	var b strings.Builder
@@ -172,7 +345,7 @@ func sub(p *Pattern, r matchReplacer, str strOrBytes, count int, subn bool) (sta
 	beg := 0
 	end := 0
 
-	err := findMatches(p.re, s, 0, len(s), count, func(match []int) error {
+	err := findMatches(thread, p.re, s, 0, len(s), count, func(match []int) error {
 		end = match[0]
 
 		b.WriteString(s[beg:end])
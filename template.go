@@ -0,0 +1,150 @@
+package re
+
+import (
+	"fmt"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+
+	"github.com/magnetde/starlark-re/util"
+)
+
+// Template is a Starlark value representing a compiled replacement template of a pattern.
+// The template is parsed and its group references are validated once, when it is created,
+// so applying it with `sub`, `subn` or `Match.expand` does not parse it again.
+// Templates are immutable, so they can be shared between threads.
+type Template struct {
+	p        *Pattern
+	template strOrBytes
+	r        *templateReplacer
+}
+
+// Check if the type satisfies the interfaces.
+var (
+	_ starlark.Value      = (*Template)(nil)
+	_ starlark.HasAttrs   = (*Template)(nil)
+	_ starlark.Comparable = (*Template)(nil)
+)
+
+// newTemplate compiles the template for the pattern `p`.
+func newTemplate(p *Pattern, template strOrBytes) (*Template, error) {
+	if err := template.sameType(p.pattern); err != nil {
+		return nil, err
+	}
+
+	r, err := newTemplateReplacer(p.re, template.value, template.isString)
+	if err != nil {
+		return nil, err
+	}
+
+	t := Template{
+		p:        p,
+		template: template,
+		r:        r,
+	}
+
+	return &t, nil
+}
+
+// replacerFor returns the replacer of the template, if the template was compiled for a pattern equal to `p`.
+// Group references are resolved when compiling the template, so they are only valid for equal patterns.
+func (t *Template) replacerFor(p *Pattern) (matchReplacer, error) {
+	if !patternEquals(t.p, p) {
+		return nil, fmt.Errorf("template was compiled for the pattern %s", t.p.String())
+	}
+
+	return t.r, nil
+}
+
+// String returns the string representation of the value.
+func (t *Template) String() string {
+	var b strings.Builder
+	b.WriteString("<re.Template object; template=")
+	b.WriteString(util.Repr(t.template.value, t.template.isString))
+	b.WriteByte('>')
+	return b.String()
+}
+
+// Type returns a short string describing the value's type.
+func (t *Template) Type() string { return "Template" }
+
+// Freeze marks the value and all members as frozen.
+func (t *Template) Freeze() {}
+
+// Truth returns the truth value of the object.
+func (t *Template) Truth() starlark.Bool { return true }
+
+// Hash returns the hash value of this value.
+func (t *Template) Hash() (uint32, error) { return starlark.String(t.template.value).Hash() }
+
+// templateMembers contains members of the template object.
+var templateMembers = map[string]func(t *Template) starlark.Value{
+	"pattern":  func(t *Template) starlark.Value { return t.p },
+	"template": func(t *Template) starlark.Value { return t.template.asType(t.template.value) },
+}
+
+// Attr returns the member of the template with the given name.
+// If the member does not exist, `nil, nil` is returned.
+func (t *Template) Attr(name string) (starlark.Value, error) {
+	if o, ok := templateMembers[name]; ok {
+		return o(t), nil
+	}
+
+	return nil, nil
+}
+
+// AttrNames lists available dot expression members.
+func (t *Template) AttrNames() []string {
+	return []string{"pattern", "template"}
+}
+
+// CompareSameType compares this template to another one.
+// It is only possible to compare templates for equality and inequality.
+func (t *Template) CompareSameType(op syntax.Token, y starlark.Value, _ int) (bool, error) {
+	o := y.(*Template)
+
+	switch op {
+	case syntax.EQL:
+		return templateEquals(t, o), nil
+	case syntax.NEQ:
+		return !templateEquals(t, o), nil
+	default:
+		return false, fmt.Errorf("%s %s %s not implemented", t.Type(), op, o.Type())
+	}
+}
+
+// templateEquals compares two templates for equality.
+func templateEquals(x, y *Template) bool {
+	return patternEquals(x.p, y.p) && x.template == y.template
+}
+
+// reCompileTemplate compiles the pattern and the replacement template `repl` of the pattern.
+// The resulting template can be passed to `sub`, `subn` and `Match.expand` instead of the replacement string.
+func reCompileTemplate(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		pattern patternParam
+		repl    strOrBytes
+		flags   uint32
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "pattern", &pattern, "repl", &repl, "flags?", &flags); err != nil {
+		return nil, err
+	}
+
+	p, err := regexCompile(thread, b, pattern, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTemplate(p, repl)
+}
+
+// patternTemplate - see `reCompileTemplate`.
+func patternTemplate(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var repl strOrBytes
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "repl", &repl); err != nil {
+		return nil, err
+	}
+
+	return newTemplate(b.Receiver().(*Pattern), repl)
+}
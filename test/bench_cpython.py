@@ -0,0 +1,33 @@
+# Runs the workloads of `BenchmarkMethods` and `BenchmarkCompileCache*` (see bench_test.go) with the
+# re module of CPython, so the results of the Go benchmarks can be compared to Python.
+# Usage: python3 test/bench_cpython.py
+
+import re
+import timeit
+
+inputs = [
+    ('ascii', 'The quick brown fox, jumps over the lazy dog. ' * 200),
+    ('nonascii', 'Fünf Bücher, über Straßen und Plätze. Ça va. ' * 200),
+    ('invalid', 'Fünf Bücher, über Straßen und Plätze.\udcff Ça va. ' * 200), # lone surrogate instead of invalid UTF-8
+]
+
+methods = [
+    ('search', r'\d{3}', ()),
+    ('findall', r'\w+', ()),
+    ('sub', r'\s+', ('_',)),
+    ('split', r'[,.] ', ()),
+]
+
+def bench(name, fn):
+    n, total = timeit.Timer(fn).autorange()
+    print('%-40s %12.0f ns/op' % (name, total / n * 1e9))
+
+for method, pattern, args in methods:
+    p = re.compile(pattern)
+    fn = getattr(p, method)
+    for name, text in inputs:
+        bench('%s/%s' % (method, name), lambda: fn(*args, text))
+
+email = r'(?P<user>[\w.+-]+)@(?P<host>[\w-]+(?:\.[\w-]+)+)'
+bench('CompileCacheHit', lambda: re.compile(email))
+bench('CompileCacheMiss', lambda: (re.purge(), re.compile(email)))
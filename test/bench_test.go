@@ -0,0 +1,262 @@
+package re
+
+import (
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+
+	re "github.com/magnetde/starlark-re"
+	"github.com/magnetde/starlark-re/regex"
+	"github.com/magnetde/starlark-re/util"
+)
+
+// benchText is the text used for benchmarks, which contains many words separated by spaces and punctuation.
+var benchText = strings.Repeat("The quick brown fox, jumps over the lazy dog. ", 200)
+
+// benchmarkMethod calls the method of a compiled pattern with the arguments in a loop.
+// The pattern is compiled once with the expression `compile` before the benchmark starts.
+func benchmarkMethod(b *testing.B, compile, method string, args ...starlark.Value) {
+	b.Helper()
+	benchmarkModuleMethod(b, re.NewModule(), compile, method, args...)
+}
+
+// benchmarkModuleMethod is like `benchmarkMethod`, but compiles the pattern with the module `m`.
+func benchmarkModuleMethod(b *testing.B, m *re.Module, compile, method string, args ...starlark.Value) {
+	b.Helper()
+
+	thread := &starlark.Thread{Name: "bench"}
+
+	p, err := evalExpr(m, compile)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	fn, err := p.(*re.Pattern).Attr(method)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := starlark.Call(thread, fn, args, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkFindallWordBoundary searches all empty matches at word boundaries.
+// Each empty match is searched again for the longest match.
+func BenchmarkFindallWordBoundary(b *testing.B) {
+	benchmarkMethod(b, `re.compile(r'\b')`, "findall", starlark.String(benchText))
+}
+
+// BenchmarkSubEmptyMatches replaces many empty matches.
+func BenchmarkSubEmptyMatches(b *testing.B) {
+	benchmarkMethod(b, `re.compile(r'x*')`, "sub", starlark.String("-"), starlark.String(benchText))
+}
+
+// BenchmarkFullmatchLongest uses the longest match search to match the full string.
+func BenchmarkFullmatchLongest(b *testing.B) {
+	benchmarkMethod(b, `re.compile(r'\w+')`, "fullmatch", starlark.String("abcdef"))
+}
+
+// logText is a text with a rare literal, which is contained in every match of the benchmarked patterns.
+var logText = strings.Repeat("INFO: request handled in 12ms\n", 500) + "ERROR: timeout\n"
+
+// BenchmarkSearchLiteralStd searches a pattern with a literal prefix with the default engine.
+func BenchmarkSearchLiteralStd(b *testing.B) {
+	benchmarkMethod(b, `re.compile(r'ERROR: (\w+)')`, "search", starlark.String(logText))
+}
+
+// BenchmarkSearchLiteralFallback searches a pattern with a literal prefix with the fallback engine.
+func BenchmarkSearchLiteralFallback(b *testing.B) {
+	benchmarkMethod(b, `re.compile(r'ERROR: (\w+)', re.FALLBACK)`, "search", starlark.String(logText))
+}
+
+// BenchmarkSearchLiteralBacktrack searches a pattern with a literal prefix with the backtracking engine.
+func BenchmarkSearchLiteralBacktrack(b *testing.B) {
+	benchmarkMethod(b, `re.compile(r'ERROR: (?!\d)(\w+)')`, "search", starlark.String(logText))
+}
+
+// nonASCIIText is a text with non-ASCII characters and an invalid UTF-8 byte, so the inputs of the regex engines
+// have to be prepared before searching.
+var nonASCIIText = strings.Repeat("Grüße aus Köln, ", 4000) + "\xff"
+
+// benchmarkPatterns searches all patterns in the same text in a loop, using the same thread for all searches.
+func benchmarkPatterns(b *testing.B, flags string, patterns ...string) {
+	b.Helper()
+
+	m := re.NewModule()
+	thread := &starlark.Thread{Name: "bench"}
+
+	var fns []starlark.Value
+	for _, pattern := range patterns {
+		p, err := evalExpr(m, "re.compile(r'"+pattern+"', "+flags+")")
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		fn, err := p.(*re.Pattern).Attr("search")
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		fns = append(fns, fn)
+	}
+
+	args := starlark.Tuple{starlark.String(nonASCIIText)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, fn := range fns {
+			if _, err := starlark.Call(thread, fn, args, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkSearchPatternsNonASCIIStd searches several patterns in the same non-ASCII text with the default engine.
+// The prepared input is shared by all searches.
+func BenchmarkSearchPatternsNonASCIIStd(b *testing.B) {
+	benchmarkPatterns(b, "0", `^Grüße`, `^\w+`, `^G`, `^(\w+) aus`, `^.`)
+}
+
+// BenchmarkSearchPatternsNonASCIIFallback searches several patterns in the same non-ASCII text with the fallback engine.
+// The prepared input is shared by all searches.
+func BenchmarkSearchPatternsNonASCIIFallback(b *testing.B) {
+	benchmarkPatterns(b, "re.FALLBACK", `^Grüße`, `^\w+`, `^G`, `^(\w+) aus`, `^.`)
+}
+
+// benchInputs are the inputs of `BenchmarkMethods`, which have about the same number of characters.
+var benchInputs = []struct {
+	name string
+	text string
+}{
+	{"ascii", strings.Repeat("The quick brown fox, jumps over the lazy dog. ", 200)},
+	{"nonascii", strings.Repeat("Fünf Bücher, über Straßen und Plätze. Ça va. ", 200)},
+	{"invalid", strings.Repeat("Fünf Bücher, über Straßen und Plätze.\xff Ça va. ", 200)},
+}
+
+// benchEngines are the flags and the forced engines (see `ModuleOptions.Engine`) used to select
+// the regex engines in `BenchmarkMethods`.
+var benchEngines = []struct {
+	name   string
+	flags  string
+	engine string
+}{
+	{"std", "0", ""},
+	{"backtrack", "0", regex.EngineBacktrack},
+	{"fallback", "re.FALLBACK", ""},
+}
+
+// benchMethods are the methods benchmarked by `BenchmarkMethods` together with their pattern.
+// The text is always the last argument.
+var benchMethods = []struct {
+	method  string
+	pattern string
+	args    []starlark.Value
+}{
+	{"search", `\d{3}`, nil}, // no match, so the whole text is scanned
+	{"findall", `\w+`, nil},
+	{"sub", `\s+`, []starlark.Value{starlark.String("_")}},
+	{"split", `[,.] `, nil},
+}
+
+// BenchmarkMethods benchmarks the methods `search`, `findall`, `sub` and `split` for all combinations
+// of inputs and regex engines. The benchmarks are named "<method>/<input>/<engine>".
+func BenchmarkMethods(b *testing.B) {
+	for _, m := range benchMethods {
+		for _, in := range benchInputs {
+			for _, e := range benchEngines {
+				m, in, e := m, in, e
+
+				b.Run(m.method+"/"+in.name+"/"+e.name, func(b *testing.B) {
+					opts := re.DefaultOptions()
+					opts.Engine = e.engine
+
+					args := append(append([]starlark.Value(nil), m.args...), starlark.String(in.text))
+					benchmarkModuleMethod(b, re.NewModuleOptions(opts), "re.compile(r'"+m.pattern+"', "+e.flags+")", m.method, args...)
+				})
+			}
+		}
+	}
+}
+
+// benchmarkCompile calls `re.compile` with the same pattern in a loop.
+func benchmarkCompile(b *testing.B, m *re.Module) {
+	b.Helper()
+
+	thread := &starlark.Thread{Name: "bench"}
+
+	fn, err := m.Attr("compile")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	args := starlark.Tuple{starlark.String(`(?P<user>[\w.+-]+)@(?P<host>[\w-]+(?:\.[\w-]+)+)`)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := starlark.Call(thread, fn, args, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCompileCacheHit compiles a pattern, which is already stored in the pattern cache.
+func BenchmarkCompileCacheHit(b *testing.B) {
+	benchmarkCompile(b, re.NewModule())
+}
+
+// BenchmarkCompileCacheMiss compiles a pattern without the pattern cache, so the pattern is parsed,
+// preprocessed and compiled in every iteration.
+func BenchmarkCompileCacheMiss(b *testing.B) {
+	benchmarkCompile(b, re.NewModuleOptions(&re.ModuleOptions{DisableCache: true}))
+}
+
+// benchBits creates an optimized bitarray with `n` bits, which looks like the bitarray of a text
+// with many two-byte characters.
+func benchBits(n int) *util.BitArray {
+	var bits util.BitArray
+	bits.Grow(n)
+
+	for i := 0; i < n; i++ {
+		bits.Append(i%3 != 2)
+	}
+	bits.Optimize()
+
+	return &bits
+}
+
+// BenchmarkBitArrayRank performs rank queries at pseudo-random positions of a large bitarray.
+func BenchmarkBitArrayRank(b *testing.B) {
+	const n = 1 << 20
+	bits := benchBits(n)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		bits.Rank((i * 7919) % n)
+	}
+}
+
+// BenchmarkBitArraySelect performs select queries of pseudo-random 1-bits of a large bitarray.
+func BenchmarkBitArraySelect(b *testing.B) {
+	const n = 1 << 20
+	bits := benchBits(n)
+	ones := bits.Rank(n - 1)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		bits.Select(1 + (i*7919)%ones)
+	}
+}
@@ -0,0 +1,413 @@
+package re
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	"go.starlark.net/starlark"
+
+	re "github.com/magnetde/starlark-re"
+	"github.com/magnetde/starlark-re/regex"
+	"github.com/magnetde/starlark-re/util"
+)
+
+const (
+	fuzzFlags      = regex.FlagIgnoreCase | regex.FlagMultiline | regex.FlagDotAll | regex.FlagVerbose | regex.FlagASCII
+	fuzzMaxPattern = 128 // maximum length of the fuzzed patterns
+	fuzzMaxText    = 64  // maximum length of the fuzzed texts, so backtracking of the fallback engines stays fast
+)
+
+// repeatedGroup matches patterns, which may contain a repeated group. Unlike Python, the default engine skips
+// empty iterations of repeated groups, which changes the captures and sometimes even the matches.
+var repeatedGroup = regexp.MustCompile(`\)\s*(?:[*+?]|\{\d*,?\d*\})`)
+
+// seedPatterns matches calls of the module functions in "re_test.py" with a literal pattern and text.
+var seedPatterns = regexp.MustCompile(`re\.(?:search|match|fullmatch|findall|finditer|split)\((r?)'((?:[^'\\]|\\.)*)', (r?)'((?:[^'\\]|\\.)*)'`)
+
+// pythonLiteral returns the value of the Python string literal with the content `s`.
+// If the literal contains escape sequences unknown to Go, false is returned.
+func pythonLiteral(raw bool, s string) (string, bool) {
+	if raw {
+		return s, true
+	}
+
+	s = strings.ReplaceAll(s, `\'`, `'`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+
+	v, err := strconv.Unquote(`"` + s + `"`)
+	return v, err == nil
+}
+
+// addSeeds adds the patterns and texts of "re_test.py" to the seed corpus of the fuzz target.
+func addSeeds(f *testing.F) {
+	for _, m := range seedPatterns.FindAllStringSubmatch(reScript, -1) {
+		pattern, ok1 := pythonLiteral(m[1] != "", m[2])
+		text, ok2 := pythonLiteral(m[3] != "", m[4])
+		if !ok1 || !ok2 {
+			continue
+		}
+
+		f.Add(pattern, text, uint32(0), true)
+		f.Add(pattern, text, regex.FlagIgnoreCase, true)
+		f.Add(pattern, text, uint32(0), false)
+	}
+}
+
+// FuzzEngines compiles random str and bytes patterns with the default, the backtracking and the fallback engine
+// and reports different results of `findall` and `sub`. Patterns, that are not supported by the default engine, are skipped.
+// Results are also not compared for known limitations of the engines: `\b` and `\B` at non-ASCII characters,
+// non-empty matches directly after empty matches, which depend on the longest match search, and repeated groups.
+// These patterns are still compiled with all engines.
+func FuzzEngines(f *testing.F) {
+	addSeeds(f)
+
+	m := re.NewModule()
+	backtrack := re.NewModuleOptions(&re.ModuleOptions{Engine: regex.EngineBacktrack})
+
+	f.Fuzz(func(t *testing.T, pattern, text string, flags uint32, isStr bool) {
+		flags &= fuzzFlags
+
+		if len(pattern) > fuzzMaxPattern || len(text) > fuzzMaxText || isStr && !utf8.ValidString(pattern) {
+			return
+		}
+		if isStr && (strings.Contains(pattern, `\b`) || strings.Contains(pattern, `\B`)) {
+			return
+		}
+		if _, _, err := regex.Compile(pattern, isStr, flags, false, nil); err != nil {
+			return // invalid or not supported by the default engine
+		}
+
+		thread := &starlark.Thread{Name: "fuzz"}
+
+		std := fuzzCompile(t, thread, m, pattern, isStr, flags)
+		fallb := fuzzCompile(t, thread, m, pattern, isStr, flags|regex.FlagFallback)
+		backtr := fuzzCompile(t, thread, backtrack, pattern, isStr, flags)
+
+		if repeatedGroup.MatchString(pattern) {
+			return
+		}
+
+		value := fuzzValue(text, isStr)
+		if matchesAfterEmpty(t, thread, std, value) {
+			return
+		}
+
+		for _, method := range []string{"findall", "sub"} {
+			args := starlark.Tuple{value}
+			if method == "sub" {
+				args = starlark.Tuple{fuzzValue(`<\g<0>>`, isStr), value}
+			}
+
+			a := fuzzCall(t, thread, std, method, args)
+			b := fuzzCall(t, thread, fallb, method, args)
+			c := fuzzCall(t, thread, backtr, method, args)
+
+			if eq, err := starlark.Equal(a, b); err != nil || !eq {
+				t.Errorf("%s(%s, %s) with flags %d: default engine returned %s, fallback engine returned %s",
+					method, fuzzValue(pattern, isStr), value, flags, a, b)
+			}
+			if eq, err := starlark.Equal(a, c); err != nil || !eq {
+				t.Errorf("%s(%s, %s) with flags %d: default engine returned %s, backtracking engine returned %s",
+					method, fuzzValue(pattern, isStr), value, flags, a, c)
+			}
+		}
+	})
+}
+
+// fuzzValue converts the fuzzed string to a Starlark string or bytes value.
+func fuzzValue(s string, isStr bool) starlark.Value {
+	if isStr {
+		return starlark.String(s)
+	}
+
+	return starlark.Bytes(s)
+}
+
+// fuzzCompile compiles the str or bytes pattern with the module.
+func fuzzCompile(t *testing.T, thread *starlark.Thread, m *re.Module, pattern string, isStr bool, flags uint32) *re.Pattern {
+	t.Helper()
+
+	fn, err := m.Attr("compile")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := starlark.Call(thread, fn, starlark.Tuple{fuzzValue(pattern, isStr), starlark.MakeUint(uint(flags))}, nil)
+	if err != nil {
+		t.Fatalf("compile(%s) with flags %d failed: %v", fuzzValue(pattern, isStr), flags, err)
+	}
+
+	return p.(*re.Pattern)
+}
+
+// fuzzCall calls the method of the pattern or match object.
+func fuzzCall(t *testing.T, thread *starlark.Thread, p starlark.HasAttrs, method string, args starlark.Tuple) starlark.Value {
+	t.Helper()
+
+	fn, err := p.Attr(method)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := starlark.Call(thread, fn, args, nil)
+	if err != nil {
+		t.Fatalf("%s(%q) failed: %v", method, args, err)
+	}
+
+	return v
+}
+
+// matchesAfterEmpty reports, whether the pattern finds a non-empty match in the text, that starts at the end
+// of an empty match. Unlike Python, the default engine searches the longest match at this position and
+// the fallback engine skips it, so the results of the engines may differ. Other empty matches are compared.
+func matchesAfterEmpty(t *testing.T, thread *starlark.Thread, p *re.Pattern, text starlark.Value) bool {
+	t.Helper()
+
+	it := starlark.Iterate(fuzzCall(t, thread, p, "finditer", starlark.Tuple{text}))
+	defer it.Done()
+
+	emptyEnd := -1
+
+	var x starlark.Value
+	for it.Next(&x) {
+		span := fuzzCall(t, thread, x.(*re.Match), "span", nil).(starlark.Tuple)
+
+		start, _ := starlark.AsInt32(span[0])
+		end, _ := starlark.AsInt32(span[1])
+
+		if start == end {
+			emptyEnd = end
+		} else if start == emptyEnd {
+			return true
+		}
+	}
+
+	return false
+}
+
+// patternLiterals matches calls of the module functions in "re_test.py" with a literal pattern.
+var patternLiterals = regexp.MustCompile(`re\.\w+\((r?)'((?:[^'\\]|\\.)*)'`)
+
+// templateLiterals matches calls of `re.sub` in "re_test.py" with a literal pattern and template.
+var templateLiterals = regexp.MustCompile(`re\.subn?\((?:r?)'(?:[^'\\]|\\.)*', (r?)'((?:[^'\\]|\\.)*)'`)
+
+// errorPosition matches the position of errors returned by the parsers.
+var errorPosition = regexp.MustCompile(` at position (\d+)(?: \(line (\d+), column (\d+)\))?$`)
+
+// unpositionedErrors are errors of the parsers, that do not refer to a position, like in Python.
+var unpositionedErrors = []string{
+	"cannot use LOCALE flag with a str pattern",
+	"ASCII and UNICODE flags are incompatible",
+	"cannot use UNICODE flag with a bytes pattern",
+	"ASCII and LOCALE flags are incompatible",
+	"the repetition number is too large",
+}
+
+// checkError checks, that the error of a parser refers to a valid position in the parsed string `s`.
+// If the string contains newlines, the line and column numbers must match the position.
+func checkError(t *testing.T, s string, err error) {
+	t.Helper()
+
+	msg := err.Error()
+	for _, e := range unpositionedErrors {
+		if msg == e {
+			return
+		}
+	}
+
+	m := errorPosition.FindStringSubmatch(msg)
+	if m == nil {
+		t.Fatalf("error of %q has no position: %s", s, msg)
+	}
+
+	pos, _ := strconv.Atoi(m[1])
+	if pos < 0 || pos > len(s) {
+		t.Fatalf("error of %q has a position outside of the string: %s", s, msg)
+	}
+
+	if m[2] != "" {
+		line, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+
+		if line != strings.Count(s[:pos], "\n")+1 || col != pos-strings.LastIndex(s[:pos], "\n") {
+			t.Fatalf("error of %q has a wrong line or column: %s", s, msg)
+		}
+	}
+}
+
+// FuzzParse parses and compiles random patterns and checks, that the parser does not panic and that errors
+// refer to a valid position in the pattern. The patterns are also linted and explained, and the findings of the
+// linter must refer to valid positions too.
+func FuzzParse(f *testing.F) {
+	for _, m := range patternLiterals.FindAllStringSubmatch(reScript, -1) {
+		if pattern, ok := pythonLiteral(m[1] != "", m[2]); ok {
+			f.Add(pattern, true, uint32(0))
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, pattern string, isStr bool, flags uint32) {
+		if len(pattern) > fuzzMaxPattern {
+			return
+		}
+
+		flags &^= regex.FlagDebug
+
+		if _, _, err := regex.Compile(pattern, isStr, flags, true, nil); err != nil {
+			checkError(t, pattern, err)
+		}
+
+		findings, err := regex.Lint(pattern, isStr, flags)
+		if err != nil {
+			return
+		}
+
+		if _, err := regex.Explain(pattern, isStr, flags); err != nil {
+			t.Fatalf("cannot explain %q: %v", pattern, err)
+		}
+		if _, err := regex.Dot(pattern, isStr, flags); err != nil {
+			t.Fatalf("cannot create the graph of %q: %v", pattern, err)
+		}
+		if _, err := regex.RailroadSVG(pattern, isStr, flags); err != nil {
+			t.Fatalf("cannot create the railroad diagram of %q: %v", pattern, err)
+		}
+
+		// translations may fail for constructs, that the dialect does not support, but they must not panic
+		for _, dialect := range []string{regex.DialectRE2, regex.DialectPCRE, regex.DialectECMAScript, regex.DialectDotNet} {
+			_, _ = regex.Translate(pattern, isStr, flags, dialect)
+		}
+		for _, dialect := range []string{regex.DialectRE2, regex.DialectPCRE, regex.DialectECMAScript} {
+			_, _, _ = regex.ImportPattern(pattern, isStr, dialect)
+		}
+
+		for _, f := range findings {
+			if f.Pos < 0 || f.End < f.Pos || f.End > len(pattern) {
+				t.Fatalf("finding of %q has an invalid position: %d-%d %s", pattern, f.Pos, f.End, f.Message)
+			}
+		}
+	})
+}
+
+// FuzzTemplate parses random replacement templates and checks, that the parser does not panic and that errors
+// refer to a valid position in the template.
+func FuzzTemplate(f *testing.F) {
+	for _, m := range templateLiterals.FindAllStringSubmatch(reScript, -1) {
+		if template, ok := pythonLiteral(m[1] != "", m[2]); ok {
+			f.Add(template, true)
+		}
+	}
+
+	str, _, err := regex.Compile(`(?P<first>a)(b)(?P<last>c)`, true, 0, true, nil)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	bytes, _, err := regex.Compile(`(?P<first>a)(b)(?P<last>c)`, false, 0, true, nil)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Fuzz(func(t *testing.T, template string, isStr bool) {
+		e := bytes
+		if isStr {
+			e = str
+		}
+
+		rules, err := regex.ParseTemplate(e, template, isStr)
+		if err != nil {
+			checkError(t, template, err)
+			return
+		}
+
+		for _, r := range rules {
+			if r.Group > e.SubexpCount() {
+				t.Fatalf("template %q refers to the unknown group %d", template, r.Group)
+			}
+		}
+	})
+}
+
+// FuzzFormat checks, that parsing random format strings does not panic, that errors have valid positions,
+// and that formatting the groups with the parsed rules does not panic.
+func FuzzFormat(f *testing.F) {
+	for _, format := range []string{"", "{0}", "{}{}", "{{{first}}}", "{2!r:>10}", "{last!a:*^7.2s}", "{0:05}", "{:é<3}", "{0!", "}"} {
+		f.Add(format, true)
+		f.Add(format, false)
+	}
+
+	str, _, err := regex.Compile(`(?P<first>a)(b)(?P<last>c)`, true, 0, true, nil)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	bytes, _, err := regex.Compile(`(?P<first>a)(b)(?P<last>c)`, false, 0, true, nil)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Fuzz(func(t *testing.T, format string, isStr bool) {
+		e := bytes
+		if isStr {
+			e = str
+		}
+
+		rules, err := regex.ParseFormat(e, format, isStr)
+		if err != nil {
+			checkError(t, format, err)
+			return
+		}
+
+		var b strings.Builder
+		for _, r := range rules {
+			if r.IsLiteral() {
+				continue
+			}
+			if r.Group > e.SubexpCount() {
+				t.Fatalf("format %q refers to the unknown group %d", format, r.Group)
+			}
+
+			r.Write(&b, "ä\xff'", isStr)
+		}
+	})
+}
+
+// FuzzRepr checks, that the representation of random strings and bytes can be evaluated by Starlark again,
+// and that printable characters of strings are not escaped. Starlark has no literals for strings with
+// invalid UTF-8 characters, so these strings are only checked for panics.
+func FuzzRepr(f *testing.F) {
+	for _, s := range []string{"", "abc", "'", `"`, `'"`, "\\", "\t\n\r\x00\x7f", "ä€\U0001f600", "�", "\xff\xc3"} {
+		f.Add(s, true)
+		f.Add(s, false)
+	}
+
+	f.Fuzz(func(t *testing.T, s string, isStr bool) {
+		repr := util.Repr(s, isStr)
+		if isStr && !utf8.ValidString(s) {
+			return
+		}
+
+		thread := &starlark.Thread{Name: "fuzz"}
+
+		v, err := starlark.Eval(thread, "repr", repr, nil)
+		if err != nil {
+			t.Fatalf("cannot evaluate the representation %s of %q: %v", repr, s, err)
+		}
+
+		if isStr {
+			if v != starlark.String(s) {
+				t.Fatalf("representation %s of %q evaluates to %s", repr, s, v)
+			}
+
+			for _, c := range s {
+				if unicode.IsPrint(c) && c != '\\' && c != '\'' && c != '"' && !strings.ContainsRune(repr, c) {
+					t.Fatalf("representation %s of %q escapes the printable character %q", repr, s, c)
+				}
+			}
+		} else if v != starlark.Bytes(s) {
+			t.Fatalf("representation %s of %q evaluates to %s", repr, s, v)
+		}
+	})
+}
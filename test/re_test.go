@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	"go.starlark.net/syntax"
 
 	re "github.com/magnetde/starlark-re"
+	"github.com/magnetde/starlark-re/regex"
 )
 
 //go:embed re_test.py
@@ -21,7 +23,7 @@ var reScript string
 // TestRe is the main function for regex tests.
 // Tests must be defined within the `re_test.py` file and are interpreted here.
 func TestRe(t *testing.T) {
-	err := runTests(t, re.NewModule(), true, true)
+	err := runTests(t, re.NewModule(), true, true, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -31,7 +33,7 @@ func TestRe(t *testing.T) {
 		MaxCacheSize: -1,
 	}
 
-	err = runTests(t, re.NewModuleOptions(options), false, true)
+	err = runTests(t, re.NewModuleOptions(options), false, true, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -41,19 +43,518 @@ func TestRe(t *testing.T) {
 		DisableFallback: true,
 	}
 
-	err = runTests(t, re.NewModuleOptions(options), true, false)
+	err = runTests(t, re.NewModuleOptions(options), true, false, false)
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	// Use the ISO-8859-1 table for the LOCALE flag
+	options = &re.ModuleOptions{
+		Locale: regex.LocaleLatin1(),
+	}
+
+	err = runTests(t, re.NewModuleOptions(options), true, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestExport tests, if the pattern cache can be exported and imported into another module.
+func TestExport(t *testing.T) {
+	src := re.NewModule()
+
+	patterns := []string{
+		`re.compile(r'(?P<first>\w+) (?P<last>\w+)')`,
+		`re.compile(b'[a-z]+', re.I)`,
+		`re.compile(r'(?P<x>a)(?=a)\1', re.FALLBACK)`,
+		`re.compile('\u00e4+', re.I)`,
+	}
+
+	for _, p := range patterns {
+		if _, err := evalExpr(src, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := src.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := re.NewModule()
+	if err = dst.Import(data); err != nil {
+		t.Fatal(err)
+	}
+
+	data2, err := dst.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(data2) {
+		t.Fatalf("exported patterns differ: %s != %s", data, data2)
+	}
+
+	checks := map[string]string{
+		`re.match(r'(?P<first>\w+) (?P<last>\w+)', 'Jane Doe').groupdict()`: `{"first": "Jane", "last": "Doe"}`,
+		`re.findall(b'[a-z]+', b'ab CD', re.I)`:                             `[b"ab", b"CD"]`,
+		`re.search(r'(?P<x>a)(?=a)\1', 'ab aa', re.FALLBACK).span('x')`:     `(3, 4)`,
+		`re.compile('\u00e4+', re.I).fullmatch('\u00c4\u00e4')`:             `<re.Match object; span=(0, 4), match='Ää'>`,
+	}
+
+	for expr, want := range checks {
+		v, err := evalExpr(dst, expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := v.String(); got != want {
+			t.Errorf("%s: got %s, want %s", expr, got, want)
+		}
+	}
+
+	// Modules with different options must reject the data.
+	if err = re.NewModuleOptions(&re.ModuleOptions{DisableFallback: true}).Import(data); err == nil {
+		t.Error("expected an error when importing into a module without fallback engine")
+	}
+	if err = re.NewModuleOptions(&re.ModuleOptions{MaxCacheSize: -1}).Import(data); err == nil {
+		t.Error("expected an error when importing into a module without cache")
+	}
+
+	// Locales are compared by their character tables, not by their names.
+	custom := regex.NewLocale("ISO-8859-1")
+	custom.SetCase(0xc4, 0xe4)
+
+	locales := []struct {
+		src, dst *regex.Locale
+		ok       bool
+	}{
+		{regex.LocaleLatin1(), regex.LocaleLatin1(), true},
+		{regex.LocaleLatin1(), custom, false},
+		{regex.NewLocale(""), nil, false},
+		{regex.NewLocale("C"), regex.NewLocale(""), true},
+	}
+
+	for i, l := range locales {
+		src := re.NewModuleOptions(&re.ModuleOptions{Locale: l.src})
+		if _, err := evalExpr(src, `re.compile(b'\\w+', re.L)`); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := src.Export()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = re.NewModuleOptions(&re.ModuleOptions{Locale: l.dst}).Import(data)
+		if l.ok && err != nil {
+			t.Errorf("locale %d: %v", i, err)
+		} else if !l.ok && err == nil {
+			t.Errorf("locale %d: expected an error when importing into a module with a different locale", i)
+		}
+	}
+}
+
+// TestSharedCache tests, if compiled patterns are shared between modules using the same cache.
+func TestSharedCache(t *testing.T) {
+	cache := re.NewSharedCache(64)
+
+	m1 := re.NewModuleOptions(&re.ModuleOptions{Cache: cache})
+	m2 := re.NewModuleOptions(&re.ModuleOptions{Cache: cache})
+	m3 := re.NewModuleOptions(&re.ModuleOptions{Cache: cache, DisableFallback: true})
+
+	p1, err := evalExpr(m1, `re.compile(r'\d+')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := evalExpr(m2, `re.compile(r'\d+')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p3, err := evalExpr(m3, `re.compile(r'\d+')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p1 != p2 {
+		t.Error("expected the same pattern for modules with the same options")
+	}
+	if p1 == p3 {
+		t.Error("expected different patterns for modules with different options")
+	}
+
+	cache.Purge()
+
+	// Compile the same pattern concurrently; it should only be compiled once.
+	const n = 32
+
+	var wg sync.WaitGroup
+	patterns := make([]starlark.Value, n)
+	errs := make([]error, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			patterns[i], errs[i] = evalExpr(m1, `re.compile(r'(?P<x>a)(?=b)')`)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if patterns[i] != patterns[0] {
+			t.Fatal("expected the same pattern for concurrent compiles")
+		}
+	}
+
+	// Threads waiting for the compilation of another thread count as misses.
+	stats := m2.Stats()
+	if stats.Misses < 1 || stats.Hits+stats.Misses != n || stats.Size != 1 || stats.Engines[regex.EngineBacktrack] != 1 {
+		t.Errorf("unexpected cache statistics: %+v", stats)
+	}
+
+	// Purging one module clears the cache for all modules.
+	m2.Purge()
+	if size := m1.Stats().Size; size != 0 {
+		t.Errorf("expected an empty cache, got size %d", size)
+	}
+
+	// The maximum size is distributed exactly between the shards and the patterns of all shards
+	// are exported from the least to the most recently used pattern.
+	for _, maxSize := range []int{1, 3, 20} {
+		small := re.NewSharedCache(maxSize)
+		m := re.NewModuleOptions(&re.ModuleOptions{Cache: small})
+
+		var patterns []string
+		for i := 0; i < 2*maxSize; i++ {
+			pattern := fmt.Sprintf("a{%d}", i)
+			if _, err := evalExpr(m, fmt.Sprintf("re.compile(%q)", pattern)); err != nil {
+				t.Fatal(err)
+			}
+			patterns = append(patterns, pattern)
+		}
+
+		stats := m.Stats()
+		if stats.MaxSize != maxSize || stats.Size > maxSize {
+			t.Errorf("max size %d: unexpected cache statistics: %+v", maxSize, stats)
+		}
+
+		var keys []string
+		small.Range(func(key re.CacheKey, p *re.Pattern) {
+			keys = append(keys, key.Pattern)
+		})
+
+		last := -1
+		for _, key := range keys {
+			i := indexOf(patterns, key)
+			if i <= last {
+				t.Errorf("max size %d: patterns %q not ordered by their use", maxSize, keys)
+				break
+			}
+			last = i
+		}
+	}
+}
+
+// indexOf returns the index of `s` in `a` or -1.
+func indexOf(a []string, s string) int {
+	for i, x := range a {
+		if x == s {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// compilingCache is a pattern cache, that counts the patterns compiled with `GetOrCompile`.
+type compilingCache struct {
+	*re.LRUCache
+	compiled int
+}
+
+// GetOrCompile compiles missing patterns and counts them.
+func (c *compilingCache) GetOrCompile(key re.CacheKey, compile func() (*re.Pattern, bool, error)) (*re.Pattern, error) {
+	if p, ok := c.Get(key); ok {
+		return p, nil
+	}
+
+	p, add, err := compile()
+	if err != nil {
+		return nil, err
+	}
+
+	c.compiled++
+	if add {
+		c.Put(key, p)
+	}
+
+	return p, nil
+}
+
+// TestCompilingCache tests, if caches implementing `GetOrCompile` compile the patterns themselves.
+func TestCompilingCache(t *testing.T) {
+	cache := &compilingCache{LRUCache: re.NewLRUCache(16)}
+	m := re.NewModuleOptions(&re.ModuleOptions{Cache: cache})
+
+	for i := 0; i < 3; i++ {
+		if _, err := evalExpr(m, `re.compile(r'a+b')`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := evalExpr(m, `re.compile(r'(')`); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+
+	if cache.compiled != 1 {
+		t.Errorf("got %d compiled patterns, want 1", cache.compiled)
+	}
+}
+
+// TestTemplate tests, if a frozen compiled template can be used concurrently by multiple threads.
+func TestTemplate(t *testing.T) {
+	m := re.NewModule()
+
+	tpl, err := evalExpr(m, `re.compile_template(r'(?P<c>\w)(\d)', r'\2\g<c>')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl.Freeze()
+
+	const n = 32
+
+	var wg sync.WaitGroup
+	results := make([]starlark.Value, n)
+	errs := make([]error, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			thread := &starlark.Thread{Name: "template"}
+			globals := starlark.StringDict{"re": m, "t": tpl}
+			results[i], errs[i] = starlark.Eval(thread, "expr", `re.sub(r'(?P<c>\w)(\d)', t, 'a1 b2 c3')`, globals)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if results[i] != starlark.String("1a 2b 3c") {
+			t.Fatalf("unexpected result %s", results[i])
+		}
+	}
+}
+
+// TestCostCache tests the LRU cache, whose capacity is bounded by the estimated cost of the patterns.
+func TestCostCache(t *testing.T) {
+	const maxCost = 16 * 1024
+
+	cache := re.NewCostLRUCache(maxCost)
+	m := re.NewModuleOptions(&re.ModuleOptions{Cache: cache})
+
+	small, err := evalExpr(m, `re.compile(r'abc')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, err := evalExpr(m, `re.compile(r'(?:abc){1000}')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	smallCost := re.EstimateCost(small.(*re.Pattern))
+	largeCost := re.EstimateCost(large.(*re.Pattern))
+	if largeCost <= maxCost || smallCost >= largeCost {
+		t.Fatalf("unexpected costs: small %d, large %d", smallCost, largeCost)
+	}
+
+	// The large pattern exceeds the capacity and is not cached.
+	if v, _ := evalExpr(m, `re.compile(r'(?:abc){1000}')`); v == large {
+		t.Error("expected the large pattern not to be cached")
+	}
+	if v, _ := evalExpr(m, `re.compile(r'abc')`); v != small {
+		t.Error("expected the small pattern to be cached")
+	}
+
+	// Overfill the cache; the total cost must never exceed the capacity.
+	for i := 0; i < 100; i++ {
+		if _, err = evalExpr(m, fmt.Sprintf(`re.compile(r'(?:x%d){20}')`, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := m.Stats()
+	if stats.Cost > maxCost || stats.MaxCost != maxCost || stats.Evictions == 0 {
+		t.Errorf("unexpected cache statistics: %+v", stats)
+	}
+	if v, _ := evalExpr(m, `re.compile(r'abc')`); v == small {
+		t.Error("expected the small pattern to be evicted")
+	}
+}
+
+// TestReleaseInputCache tests, if the prepared inputs of a thread can be dropped between searches.
+func TestReleaseInputCache(t *testing.T) {
+	m := re.NewModule()
+	thread := &starlark.Thread{Name: "release"}
+	globals := starlark.StringDict{
+		"re": m,
+		"s":  starlark.String(strings.Repeat("\u00e4", 1000) + "x"),
+	}
+
+	re.ReleaseInputCache(thread) // the thread has no cache yet
+
+	for i := 0; i < 2; i++ {
+		v, err := starlark.Eval(thread, "expr", `re.search('x', s).span()`, globals)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := v.String(); got != "(2000, 2001)" {
+			t.Errorf("got span %s, want (2000, 2001)", got)
+		}
+
+		re.ReleaseInputCache(thread)
+	}
+}
+
+// TestEngineRegistry tests the registration of additional regex engines.
+// The registered test engine only supports lookarounds and is preferred over the backtracking engine,
+// so it is selected for patterns with lookarounds, that require no other capabilities. It fails to compile
+// patterns containing "test" and compiles all other patterns with the backtracking engine.
+func TestEngineRegistry(t *testing.T) {
+	var required regex.Capabilities
+
+	var backtrack regex.EngineInfo
+	for _, e := range regex.Engines() {
+		if e.Name == regex.EngineBacktrack {
+			backtrack = e
+		}
+	}
+
+	info := regex.EngineInfo{
+		Name:         "test",
+		Capabilities: regex.CapLookaround,
+		Priority:     17,
+		Compile: func(p *regex.Parsed) (regex.Engine, error) {
+			required = p.Capabilities()
+			if strings.Contains(p.Pattern(), "test") {
+				return nil, errors.New("test engine")
+			}
+
+			return backtrack.Compile(p)
+		},
+	}
+
+	if err := regex.RegisterEngine(info); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if !regex.UnregisterEngine(info.Name) {
+			t.Errorf("expected the engine %q to be registered", info.Name)
+		}
+	})
+
+	if err := regex.RegisterEngine(info); err == nil {
+		t.Error("expected an error when registering an engine twice")
+	}
+	if err := regex.RegisterEngine(regex.EngineInfo{Name: "nocompile"}); err == nil {
+		t.Error("expected an error when registering an engine without compile function")
+	}
+
+	names := make([]string, 0)
+	for _, e := range regex.Engines() {
+		names = append(names, e.Name)
+	}
+	if got := strings.Join(names, ","); got != "std,test,backtrack,fallback" {
+		t.Errorf("unexpected engines: %s", got)
+	}
+
+	m := re.NewModule()
+
+	if _, err := evalExpr(m, `re.compile(r'(?=test)')`); err == nil || !strings.Contains(err.Error(), "test engine") {
+		t.Errorf("expected the test engine to be selected, got %v", err)
+	}
+	if want := regex.CapLookaround; required != want {
+		t.Errorf("got capabilities %s, want %s", required, want)
+	}
+
+	// Patterns, that require other capabilities, use the default engines.
+	checks := map[string]string{
+		`re.compile(r'a+b')`:                regex.EngineStd,
+		`re.compile(r'(?=a)a+b')`:           regex.EngineBacktrack, // compiled by the test engine
+		`re.compile(r'(?=a)b++')`:           regex.EngineBacktrack,
+		`re.compile(r'(a)\1')`:              regex.EngineBacktrack,
+		`re.compile(r'(a)\1', re.FALLBACK)`: regex.EngineFallback,
+	}
+
+	for expr, want := range checks {
+		v, err := evalExpr(m, expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := m.Export()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), fmt.Sprintf(`"engine":%q`, want)) {
+			t.Errorf("%s: expected engine %s", v, want)
+		}
+
+		m.Purge()
+	}
+
+	// The `Engine` option compiles all patterns without the FALLBACK flag with the same engine.
+	forced := re.NewModuleOptions(&re.ModuleOptions{Engine: regex.EngineBacktrack})
+
+	for _, expr := range []string{`re.compile(r'a+b')`, `re.compile(b'a+b')`, `re.compile(r'a+b', re.FALLBACK)`} {
+		if _, err := evalExpr(forced, expr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := forced.Stats()
+	if stats.Engines[regex.EngineBacktrack] != 2 || stats.Engines[regex.EngineFallback] != 1 {
+		t.Errorf("unexpected engines: %v", stats.Engines)
+	}
+
+	data, err := forced.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Import(data); err == nil {
+		t.Error("expected an error when importing into a module with a different engine")
+	}
+
+	forced = re.NewModuleOptions(&re.ModuleOptions{Engine: regex.EngineStd})
+	if _, err := evalExpr(forced, `re.compile(r'(a)\1')`); err == nil || !strings.Contains(err.Error(), "does not support backrefs") {
+		t.Errorf("expected an error for unsupported capabilities, got %v", err)
+	}
+
+	forced = re.NewModuleOptions(&re.ModuleOptions{Engine: "unknown"})
+	if _, err := evalExpr(forced, `re.compile(r'a')`); err == nil || !strings.Contains(err.Error(), "unknown regex engine") {
+		t.Errorf("expected an error for an unknown engine, got %v", err)
+	}
+}
+
+// evalExpr evaluates a Starlark expression with the "re" module.
+func evalExpr(m *re.Module, expr string) (starlark.Value, error) {
+	thread := &starlark.Thread{Name: "eval"}
+	return starlark.Eval(thread, "expr", expr, starlark.StringDict{"re": m})
 }
 
 // runTests executes "re_test.py".
-func runTests(t *testing.T, re *re.Module, withCache, fallbackEnabled bool) error {
+func runTests(t *testing.T, re *re.Module, withCache, fallbackEnabled, withLocale bool) error {
 	predeclared := starlark.StringDict{
 		"re":            re,
+		"fnmatch":       re.FnmatchModule(),
 		"MAXREPEAT":     starlark.MakeInt(math.MaxInt32),
 		"WITH_CACHE":    starlark.Bool(withCache),
 		"WITH_FALLBACK": starlark.Bool(fallbackEnabled),
+		"WITH_LOCALE":   starlark.Bool(withLocale),
 	}
 
 	helpers := map[string]func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error){
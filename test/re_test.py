@@ -11,6 +11,7 @@ re = re # type: ignore
 MAXREPEAT = MAXREPEAT # type: ignore
 WITH_CACHE = WITH_CACHE # type: ignore
 WITH_FALLBACK = WITH_FALLBACK # type: ignore
+WITH_LOCALE = WITH_LOCALE # type: ignore
 same = same # type: ignore
 measure = measure # type: ignore
 trycatch = trycatch # type: ignore
@@ -2353,8 +2354,7 @@ def test_zerowidth():
     assertEqual(re.split(r"\b", "a::bc"), ['', 'a', '::', 'bc', ''])
     assertEqual(re.split(r"\b|:+", "a::bc"), ['', 'a', '', '', 'bc', ''])
     assertEqual(re.split(r"(?<!\w)(?=\w)|:+", "a::bc"), ['', 'a', '', 'bc'])
-    # SKIP because regexp2 does not support longest match search:
-    # assertEqual(re.split(r"(?<=\w)(?!\w)|:+", "a::bc"), ['a', '', 'bc', ''])
+    assertEqual(re.split(r"(?<=\w)(?!\w)|:+", "a::bc"), ['a', '', 'bc', ''])
 
     assertEqual(re.sub(r"\b", "-", "a::bc"), '-a-::-bc-')
     assertEqual(re.sub(r"\b|:+", "-", "a::bc"), '-a---bc-')
@@ -2619,8 +2619,6 @@ def test_possessive_quantifiers():
     e.g. x{3,5}+ meaning match from 3 to 5 greadily and proceed
     without creating a stack frame for rolling the stack back and
     trying 1 or more fewer matches."""
-    # Not supported by either Go regex engine; skip.
-    return
     assertIsNone(re.match('e*+e', 'eeee'))
     assertEqual(re.match('e++a', 'eeea').group(0), 'eeea')
     assertEqual(re.match('e?+a', 'ea').group(0), 'ea')
@@ -2655,8 +2653,6 @@ def test_possessive_quantifiers():
     assertTrue(re.match("^x{}+$", "x{}"))
 
 def test_fullmatch_possessive_quantifiers():
-    # Not supported by either Go regex engine; skip.
-    return
     assertTrue(re.fullmatch(r'a++', 'a'))
     assertTrue(re.fullmatch(r'a*+', 'a'))
     assertTrue(re.fullmatch(r'a?+', 'a'))
@@ -2684,8 +2680,6 @@ def test_fullmatch_possessive_quantifiers():
     assertTrue(re.fullmatch(r'(?:ab){1,3}+c', 'abc'))
 
 def test_findall_possessive_quantifiers():
-    # Not supported by either Go regex engine; skip.
-    return
     assertEqual(re.findall(r'a++', 'aab'), ['aa'])
     assertEqual(re.findall(r'a*+', 'aab'), ['aa', '', ''])
     assertEqual(re.findall(r'a?+', 'aab'), ['a', 'a', '', ''])
@@ -2705,10 +2699,10 @@ def test_atomic_grouping():
     assertIsNone(pattern1.match('abc'))
     assertTrue(pattern1.match('abcc'))
     assertIsNone(re.match(r'(?>.*).', 'abc'))
-    # SKIP: assertTrue(re.match(r'(?>x)++', 'xxx'))
-    # SKIP: assertTrue(re.match(r'(?>x++)', 'xxx'))
-    # SKIP: assertIsNone(re.match(r'(?>x)++x', 'xxx'))
-    # SKIP: assertIsNone(re.match(r'(?>x++)x', 'xxx'))
+    assertTrue(re.match(r'(?>x)++', 'xxx'))
+    assertTrue(re.match(r'(?>x++)', 'xxx'))
+    assertIsNone(re.match(r'(?>x)++x', 'xxx'))
+    assertIsNone(re.match(r'(?>x++)x', 'xxx'))
 
 def test_fullmatch_atomic_grouping():
     assertTrue(re.fullmatch(r'(?>a+)', 'a'))
@@ -2755,22 +2749,22 @@ def test_bug_gh91616():
 def test_bug_gh100061():
     # gh-100061
     assertEqual(re.match('(?>(?:.(?!D))+)', 'ABCDE').span(), (0, 2))
-    # SKIP: assertEqual(re.match('(?:.(?!D))++', 'ABCDE').span(), (0, 2))
+    assertEqual(re.match('(?:.(?!D))++', 'ABCDE').span(), (0, 2))
     assertEqual(re.match('(?>(?:.(?!D))*)', 'ABCDE').span(), (0, 2))
-    # SKIP: assertEqual(re.match('(?:.(?!D))*+', 'ABCDE').span(), (0, 2))
+    assertEqual(re.match('(?:.(?!D))*+', 'ABCDE').span(), (0, 2))
     assertEqual(re.match('(?>(?:.(?!D))?)', 'CDE').span(), (0, 0))
-    # SKIP: assertEqual(re.match('(?:.(?!D))?+', 'CDE').span(), (0, 0))
+    assertEqual(re.match('(?:.(?!D))?+', 'CDE').span(), (0, 0))
     assertEqual(re.match('(?>(?:.(?!D)){1,3})', 'ABCDE').span(), (0, 2))
-    # SKIP: assertEqual(re.match('(?:.(?!D)){1,3}+', 'ABCDE').span(), (0, 2))
+    assertEqual(re.match('(?:.(?!D)){1,3}+', 'ABCDE').span(), (0, 2))
     # gh-106052
     assertEqual(re.match("(?>(?:ab?c)+)", "aca").span(), (0, 2))
-    # SKIP: assertEqual(re.match("(?:ab?c)++", "aca").span(), (0, 2))
+    assertEqual(re.match("(?:ab?c)++", "aca").span(), (0, 2))
     assertEqual(re.match("(?>(?:ab?c)*)", "aca").span(), (0, 2))
-    # SKIP: assertEqual(re.match("(?:ab?c)*+", "aca").span(), (0, 2))
+    assertEqual(re.match("(?:ab?c)*+", "aca").span(), (0, 2))
     assertEqual(re.match("(?>(?:ab?c)?)", "a").span(), (0, 0))
-    # SKIP: assertEqual(re.match("(?:ab?c)?+", "a").span(), (0, 0))
+    assertEqual(re.match("(?:ab?c)?+", "a").span(), (0, 0))
     assertEqual(re.match("(?>(?:ab?c){1,3})", "aca").span(), (0, 2))
-    # SKIP: assertEqual(re.match("(?:ab?c){1,3}+", "aca").span(), (0, 2))
+    assertEqual(re.match("(?:ab?c){1,3}+", "aca").span(), (0, 2))
 
 def test_fail():
     assertEqual(re.search(r'12(?!)|3', '123')[0], '3')
@@ -3294,10 +3288,10 @@ def test_match_lastindex():
     assertEqual(m.lastgroup, 'name')
 
 def test_possessive_repeat_err():
-    assertRaises(lambda: re.compile(r'.?+'))
-    assertRaises(lambda: re.compile(r'.*+'))
-    assertRaises(lambda: re.compile(r'.++'))
-    assertRaises(lambda: re.compile(r'.{0,}+'))
+    assertRaises(lambda: re.compile(r'.?+', re.FALLBACK))
+    assertRaises(lambda: re.compile(r'.*+', re.FALLBACK))
+    assertRaises(lambda: re.compile(r'.++', re.FALLBACK))
+    assertRaises(lambda: re.compile(r'.{0,}+', re.FALLBACK))
 
 def test_debug_flag_2():
     pat = r'(?!)(?<=\d)(?<!\d)(.+)\1[ab-c\d]{2,}(?i:x)'
@@ -3922,10 +3916,543 @@ def test_bits_optimized():
         assertEqual(p.search(s, pos=31).span(), (31, 34))
         assertIsNone(p.search(s, pos=319))
 
+        # the lengths of some bitarrays are multiples of the superblock size, so the queries
+        # for the last bit access the last superblock
+        for n in range(248, 264):
+            assertEqual(p.search('\u00e4' + 'a' * n, pos=2).span(), (2, n + 2))
+            assertEqual(p.search(inv + 'a' * n, pos=4).span(), (4, n + 4))
+
 def test_findall_empty_single_group_match():
     s = r'a:b'
     assertEqual(re.findall(r"a:(:)?b", s), [""])
 
+def test_backtrack_engine():
+    # patterns with lookarounds, backreferences or possessive repeats use the backtracking engine
+    assertEqual(re.match(r'(?i)(a)\1', 'aA').span(), (0, 2))
+    assertEqual(re.match(r'(?i)(k)\1', 'k\u212a').span(), (0, 4))
+    assertIsNone(re.match(r'(?ia)(k)\1', 'k\u212a'))
+    assertEqual(re.search(r'(?<=\d)x++', '1xxx').span(), (1, 4))
+    assertEqual(re.search(r'(?<=\u00e4)b', 'a\u00e4b').span(), (3, 4))
+    assertEqual(re.fullmatch(r'(?=a)(a|ab)(c|bcd)(d*)', 'abcd').groups(), ('a', 'bcd', ''))
+    assertEqual(re.sub(r'(?<=a)', '-', 'aaa'), 'a-a-a-')
+    assertEqual(re.findall(r'(a)(?(1)b|c)|d', 'abcd'), ['a', ''])
+    assertIsNone(re.match(r'(?=x)(?:xy|x)*+y', 'xxy'))
+    assertEqual(re.match(r'(?=x)(?:xy|x)*y', 'xxy').span(), (0, 3))
+    assertEqual(re.match(r'(?m)(?=.)^\w+$', 'ab\ncd').span(), (0, 2))
+    assertEqual(re.search(b'(?<=\\xff)\\w', b'\xffa\xff\xe5').span(), (1, 2))
+    # the backtracking state is not kept on the call stack, so many repetitions are supported
+    assertEqual(re.match(r'(?:ab)*(?=$)', 'ab' * 3000000).span(), (0, 6000000))
+    assertEqual(re.match(r'(?:(a)|b)*?(?=$)', 'ab' * 1000000).span(), (0, 2000000))
+    # after an empty match, the next match at the same position is the first non-empty one in backtracking order
+    assertEqual(re.findall(r'(?=)|a|ab', 'ab'), ['', 'a', '', ''])
+    assertEqual(re.sub(r'(?<=)|a|ab', '-', 'ab'), '---b-')
+    assertEqual(re.findall(r'(?=)(?:()|a)*', 'aa'), ['', '', '', '', ''])
+    assertEqual([m.span() for m in re.finditer(r'(?=)(?:()|a)*', 'aa')], [(0, 0), (0, 1), (1, 1), (1, 2), (2, 2)])
+
+def test_prefilter():
+    # patterns with literals, that are contained in every match, skip regions without the literal
+    inv = '\u00f9'[1] # invalid str, matched by U+00B9
+    for flags in (0, re.FALLBACK):
+        assertEqual(re.findall(r'ERROR: (\w+)', 'INFO: a ERROR: b ERROR: c', flags), ['b', 'c'])
+        assertEqual(re.findall(r'https?://(\w+)', 'http://a, https://b', flags), ['a', 'b'])
+        assertEqual(re.search(r'\d+ apples', 'we have 12 apples', flags).span(), (8, 17))
+        assertEqual(re.search(r'\w{2,3}-x', 'abcd-x', flags).span(), (1, 6))
+        assertEqual(re.search(r'\w+-x', 'abcd-x', flags).span(), (0, 6))
+        assertEqual(re.search(r'.\u00e4\u00f6x', 'a\u00e4\u00e4\u00f6x', flags).span(), (1, 8))
+        assertEqual(re.search(r'.\u20acx', 'aa\u20acx', flags).span(), (1, 6))
+        assertEqual(re.search(r'(?i)abc', 'xABC', flags).span(), (1, 4))
+        assertEqual(re.search('\u00b9b', 'a' + inv + 'b', flags).span(), (1, 3))
+        assertEqual(re.search(b'\xe4b', b'a\xe4b', flags).span(), (1, 3))
+        assertIsNone(re.search(r'abc', 'abxabd', flags))
+
+        p = re.compile(r'abc', flags)
+        assertIsNone(p.search('xabc', 2))
+        assertEqual(p.search('abcabc', 1).span(), (3, 6))
+        assertEqual(p.search('abcabc', 0, 5).span(), (0, 3))
+        assertIsNone(p.search('xxabc', 0, 4))
+        assertEqual(p.sub('-', 'abc abc'), '- -')
+
+    assertEqual(re.search(r'(?<=x)abc', 'abc xabc').span(), (5, 8))
+    assertEqual(re.search(r'(a)b(?=c)c\1', 'abcb abca').span(), (5, 9))
+
+def test_input_cache():
+    # prepared inputs of long strings are reused by subsequent searches in the same string
+    inv = '\u00f9'[1] # invalid str
+    s = 'x\u00e4\u00f6 ' * 100 + inv + 'y\u20acz'
+    b = bytes('x\u00e4\u00f6 ' * 100 + 'yz')
+    for flags in (0, re.FALLBACK):
+        for _ in range(2):
+            assertEqual(re.search('y\u20ac', s, flags).span(), (601, 605))
+            assertEqual(re.search('.y', s, flags).span(), (600, 602))
+            assertEqual(re.search('(?i)X\u00c4', s, flags).span(), (0, 3))
+            assertEqual(len(re.findall('\u00f6', s, flags)), 100)
+            assertEqual(re.compile('\u00f6 ', flags).search(s, 504).span(), (507, 510))
+            assertIsNone(re.compile('y', flags).search(s, 0, 601))
+            assertEqual(re.compile(' ', flags).findall(s, 0, 600), [' '] * 100)
+            assertEqual(re.search(b'\xb6 y', b, flags).span(), (598, 601))
+            assertEqual(re.search(b'.y', b, flags).span(), (599, 601))
+            assertEqual(len(re.findall(b'\xc3', b, flags)), 200)
+            assertEqual(re.split('\u00f6 ', s, flags)[-1], inv + 'y\u20acz')
+
+    # the cache is bounded by the total size of the inputs, so the inputs of large strings replace each other
+    large = ['\u00e4' * (1 << 21) + c for c in ('x', 'y', 'z')]
+    for flags in (0, re.FALLBACK):
+        for _ in range(2):
+            for t in large:
+                assertEqual(re.search('[xyz]', t, flags).span(), (1 << 22, (1 << 22) + 1))
+
+def test_engine_regressions():
+    # divergences between the default and the fallback engine found by fuzzing
+    for flags in (0, re.FALLBACK):
+        assertEqual(re.findall('(ab|a){0}?b', 'b', flags), [''])
+        assertEqual(re.search('(a){0}b(c)', 'bc', flags).groups(), (None, 'c'))
+        assertEqual(re.findall('(?x:a)b', 'ab', flags), ['ab'])
+        assertEqual(re.findall('(?a:a)b', 'ab', flags), ['ab'])
+        assertEqual(re.findall('(?i:(?-i:)b)', 'aB', flags), ['B'])
+        assertEqual(re.findall('(?i:)b', 'B', flags), [])
+        assertEqual(re.findall('((?:)*)', '0', flags), ['', ''])
+        assertEqual(re.sub('(?:)+', '-', 'ab', flags), '-a-b-')
+        assertEqual(re.findall(b'[\\s]', b'\v', flags), [b'\v'])
+        assertEqual(re.findall(b'\\S', b'\v', flags), [])
+        assertEqual(re.findall('[^\\S]', '\v', flags | re.A), ['\v'])
+        assertEqual(re.findall(b'x*', b'\xc3\xa4', flags), [b'', b'', b''])
+        assertEqual(re.findall(b'[\\W]', b'\xc3\xa4', flags), [b'\xc3', b'\xa4'])
+
+def test_parser_regressions():
+    # errors and crashes of the parsers found by fuzzing
+    assertEqual(re.match('x{10000000000000000000', 'x{10000000000000000000').span(), (0, 22))
+    assertEqual(re.findall('a{,10000000000000000000', 'a{,10000000000000000000'), ['a{,10000000000000000000'])
+    assertRaises(lambda: re.compile('x{10000000000000000000}'), 'the repetition number is too large')
+    assertRaises(lambda: re.compile('x{1,10000000000000000000}'), 'the repetition number is too large')
+    for ref in ('99999999999', '2147483648', '0099999999999'):
+        assertRaises(lambda: re.compile('(?(%s)a)' % ref), 'invalid group reference %s at position 3' % ref.lstrip('0'))
+        assertRaises(lambda: re.sub('(a)', '\\g<%s>' % ref, 'a'), 'invalid group reference %s at position 3' % ref.lstrip('0'))
+    assertEqual(repr(re.compile('\ufffd')), "re.compile('\ufffd')")
+    assertEqual(repr(re.compile(b'\xef\xbf\xbd')), "re.compile(b'\\xef\\xbf\\xbd')")
+
+def test_lint():
+    def lint(pattern, flags=0):
+        return [(f.kind, f.pos, f.end) for f in re.lint(pattern, flags)]
+
+    assertEqual(lint(r'(a+)+$'), [('backtracking', 0, 5)])
+    assertEqual(lint(r'(\w+\s?)*$'), [('backtracking', 0, 9)])
+    assertEqual(lint(r'(?:a|ab)*c'), [('backtracking', 3, 7)])
+    assertEqual(lint(r'(?:x|aa)*'), [])
+    assertEqual(lint(r'(?:a+b)*'), [])
+    assertEqual(lint(r'(a++)+'), [])
+    assertEqual(lint(r'(?>a+)+'), [])
+    assertEqual(lint(r'(?:abc)d'), [('redundant-group', 0, 7)])
+    assertEqual(lint(r'x(?:a)*'), [('redundant-group', 1, 6)])
+    assertEqual(lint(r'(?:ab)*|(?:a|b)c|(?i:a)'), [])
+    assertEqual(lint(r'(?:a*)*'), [('backtracking', 0, 7)])
+    assertEqual(lint(r'foo|bar|foo'), [('unreachable-branch', 8, 11)])
+    assertEqual(lint(r'(a)|(a)'), [])
+    assertEqual(lint(r'[a-zc-fa]'), [('duplicate-range', 4, 7), ('duplicate-range', 7, 8)])
+    assertEqual(lint(r'[\x61a]'), [('duplicate-range', 5, 6)])
+    assertEqual(lint(r'<.*>', re.S), [('dotall-repeat', 1, 2)])
+    assertEqual(lint(r'(?s:.)+'), [('dotall-repeat', 4, 5)])
+    assertEqual(lint(r'<.*?>|.*', re.S), [('dotall-repeat', 6, 7)])
+    assertEqual(lint(r'<.*>'), [])
+    assertEqual(lint(b'[aa]'), [('duplicate-range', 2, 3)])
+
+    f = re.lint(r'foo|foo')[0]
+    assertEqual(f.message, "alternative 'foo' is unreachable, because it is identical to the alternative at position 0")
+
+    # compiled patterns are linted with their flags
+    assertEqual(lint(re.compile(r'.+', re.S)), [('dotall-repeat', 0, 1)])
+    assertRaises(lambda: re.lint(re.compile('a'), re.I), 'cannot process flags argument with a compiled pattern')
+    assertRaises(lambda: re.lint('(a'), 'missing ), unterminated subpattern at position 0')
+
+def test_explain():
+    p = re.compile(r'(?P<year>\d{4})-(?P<month>\d\d)?')
+    assertEqual(p.explain(), '\n'.join([
+        "[0:15]  group 1 'year':",
+        "[9:14]    exactly 4 digits",
+        "[15:16] then literal '-'",
+        "[16:32] then optionally:",
+        "[16:31]   group 2 'month':",
+        "[26:28]     a digit",
+        "[28:30]     then a digit",
+    ]))
+
+    p = re.compile(r'^(?:foo|bar)\s+[^a-z_\d]*?x+$', re.M)
+    assertEqual(p.explain(), '\n'.join([
+        "[0:1]   start of a line",
+        "[4:7]   then either:",
+        "[4:7]     literal 'foo'",
+        "[8:11]  or:",
+        "[8:11]    literal 'bar'",
+        "[12:15] then one or more whitespace characters",
+        "[15:26] then zero or more characters except 'a'-'z', '_', digits (as few as possible)",
+        "[26:28] then one or more 'x' characters",
+        "[28:29] then end of a line",
+    ]))
+
+    if WITH_FALLBACK: # lookarounds, atomic groups and backreferences require the fallback engine
+        p = re.compile(r'(?i)a(?=b)(?<!c)(?>d|e)(x)(?(1)y|z)\1', re.S)
+        assertEqual(p.explain(), '\n'.join([
+            "[4:5]   literal 'a' (ignoring case)",
+            "[5:10]  then followed by:",
+            "[8:9]     literal 'b' (ignoring case)",
+            "[10:16] then not preceded by:",
+            "[14:15]   literal 'c' (ignoring case)",
+            "[16:23] then atomic group:",
+            "[19:22]   one of 'd', 'e' (ignoring case)",
+            "[23:26] then group 1:",
+            "[24:25]   literal 'x' (ignoring case)",
+            "[26:35] then if group 1 matched:",
+            "[31:32]   literal 'y' (ignoring case)",
+            "[26:35] otherwise:",
+            "[33:34]   literal 'z' (ignoring case)",
+            "[35:37] then the same text as group 1 (ignoring case)",
+        ]))
+
+    assertEqual(re.compile(r'(?s-i:.)+', re.I).explain(), '\n'.join([
+        "[0:9] one or more times:",
+        "[0:8]   non-capturing group with flags s-i:",
+        "[6:7]     any character",
+    ]))
+    assertEqual(re.compile(r'.{2,5}').explain(), "[0:6] between 2 and 5 characters except newline")
+    assertEqual(re.compile(b'a\xff[\x00-\x10]').explain(), "[0:2] literal b'a\\xff'\n[2:7] then one of b'\\x00'-b'\\x10'")
+    assertEqual(re.compile('').explain(), '[0:0] the empty string')
+
+def test_diagram():
+    p = re.compile(r'(?P<y>\d+)(a|bc)*?x{2,5}(?=z)')
+
+    dot = p.to_dot()
+    assertTrue(dot.startswith('digraph pattern {\n'))
+    assertTrue(dot.endswith('}\n'))
+    assertIn('label="group 1 \'y\'";', dot)
+    assertIn('label="one or more times";', dot)
+    assertIn('label="zero or more times (as few as possible)";', dot)
+    assertIn('label="between 2 and 5 times";', dot)
+    assertIn('label="followed by";', dot)
+    assertIn('[label="\\\\d"];', dot)
+    assertIn('[label="\'bc\'", style=rounded];', dot)
+    assertIn('[constraint=false, style=dashed];', dot)
+
+    dot = re.compile(r'(a)?(?(1)b|c)').to_dot()
+    assertIn('[label="group 1 matched?", shape=diamond];', dot)
+    assertIn('[label="yes"];', dot)
+    assertIn('[label="no"];', dot)
+
+    svg = p.to_svg()
+    assertTrue(svg.startswith('<svg xmlns="http://www.w3.org/2000/svg"'))
+    assertTrue(svg.endswith('</svg>\n'))
+    for text in ['group 1 &#39;y&#39;', 'group 2', '\\d', '&#39;bc&#39;', '1..∞', '0..∞ lazy', '2..5', 'followed by']:
+        assertIn('>' + text + '</text>', svg)
+    assertIn('<rect class="lookaround"', svg)
+
+    svg = re.compile(r'<&>|[^a-z]++').to_svg()
+    assertIn('>&#39;&lt;&amp;&gt;&#39;</text>', svg)
+    assertIn('>1..∞ possessive</text>', svg)
+
+    assertIn('label="b\'a\\\\xff\'"', re.compile(b'a\\xff').to_dot())
+    assertTrue(re.compile('').to_svg().startswith('<svg'))
+
+def test_generate():
+    for flags in (0, re.FALLBACK):
+        for pattern in [r'(?P<y>\d{4})-(0[1-9]|1[0-2])', r'[a-z]+@[a-z]+\.(com|org)', r'(a|b)\1(?(1)x|y)',
+                        r'(?i)hello\s\w*', r'[^\x00-\x7f]{2}', r'x*y?z{2,}']:
+            p = re.compile(pattern, flags)
+
+            samples = re.generate(p, n=8, seed=3)
+            assertTrue(len(samples) > 0)
+            for s in samples:
+                assertTrue(p.fullmatch(s), s)
+            assertEqual(re.generate(p, n=8, seed=3), samples)
+            assertEqual(len(samples), len(set(samples)))
+
+            for s in re.generate(p, n=8, seed=3, near_miss=True):
+                assertIsNone(p.fullmatch(s), s)
+
+    assertEqual(len(re.generate(r'\d+', n=10)), 10)
+    assertEqual(sorted(re.generate(r'a|b', n=10, seed=1)), ['a', 'b'])
+    assertEqual(re.generate(r'a{10,}', max_repeat=3), ['a' * 10])
+    assertEqual(re.generate(r'x*', n=10, max_repeat=0), [''])
+    assertEqual(re.generate(r'(?!)'), [])
+    assertEqual(re.generate(r'(?=b)a'), [])
+    assertEqual(re.generate(r'(?!)|(?!)'), [])
+    assertEqual(re.generate(r'(?:(a)|b)\1', n=3, seed=1), ['aa'])
+    assertEqual(re.generate(r'abc', near_miss=True, n=0), [])
+
+    for s in re.generate(b'[\x80-\xff]+', n=5):
+        assertEqual(type(s), 'bytes')
+        assertTrue(re.fullmatch(b'[\x80-\xff]+', s))
+    for s in re.generate(b'a+', near_miss=True):
+        assertEqual(type(s), 'bytes')
+        assertIsNone(re.fullmatch(b'a+', s))
+
+    assertRaises(lambda: re.generate(r'a', n=-1), 'n must not be negative')
+    assertRaises(lambda: re.generate(r'a', max_repeat=-1), 'max_repeat must not be negative')
+    assertRaises(lambda: re.generate(re.compile('a'), flags=re.I), 'cannot process flags argument with a compiled pattern')
+    assertRaisesRegex(lambda: re.generate(r'('), 'unterminated subpattern')
+    assertRaises(lambda: re.generate(r'a{70000}'), 'the pattern only matches strings longer than 65536 bytes')
+
+def test_translate():
+    p = re.compile(r'(?P<year>\d{4})-(\d\d)\Z')
+    assertEqual(p.translate('re2'), r'(?P<year>[\p{Nd}]{4,4})\x2d([\p{Nd}][\p{Nd}])\z')
+    assertEqual(p.translate('PCRE'), r'(?P<year>[\p{Nd}]{4,4})\x2d([\p{Nd}][\p{Nd}])\z')
+    assertEqual(p.translate('js'), r'/(?<year>[\p{Nd}]{4,4})\x2d([\p{Nd}][\p{Nd}])(?![\s\S])/u')
+    assertEqual(p.translate('.NET'), r'(?<year>[\p{Nd}]{4,4})\x2d([\p{Nd}][\p{Nd}])\z')
+
+    p = re.compile(r'(a)(?P<n>b)\2(?P=n)(?(1)x|y)\1')
+    assertEqual(p.translate('pcre'), r'(\x61)(?P<n>\x62)\2\2(?(1)\x78|\x79)\1')
+    assertEqual(p.translate('dotnet'), r'(\x61)(?<n>\x62)\k<n>\k<n>(?(1)\x78|\x79)\1')
+    assertEqual(re.compile(r'(?P<n>a)(b)\2').translate('dotnet'), r'(?<n>\x61)(\x62)\1')
+
+    assertEqual(re.compile(r'^a.$', re.M).translate('re2'), r'(?m)^\x61.$')
+    assertEqual(re.compile(r'^a.$', re.M).translate('js'), r'/(?<![^\n])\x61[^\n](?![^\n])/u')
+    assertEqual(re.compile(r'\Aa.', re.S|re.I).translate('javascript'), r'/(?<![\s\S])\x61[\s\S]/iu')
+    assertEqual(re.compile(r'\w+', re.A).translate('js'), r'/[\x30-\x39\x41-\x5a\x5f\x61-\x7a]+/u')
+    assertEqual(re.compile(r'a++').translate('dotnet'), r'(?>\x61+)')
+    assertEqual(re.compile('\U0001f600ä').translate('js'), r'/\u{1f600}\xe4/u')
+    assertEqual(re.compile('\U0001f600ä').translate('dotnet'), r'\ud83d\ude00\xe4')
+    assertEqual(re.compile('\U0001f600ä').translate('re2'), r'\x{01f600}\x{00e4}')
+    assertEqual(re.compile(b'a\\xff').translate('pcre'), r'\x61\xff')
+    assertEqual(re.compile('(?!)').translate('re2'), r'[^\x00-\x{10ffff}]')
+    assertEqual(re.compile('').translate('js'), '/(?:)/u')
+    assertEqual(re.compile(r'\ba\B', re.A).translate('re2'), r'\b\x61\B')
+    assertEqual(re.compile(r'(?a:\b)a').translate('js'), r'/(?:\b)\x61/u')
+    assertEqual(re.compile(b'\\ba').translate('js'), r'/\b\x61/')
+    assertEqual(re.compile(r'\ba').translate('dotnet'), r'\b\x61')
+
+    assertRaises(lambda: re.compile(r'(?<=a)b').translate('re2'), 'cannot translate lookbehind assertion at position 0 to RE2')
+    assertRaises(lambda: re.compile(r'a(?!b)').translate('re2'), 'cannot translate negative lookahead assertion at position 1 to RE2')
+    assertRaises(lambda: re.compile(r'(a)\1').translate('re2'), 'cannot translate backreference at position 3 to RE2')
+    assertRaises(lambda: re.compile(r'(a)?(?(1)b)').translate('js'), 'cannot translate conditional expression at position 4 to ECMAScript')
+    assertRaises(lambda: re.compile(r'(?>a)').translate('js'), 'cannot translate atomic group at position 0 to ECMAScript')
+    assertRaises(lambda: re.compile(r'a*+').translate('re2'), 'cannot translate possessive repeat at position 0 to RE2')
+    assertRaises(lambda: re.compile(r'a{2000}').translate('re2'), 'cannot translate repeat count greater than 1000 at position 0 to RE2')
+    assertRaises(lambda: re.compile(r'a{70000}').translate('pcre'), 'cannot translate repeat count greater than 65535 at position 0 to PCRE')
+    assertRaises(lambda: re.compile(r'(?P<é>a)').translate('pcre'), 'cannot translate group name "é" at position 0 to PCRE')
+    assertRaises(lambda: re.compile(r'(?i:a)').translate('js'), 'cannot translate inline flags at position 0 to ECMAScript')
+    assertRaises(lambda: re.compile('[a\U0001f600]').translate('dotnet'), 'cannot translate character U+1F600 outside of the Basic Multilingual Plane in a character class at position 2 to .NET')
+    assertRaises(lambda: re.compile(r'[\Wa]').translate('dotnet'), 'cannot translate negated category with other items in a character class at position 1 to .NET')
+    assertRaises(lambda: re.compile(b'\\xff').translate('re2'), 'cannot translate non-ASCII byte at position 0 to RE2')
+    assertRaises(lambda: re.compile(b'\\w', re.L).translate('pcre'), 'cannot translate the LOCALE flag at position 0 to PCRE')
+    assertRaises(lambda: re.compile(r'a\b').translate('re2'), 'cannot translate word boundary at position 1 to RE2')
+    assertRaises(lambda: re.compile(r'(?:a|\B)').translate('js'), 'cannot translate word boundary at position 5 to ECMAScript')
+    assertRaises(lambda: re.compile('a').translate('posix'), 'unknown regex dialect "posix"')
+
+def test_compile_dialect():
+    p = re.compile_dialect(r'/(?<y>\d{4})-(?<m>\d\d)$/gi')
+    assertEqual(p.pattern, r'(?P<y>[0-9]{4})\-(?P<m>[0-9][0-9])\Z')
+    assertEqual(p.flags, re.I|re.U)
+    assertEqual(p.search('on 2024-05').group('y'), '2024')
+    assertIsNone(p.search('2024-05\n'))
+    assertEqual(p.sub(re.convert_template(p, '$<m>/$<y> ($&) $$ $1$3'), 'on 2024-05'), 'on 05/2024 (2024-05) $ 2024$3')
+
+    assertEqual(re.compile_dialect(r'(a)\2').pattern, r'(a)\x02')
+    assertEqual(re.compile_dialect(r'/^\w+$/m').findall('ab\r\ncd\u2028é'), ['ab', 'cd'])
+    assertEqual(re.compile_dialect(r'(?<y>a)\k<y>', 'javascript').pattern, r'(?P<y>a)(?(y)(?P=y))')
+    assertEqual(re.compile_dialect(r'[]|[^]').pattern, r'(?!)|(?s:.)')
+    assertEqual(re.compile_dialect(b'/\\xff\\d/').findall(b'\xff1'), [b'\xff1'])
+
+    # without the "u" flag, ECMAScript does not match non-ASCII characters with ASCII letters, if cases are ignored
+    assertEqual(re.compile_dialect('/s/i').pattern, '(?-i:[Ss])')
+    assertIsNone(re.compile_dialect('/s/i').match('\u017f'))
+    assertIsNone(re.compile_dialect('/K/i').match('\u212a'))
+    assertIsNone(re.compile_dialect('/\u212a/i').match('k'))
+    assertEqual(re.compile_dialect('/s/iu').match('\u017f').span(), (0, 2))
+    assertIsNone(re.compile_dialect('/i/iu').match('\u0130'))
+    assertEqual(re.compile_dialect(r'/\w+/i').findall('s\u017f\u212a k'), ['s', 'k'])
+    assertEqual(re.compile_dialect(r'/\w+/iu').findall('s\u017f\u212a k'), ['s\u017f\u212a', 'k'])
+    assertEqual(re.compile_dialect(r'/[^s]/i').findall('sS\u017f'), ['\u017f'])
+    assertEqual(re.compile_dialect(r'/\b\u212a/iu').search('\u017f\u212a \u212a').span(), (6, 9))
+    assertEqual(re.compile_dialect(r'/a\B/iu').search('a\u017f').span(), (0, 1))
+
+    assertEqual(re.compile_dialect(r'a(?i)b|c', 'pcre').findall('aB C'), ['aB', 'C'])
+    assertEqual(re.compile_dialect(r'\d+', 'pcre').findall('12 ٣٤'), ['12'])
+    assertEqual(re.compile_dialect(r'(*UCP)\d+', 'pcre').findall('12 ٣٤'), ['12', '٣٤'])
+    assertEqual(re.compile_dialect(r'a\z\Z', 'pcre').pattern, r'a\Z(?=\n?\Z)')
+    assertEqual(re.compile_dialect(r'\Qa.b\E+[[:digit:]x]', 'perl').pattern, r'a\.b+[0-9x]')
+    assertEqual(re.compile_dialect(r'(?<n>a)\k{n}\x{263a}', 'pcre').pattern, '(?P<n>a)(?P=n)☺')
+    assertEqual(re.compile_dialect(r'a$', 're2').pattern, r'a\Z')
+
+    assertEqual(re.convert_template(r'(a)(b)(c)(d)(e)(f)(g)(h)(i)(j)', '$10-$11-$01-$0'), r'\g<10>-\g<1>1-\g<1>-$0')
+    assertEqual(re.convert_template(r'(?P<n>\d)(\d)', '${n}$2 $n', 're2'), r'\g<n>\g<2> \g<n>')
+    assertEqual(re.convert_template(b'(?<n>\\d)', b'${n}\\', 'pcre'), b'\\g<n>\\\\')
+
+    assertRaises(lambda: re.compile_dialect('/a/y'), 'cannot import sticky flag "y" at position 3 from ECMAScript')
+    assertRaises(lambda: re.compile_dialect(r'/(a)\2/u'), 'cannot import backreference to the missing group 2 at position 4 from ECMAScript')
+    assertRaises(lambda: re.compile_dialect(r'(?|a)', 'pcre'), 'cannot import branch reset group at position 0 from PCRE')
+    assertRaises(lambda: re.compile_dialect(r'\Ga', 'pcre'), r'cannot import escape \G at position 0 from PCRE')
+    assertRaises(lambda: re.compile_dialect(r'(a)\1', 're2'), 'cannot import backreference at position 3 from RE2')
+    assertRaises(lambda: re.compile_dialect(r'(?U)a*', 'go'), 'cannot import inline flag "U" at position 2 from RE2')
+    assertRaises(lambda: re.compile_dialect('a', 'dotnet'), 'cannot import patterns from .NET')
+    assertRaises(lambda: re.compile_dialect('a', 'posix'), 'unknown regex dialect "posix"')
+    assertRaises(lambda: re.convert_template('(a)', '$`'), 'cannot import replacement "$`" at position 0 from ECMAScript')
+    assertRaises(lambda: re.convert_template('a', b'$1'), 'got bytes, want str')
+
+def test_fnmatch():
+    assertEqual(fnmatch.translate('*.txt'), r'(?s:.*\.txt)\Z')
+    assertEqual(fnmatch.translate('a*b**c'), r'(?s:a(?>.*?b).*c)\Z')
+    assertEqual(fnmatch.translate('[!a-c]?'), r'(?s:[^a-c].)\Z')
+    assertEqual(fnmatch.translate('[]'), r'(?s:\[\])\Z')
+    assertEqual(fnmatch.translate('[a-cz-a]'), r'(?s:[a-c])\Z')
+    assertEqual(fnmatch.translate('[z-a]'), r'(?s:(?!))\Z')
+    assertEqual(fnmatch.translate('[a-c-e][^&]'), r'(?s:[a-c\-e][\^\&])\Z')
+    assertEqual(fnmatch.translate(b'*\xff'), b'(?s:.*\xff)\\Z')
+
+    assertTrue(fnmatch.fnmatch('foo.txt', '*.txt'))
+    assertFalse(fnmatch.fnmatch('foo.txt\n', '*.txt'))
+    assertFalse(fnmatch.fnmatchcase('FOO.TXT', '*.txt'))
+    assertTrue(fnmatch.fnmatchcase('a\nb', 'a?b'))
+    assertTrue(fnmatch.fnmatch(b'x\xff', b'x[\xf0-\xff]'))
+    assertEqual(fnmatch.filter(['a.py', 'b.go', 'c.py'], '*.py'), ['a.py', 'c.py'])
+    assertEqual(fnmatch.filter((b'x1', b'y'), b'x?'), [b'x1'])
+    assertRaises(lambda: fnmatch.fnmatch(b'a', 'a'), 'got bytes, want str')
+
+    assertEqual(fnmatch.glob_translate('**/*.py'), r'(?s:(?:[^/.][^/]*/)*(?!\.)[^/]*\.py)\Z')
+    assertEqual(fnmatch.glob_translate('**/*.py', include_hidden=True), r'(?s:(?:.+/)?[^/]*\.py)\Z')
+    assertEqual(fnmatch.glob_translate('a/**/**/b'), r'(?s:a/(?:[^/.][^/]*/)*b)\Z')
+    assertEqual(fnmatch.glob_translate('a/*', seps='/\\'), r'(?s:a[/\\][^/\\.][^/\\]*)\Z')
+    assertEqual([fnmatch.globmatch(p, '**/*.py') for p in ['a.py', 'x/y/a.py', 'x/.y/a.py', '.a.py', 'x/a.pyc']], [True, True, False, False, False])
+    assertTrue(fnmatch.globmatch('x/.y/a.py', '**/*.py', include_hidden=True))
+    assertTrue(fnmatch.globmatch('src/a', 'src/**'))
+    assertFalse(fnmatch.globmatch('src/a/b', 'src/*'))
+    assertEqual(fnmatch.glob_filter(['src/a/b.go', 'src/b.go', 'lib/c.go'], 'src/**/*.go'), ['src/a/b.go', 'src/b.go'])
+    assertRaises(lambda: fnmatch.glob_translate('*', seps=''), 'seps must not be empty')
+
+    # wildcard patterns are compiled with the pattern cache of the re module
+    if WITH_CACHE:
+        re.purge()
+        fnmatch.fnmatch('a', '*')
+        fnmatch.filter(['a', 'b'], '*')
+        assertEqual(re.cache_info().currsize, 1)
+        assertEqual(re.cache_info().hits, 1)
+
+def test_template():
+    p = re.compile(r'(?P<a>\w)(\d)')
+    t = p.template(r'\2\g<a>-')
+    assertEqual(type(t), 'Template')
+    assertEqual(repr(t), r"<re.Template object; template='\\2\\g<a>-'>")
+    assertEqual(t.pattern, p)
+    assertEqual(t.template, r'\2\g<a>-')
+    assertEqual(p.sub(t, 'a1 b2'), '1a- 2b-')
+    assertEqual(p.subn(t, 'a1 b2', 1), ('1a- b2', 1))
+    assertEqual(re.sub(p, t, 'c3'), '3c-')
+    assertEqual(re.sub(r'(?P<a>\w)(\d)', t, 'd4'), '4d-')
+    assertEqual(p.search('x9').expand(t), '9x-')
+
+    t2 = re.compile_template(r'(?P<a>\w)(\d)', r'\2\g<a>-')
+    assertEqual(t, t2)
+    assertNotEqual(t, p.template(r'\1'))
+    assertEqual({t: 1}[t2], 1)
+    assertEqual(re.compile_template('a', 'b').pattern, re.compile('a'))
+
+    t3 = re.compile(b'(a)').template(b'[\\1]')
+    assertEqual(re.sub(b'(a)', t3, b'bab'), b'b[a]b')
+    assertEqual(re.compile(b'(a)').template(b'x').template, b'x')
+
+    # templates are validated when they are created
+    assertRaises(lambda: p.template(r'\3'), 'invalid group reference 3 at position 1')
+    assertRaises(lambda: p.template(b'x'), 'got bytes, want str')
+    assertRaises(lambda: re.sub('x', t, 'x'), r"template was compiled for the pattern re.compile('(?P<a>\\w)(\\d)')")
+    assertRaises(lambda: re.search('a', 'a').expand(t), r"template was compiled for the pattern re.compile('(?P<a>\\w)(\\d)')")
+
+def test_format_templates():
+    p = re.compile(r'(?P<k>\w+)=(\d+)?')
+    assertEqual(p.subf('{k}:{2!r:>6}|', 'a=1 bb= c=333'), "a:   '1'| bb:    ''| c: '333'|")
+    assertEqual(p.subfn('{}{{}}{}{}', 'a=1 b='), ('a=1{}a1 b={}b', 2))
+    assertEqual(p.subf('x', 'a=1 b=2', 1), 'x b=2')
+    assertEqual(p.search('key=42').expandf('{0!r} {k:*^9} {2:05} {1:.2}'), "'key=42' ***key*** 42000 ke")
+    assertEqual(re.compile('(é)').search('é').expandf('{1:é>3}{1!a}{1!s:3}|'), "ééé'\\xe9'é  |")
+    assertEqual(re.compile(b'(a)(b)?').search(b'a').expandf(b'{1:->4}{2!r}{0!r}'), b"---ab''b'a'")
+
+    m = re.compile('(?P<k>a)').search('a')
+    assertRaises(lambda: m.expandf('{'), "expected '}' before end of string at position 0")
+    assertRaises(lambda: m.expandf('}'), "single '}' encountered in format string at position 0")
+    assertRaises(lambda: m.expandf('{2}'), 'invalid group reference 2 at position 1')
+    assertRaises(lambda: m.expandf('{x}'), "unknown group name 'x' at position 1")
+    assertRaises(lambda: m.expandf('{k.upper}'), "bad character in group name 'k.upper' at position 1")
+    assertRaises(lambda: m.expandf('{k!x}'), 'unknown conversion specifier x at position 3')
+    assertRaises(lambda: m.expandf('{k:+}'), "invalid format specifier '+' for a group at position 3")
+    assertRaises(lambda: m.expandf('{k:.}'), "missing precision in format specifier '.' at position 3")
+    assertRaises(lambda: m.expandf('{k:4611686018427387904}'), "too large width in format specifier '4611686018427387904' at position 3")
+    assertRaises(lambda: m.expandf('{k:65537}'), "too large width in format specifier '65537' at position 3")
+    assertEqual(len(m.expandf('{k:65536}')), 65536)
+    assertRaises(lambda: m.expandf('{0}{}'), 'cannot switch from manual field specification to automatic field numbering at position 3')
+    assertRaises(lambda: m.expandf('{k:{w}}'), 'nested replacement fields are not supported at position 0')
+    assertRaises(lambda: m.expandf(b'{0}'), 'got bytes, want str')
+    assertRaises(lambda: p.subf('{0}', b'a=1'), 'got str, want bytes')
+
+def test_mapping_replacement():
+    table = {'cat': 'dog', 'category': 'kind', 'a': 'b'}
+    p = re.compile(r'\w+')
+    assertEqual(p.sub(table, 'cat a', default='?'), 'dog b')
+    assertEqual(p.sub(table, 'cat x a', default='?'), 'dog ? b')
+    assertEqual(p.subn(table, 'cat a cat', 2), ('dog b cat', 2))
+    assertEqual(re.sub(r'\$(\w+)', {'x': '1'}, '$x $y', group=1, default=''), '1 ')
+    assertEqual(re.sub(r'\$(?P<n>\w+)', {'x': '1'}, '$x $y', group='n', default='$'), '1 $')
+    assertEqual(re.compile(r'(a)|b').subn({'a': 'A'}, 'ab', group=1, default='-'), ('A-', 2))
+    assertEqual(re.sub(b'.', {b'a': b'x'}, b'ab', default=b''), b'x')
+
+    assertRaises(lambda: p.sub(table, 'cat x'), 'key "x" not found in mapping')
+    assertRaises(lambda: re.sub(r'(a)|b', {}, 'b', group=1), 'key None not found in mapping')
+    assertRaises(lambda: p.sub({'x': 1}, 'x'), 'got int, want str or bytes')
+    assertRaises(lambda: p.sub({'x': b'y'}, 'x'), 'got bytes, want str')
+    assertRaises(lambda: p.sub(table, 'x', default=b''), 'default: got bytes, want str')
+    assertRaises(lambda: p.sub(table, 'x', group=1), 'IndexError: no such group')
+    assertRaises(lambda: p.sub('y', 'x', group=0), 'group and default are only supported for mapping replacements')
+    assertRaises(lambda: p.sub(1, 'x'), 'got int, want str, function or mapping')
+    assertRaises(lambda: p.sub(table, 'x', 0, ''), 'sub: got 4 arguments, want at most 3')
+
+def test_compile_words():
+    assertEqual(re.compile_words(['foo', 'foobar', 'fob', 'a', 'b', 'c']).pattern, '(?:fo(?:o(?:bar)?|b)|[abc])')
+    assertEqual(re.compile_words(['a', 'ab', 'abc']).pattern, 'a(?:bc?)?')
+    assertEqual(re.compile_words(['xy', 'xz', 'x']).pattern, 'x[yz]?')
+    assertEqual(re.compile_words(['', 'x']).pattern, 'x?')
+    assertEqual(re.compile_words(['a-b', 'a]', 'a^', 'a\\']).pattern, 'a(?:\\-b|[\\\\\\]\\^])')
+    assertEqual(re.compile_words([]).pattern, '(?!)')
+    assertEqual(re.compile_words([b'\xff', b'a']).pattern, b'[a\xff]')
+    assertEqual(re.compile_words(['cat'], boundary=True).pattern, r'\b(?:cat)\b')
+    assertEqual(re.compile_words(['A'], re.I).flags, re.I|re.U)
+
+    # if cases are ignored, words only differing in case are merged, so the longest word is still preferred
+    assertEqual(re.compile_words(['abc', 'Ab'], re.I).pattern, 'abc?')
+    assertEqual(re.compile_words(['abc', 'Ab'], re.I).match('ABC').group(), 'ABC')
+    assertEqual(re.compile_words(['x\u017f', 'XSt'], re.I).match('xst').group(), 'xst')
+    assertEqual(re.compile_words(['\u212a', 'Ka'], re.I|re.A).pattern, '(?:Ka|\u212a)')
+    assertEqual(re.compile_words([b'ab', b'Abc'], re.I).match(b'abc').group(), b'abc')
+
+    table = {'cat': 'dog', 'category': 'kind', 'a': 'b'}
+    p = re.compile_words(table)
+    assertEqual(p.sub(table, 'a category of cats'), 'b kind of dogs')
+    assertEqual(re.compile_words(table, boundary=True).sub(table, 'a category of cats'), 'b kind of cats')
+    # the mapping is looked up with the exact text of the match
+    assertEqual(re.compile_words(table, re.I).sub(table, 'a Cat', default='?'), 'b ?')
+    assertRaises(lambda: re.compile_words(table, re.I).sub(table, 'Cat'), 'key "Cat" not found in mapping')
+
+    assertRaises(lambda: re.compile_words(['a', b'b']), 'cannot mix str and bytes words')
+    assertRaises(lambda: re.compile_words([1]), 'got int, want str or bytes')
+
+def test_locale_table():
+    # the module uses the ISO-8859-1 table for bytes patterns with the LOCALE flag
+    for flags in (re.L, re.L|re.FALLBACK):
+        assertTrue(re.match(b'\\w', b'\xe5', flags))
+        assertIsNone(re.match(b'\\w', b'\xd7', flags))
+        assertIsNone(re.match(b'\\W', b'\xe5', flags))
+        assertTrue(re.match(b'[^\\W]', b'\xc5', flags))
+        assertIsNone(re.match(b'\\s', b'\xa0', flags))
+        assertIsNone(re.match(b'\\d', b'\xb2', flags))
+        assertTrue(re.match(b'[\xe0-\xe5]', b'\xc3', flags|re.I))
+        assertIsNone(re.match(b'[^\xe5]', b'\xc5', flags|re.I))
+        assertIsNone(re.match(b'\xff', b'\xdf', flags|re.I))
+        assertEqual(re.findall(b'\\b\\w+\\b', b'\xe9t\xe9 caf\xe9', flags), [b'\xe9t\xe9', b'caf\xe9'])
+        assertEqual(re.sub(b'\\B', b'-', b'a\xe9b', flags=flags), b'a-\xe9-b')
+
+    # without the LOCALE flag, only ASCII characters are word characters
+    assertIsNone(re.match(b'\\w', b'\xe5'))
+    assertIsNone(re.match(b'\xc5', b'\xe5', re.I))
+    assertEqual(re.findall(b'\\b\\w+\\b', b'\xe9t\xe9 caf\xe9'), [b't', b'caf'])
+
+    # the LOCALE flag of a group also applies to word boundaries in nested groups
+    for flags in (0, re.FALLBACK):
+        assertIsNone(re.search(b'(?L:(?i:\\b))\xe9', b'a\xe9', flags))
+        assertEqual(re.search(b'(?L:(?i:\\b))\xe9', b' \xe9', flags).span(), (1, 2))
+
 def test_no_fallback():
     assertRaises(lambda: re.FALLBACK)
     assertRaises(lambda: re.compile(r'(x)(?!y)'))
@@ -3979,6 +4506,35 @@ def test_max_cache_size():
 
     assertIsNot(p, re.compile(s))
 
+def test_cache_info():
+    re.purge()
+    info = re.cache_info()
+    assertEqual((info.hits, info.misses, info.currsize, info.evictions), (0, 0, 0, 0))
+    assertEqual(info.maxsize, 64)
+    assertEqual(info.engines, {})
+
+    re.compile(r'abc')
+    re.compile(r'abc')
+    re.search(r'def', 'abcdef')
+    info = re.cache_info()
+    assertEqual((info.hits, info.misses, info.currsize, info.evictions), (1, 2, 2, 0))
+    assertEqual(info.engines, {'std': 2})
+
+    for i in range(100):
+        re.compile(str(i))
+    info = re.cache_info()
+    assertEqual((info.misses, info.currsize, info.evictions), (102, 64, 38))
+
+    re.purge()
+    info = re.cache_info()
+    assertEqual((info.hits, info.misses, info.currsize, info.evictions), (0, 0, 0, 0))
+
+    if WITH_FALLBACK:
+        re.compile(r'abc')
+        re.compile(r'a(?=b)')
+        assertEqual(re.cache_info().engines, {'backtrack': 1, 'std': 1})
+        re.purge()
+
 def test_no_cache():
     s = r'abc'
 
@@ -3987,8 +4543,15 @@ def test_no_cache():
     re.purge() # should have no effect
     assertIsNot(p, re.compile(s))
 
+    info = re.cache_info()
+    assertEqual((info.hits, info.misses, info.maxsize, info.currsize), (0, 0, 0, 0))
+
 # Run all tests:
 
+test_parser_regressions()
+test_lint()
+test_explain()
+
 if WITH_FALLBACK:
     test_search_star_plus()
     test_branching()
@@ -4168,11 +4731,31 @@ if WITH_FALLBACK:
     test_span_unicode_invalid()
     test_bits_optimized()
     test_findall_empty_single_group_match()
+    test_backtrack_engine()
+    test_prefilter()
+    test_input_cache()
+    test_engine_regressions()
+    test_diagram()
+    test_generate()
+    test_translate()
+    test_compile_dialect()
+    test_fnmatch()
+    test_template()
+    test_format_templates()
+    test_mapping_replacement()
+    test_compile_words()
 else:
     test_no_fallback()
 
+if WITH_LOCALE:
+    check_en_US_iso88591()
+    test_locale_table()
+else:
+    check_en_US_utf8()
+
 if WITH_CACHE:
     test_cache()
     test_max_cache_size()
+    test_cache_info()
 else:
     test_no_cache()
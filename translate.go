@@ -0,0 +1,26 @@
+package re
+
+import (
+	"go.starlark.net/starlark"
+
+	"github.com/magnetde/starlark-re/regex"
+)
+
+// patternTranslate returns the pattern translated into another regex dialect (see `regex.Translate`).
+// The dialect is one of "re2", "pcre", "ecmascript" (or "js") and "dotnet".
+func patternTranslate(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var dialect string
+
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "dialect", &dialect); err != nil {
+		return nil, err
+	}
+
+	p := b.Receiver().(*Pattern)
+
+	s, err := regex.Translate(p.pattern.value, p.pattern.isString, p.flags, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.String(s), nil
+}
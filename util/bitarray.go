@@ -20,6 +20,11 @@ type BitArray struct {
 	rs     []uint32
 }
 
+// Size returns the number of bytes allocated by the bitarray.
+func (b *BitArray) Size() int {
+	return 4 * (cap(b.data) + cap(b.rs))
+}
+
 // Grow increases the capacity to guarantee space for `n` extra bits.
 func (b *BitArray) Grow(n int) {
 	b.ensureCap(b.len + uint(n))
@@ -95,7 +100,7 @@ func (b *BitArray) Optimize() {
 
 	n := uint(len(b.data))
 	s := blockw * factor
-	numSBlock := divup(b.len, s)
+	numSBlock := b.len/s + 1 // rank queries for the last bit access the superblock at `b.len/s`
 
 	rs := make([]uint32, numSBlock)
 
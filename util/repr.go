@@ -51,7 +51,7 @@ func stringRepr(s string, isString bool, bPrefix bool) string {
 		}
 
 		// Handle utf8 errors; should not happen
-		if ch == utf8.RuneError {
+		if ch == utf8.RuneError && size == 1 {
 			b.WriteString(`\x`)
 			b.WriteByte(hexDigits[(s[0]>>4)&0xf])
 			b.WriteByte(hexDigits[s[0]&0xf])
@@ -0,0 +1,185 @@
+package re
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"go.starlark.net/starlark"
+
+	"github.com/magnetde/starlark-re/regex"
+)
+
+// wordTrie is a node of a trie of words.
+// Each edge is labeled with a single character of a string or a single byte of a bytes object.
+// If cases are ignored, the edges are labeled with the case-folded characters, so words, that only differ
+// in case, share the same nodes.
+type wordTrie struct {
+	children map[rune]*wordTrie
+	c        rune // character of the edge to this node, that is written into the pattern
+	terminal bool // a word ends at this node
+}
+
+// add adds the word to the trie. If `fold` is not nil, it is used to fold the cases of the characters.
+func (t *wordTrie) add(word string, isString bool, fold func(c rune) rune) {
+	n := t
+	for i := 0; i < len(word); {
+		c, size := rune(word[i]), 1
+		if isString {
+			c, size = utf8.DecodeRuneInString(word[i:])
+		}
+		i += size
+
+		key := c
+		if fold != nil {
+			key = fold(c)
+		}
+
+		child, ok := n.children[key]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[rune]*wordTrie)
+			}
+
+			child = &wordTrie{c: c}
+			n.children[key] = child
+		}
+
+		n = child
+	}
+
+	n.terminal = true
+}
+
+// pattern writes a regex pattern to `b`, that matches the words of the trie.
+// Words, that are prefixes of other words, become optional suffixes of greedy repeats,
+// so the longest word is matched at a position. Single characters of leaves are merged into sets.
+func (t *wordTrie) pattern(b *strings.Builder, isString bool) {
+	keys := make([]rune, 0, len(t.children))
+	for c := range t.children {
+		keys = append(keys, c)
+	}
+	slices.Sort(keys)
+
+	var alts []string
+	var set strings.Builder
+	setSize := 0
+
+	for _, k := range keys {
+		child := t.children[k]
+
+		lit := wordLiteral(child.c, isString)
+		if len(child.children) == 0 {
+			set.WriteString(lit)
+			setSize++
+			continue
+		}
+
+		var sub strings.Builder
+		sub.WriteString(lit)
+		child.pattern(&sub, isString)
+		alts = append(alts, sub.String())
+	}
+
+	onlySet := len(alts) == 0
+	switch setSize {
+	case 0:
+	case 1:
+		alts = append(alts, set.String())
+	default:
+		alts = append(alts, "["+set.String()+"]")
+	}
+
+	if len(alts) == 0 {
+		return
+	}
+
+	optional := t.terminal
+	grouped := len(alts) > 1 || (optional && !onlySet)
+
+	if grouped {
+		b.WriteString("(?:")
+	}
+	b.WriteString(strings.Join(alts, "|"))
+	if grouped {
+		b.WriteByte(')')
+	}
+	if optional {
+		b.WriteByte('?')
+	}
+}
+
+// wordLiteral returns the escaped character of a word for a regex pattern.
+func wordLiteral(c rune, isString bool) string {
+	if isString {
+		return escapePattern(string(c))
+	}
+
+	return escapePattern(string([]byte{byte(c)}))
+}
+
+// reCompileWords compiles a pattern, that matches any of the words, for example the keys of a dict.
+// The words are merged into a trie, so the pattern does not try each word separately and
+// the longest word is matched, if a word is a prefix of another word.
+// If `boundary` is true, the words must start and end at word boundaries. If the IGNORECASE flag is set,
+// words, that only differ in case, are merged, so the longest word is preferred independent of its case.
+// The resulting pattern can be used with the dict in `sub`, to replace each word by its value.
+func reCompileWords(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		words    starlark.Iterable
+		flags    uint32
+		boundary bool
+	)
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "words", &words, "flags?", &flags, "boundary?", &boundary); err != nil {
+		return nil, err
+	}
+
+	var list []strOrBytes
+
+	iter := words.Iterate()
+	defer iter.Done()
+
+	var v starlark.Value
+	for iter.Next(&v) {
+		var word strOrBytes
+		if err := word.Unpack(v); err != nil {
+			return nil, err
+		}
+
+		if len(list) > 0 && word.isString != list[0].isString {
+			return nil, errors.New("cannot mix str and bytes words")
+		}
+
+		list = append(list, word)
+	}
+
+	isString := len(list) == 0 || list[0].isString
+	m := b.Receiver().(*Module)
+
+	// If cases are ignored, words, that only differ in case, are merged, so the longest word is still preferred.
+	var fold func(c rune) rune
+	if flags&regex.FlagIgnoreCase != 0 {
+		fold = regex.FoldCase(isString, flags, m.locale)
+	}
+
+	var trie wordTrie
+	for _, word := range list {
+		trie.add(word.value, word.isString, fold)
+	}
+
+	var pattern strings.Builder
+
+	switch {
+	case len(list) == 0:
+		pattern.WriteString("(?!)")
+	case boundary:
+		pattern.WriteString(`\b(?:`)
+		trie.pattern(&pattern, isString)
+		pattern.WriteString(`)\b`)
+	default:
+		trie.pattern(&pattern, isString)
+	}
+
+	return m.compile(thread, strOrBytes{value: pattern.String(), isString: isString}, flags)
+}